@@ -1,58 +1,126 @@
 package main
 
 import (
+	appconfig "Verve/internal/configs/appConfig"
+	appcontext "Verve/internal/configs/appContext"
+	"Verve/internal/database"
+	"Verve/internal/lifecycle"
 	"Verve/internal/server"
 	"context"
-	"fmt"
+	"errors"
+	"flag"
 	"log"
 	"net/http"
+	"os"
 	"os/signal"
 	"syscall"
 	"time"
 )
 
-func gracefulShutdown(apiServer *http.Server, done chan bool) {
-	// Create context that listens for the interrupt signal from the OS.
-	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
-	defer stop()
+// httpShutdownTimeout is how long in-flight requests get to finish on shutdown.
+const httpShutdownTimeout = 5 * time.Second
 
-	// Listen for the interrupt signal.
-	<-ctx.Done()
-
-	log.Println("shutting down gracefully, press Ctrl+C again to force")
+// serveHook runs the http server as the last started, first stopped subsystem.
+// Errors of ListenAndServe are reported on serveErr.
+func serveHook(apiServer *http.Server, serveErr chan<- error) lifecycle.Hook {
+	return lifecycle.Hook{
+		Name: "http server",
+		Start: func(ctx context.Context) error {
+			go func() {
+				log.Println("Server started")
+				if err := apiServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+					serveErr <- err
+				}
+			}()
+			return nil
+		},
+		Stop:    apiServer.Shutdown,
+		Timeout: httpShutdownTimeout,
+	}
+}
 
-	// The context is used to inform the server it has 5 seconds to finish
-	// the request it is currently handling
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	if err := apiServer.Shutdown(ctx); err != nil {
-		log.Printf("Server forced to shutdown with error: %v", err)
+// reloadOnHangup reloads the configuration on SIGHUP and applies its log level,
+// the rest of the configuration needs a restart. An invalid configuration is
+// reported and the current level is kept.
+func reloadOnHangup(ctx context.Context, app *appcontext.AppContext) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+	for {
+		select {
+		case <-hangup:
+			config, _, err := appconfig.Load(os.Args[1:])
+			if err != nil {
+				app.Logger.Error("Failed to reload the configuration on SIGHUP", "error", err)
+				continue
+			}
+			app.AdminService.SetLogLevel(config.Log.SlogLevel())
+		case <-ctx.Done():
+			return
+		}
 	}
+}
 
-	log.Println("Server exiting")
+// run starts the application, waits for a termination signal or a server failure,
+// then stops every subsystem. It returns the process exit code.
+func run() int {
+	config, options, err := appconfig.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		log.Print(err)
+		return 2
+	}
+	if options.PrintConfig {
+		if err := config.Write(os.Stdout); err != nil {
+			log.Printf("failed to print config: %v", err)
+			return 1
+		}
+		return 0
+	}
 
-	// Notify the main goroutine that the shutdown is complete
-	done <- true
-}
+	app, err := appcontext.New(config, database.New(config.Redis))
+	if err != nil {
+		log.Printf("failed to build app context: %v", err)
+		return 1
+	}
 
-func main() {
+	apiServer := server.NewServer(app)
+	serveErr := make(chan error, 1)
+	app.Lifecycle.Append(serveHook(apiServer, serveErr))
 
-	server := server.NewServer()
+	// Create context that listens for the interrupt signal from the OS.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-	// Create a done channel to signal when the shutdown is complete
-	done := make(chan bool, 1)
+	if err := app.Start(ctx); err != nil {
+		log.Printf("failed to start: %v", err)
+		return 1
+	}
 
-	// Run graceful shutdown in a separate goroutine
-	go gracefulShutdown(server, done)
+	go reloadOnHangup(ctx, app)
 
-	log.Println("Server started")
+	exitCode := 0
+	select {
+	case <-ctx.Done():
+		log.Println("shutting down gracefully, press Ctrl+C again to force")
+	case err := <-serveErr:
+		log.Printf("http server error: %v", err)
+		exitCode = 1
+	}
+	// Restore the default signal handling so a second signal kills the process.
+	stop()
 
-	err := server.ListenAndServe()
-	if err != nil && err != http.ErrServerClosed {
-		panic(fmt.Sprintf("http server error: %s", err))
+	if err := app.Stop(context.Background()); err != nil {
+		log.Printf("shutdown completed with errors: %v", err)
+		exitCode = 1
 	}
 
-	// Wait for the graceful shutdown to complete
-	<-done
 	log.Println("Graceful shutdown complete.")
+	return exitCode
+}
+
+func main() {
+	os.Exit(run())
 }
@@ -0,0 +1,131 @@
+package auth
+
+import (
+	e "Verve/internal/configs/errorResponse"
+	"Verve/internal/database"
+	"Verve/internal/model/entity"
+	"Verve/internal/model/request"
+	"Verve/internal/repository"
+	"Verve/internal/service"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// APIKeyHeader carries the API key of a client, which may also be sent as a
+// bearer token in the Authorization header.
+const APIKeyHeader = "X-API-Key"
+
+// adminKeyId identifies the keys of the configuration, which are not stored.
+const adminKeyId = "config"
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying the authenticated key.
+func WithPrincipal(ctx context.Context, apiKey *entity.APIKey) context.Context {
+	return context.WithValue(ctx, principalKey{}, apiKey)
+}
+
+// FromContext returns the key that authenticated the request, if any.
+func FromContext(ctx context.Context) (*entity.APIKey, bool) {
+	apiKey, ok := ctx.Value(principalKey{}).(*entity.APIKey)
+	return apiKey, ok && apiKey != nil
+}
+
+// KeyFromRequest returns the API key sent with the request, or an empty string.
+func KeyFromRequest(r *http.Request) string {
+	if key := r.Header.Get(APIKeyHeader); key != "" {
+		return key
+	}
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
+
+// Authenticator resolves the API key of a request. When required, requests
+// without a key are rejected; otherwise they continue anonymously and only the
+// keys that are sent are checked.
+type Authenticator struct {
+	keys      service.APIKeyService
+	adminKeys []string
+	required  bool
+	logger    *slog.Logger
+}
+
+// New creates an authenticator over the stored keys. adminKeys are the hashes of
+// the keys of the configuration, which hold the admin scope and bootstrap the
+// creation of stored keys.
+func New(keys service.APIKeyService, adminKeys []string, required bool, logger *slog.Logger) *Authenticator {
+	return &Authenticator{keys: keys, adminKeys: adminKeys, required: required, logger: logger}
+}
+
+// Middleware authenticates the request and stores the key in its context.
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := KeyFromRequest(r)
+		if key == "" {
+			if a.required {
+				sendProblem(w, r, http.StatusUnauthorized, e.CodeUnauthorized, e.ErrUnauthorized.Error())
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		apiKey, err := a.authenticate(r.Context(), key)
+		switch {
+		case errors.Is(err, repository.ErrAPIKeyNotFound):
+			sendProblem(w, r, http.StatusUnauthorized, e.CodeUnauthorized, e.ErrUnauthorized.Error())
+			return
+		case database.IsUnavailable(err):
+			sendProblem(w, r, http.StatusServiceUnavailable, e.CodeUnavailable, "failed to check api key")
+			return
+		case err != nil:
+			a.logger.Error("Failed to check api key", "error", err)
+			sendProblem(w, r, http.StatusInternalServerError, e.CodeInternal, "failed to check api key")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), apiKey)))
+	})
+}
+
+func (a *Authenticator) authenticate(ctx context.Context, key string) (*entity.APIKey, error) {
+	hash := service.HashAPIKey(key)
+	for _, adminKey := range a.adminKeys {
+		if subtle.ConstantTimeCompare([]byte(hash), []byte(adminKey)) == 1 {
+			return &entity.APIKey{Id: adminKeyId, Name: "admin key of the configuration", Scopes: []string{request.ScopeAdmin}}, nil
+		}
+	}
+	return a.keys.Authenticate(ctx, key)
+}
+
+// RequireScope rejects the keys without scope. Anonymous requests are only let
+// through when authentication is not required.
+func (a *Authenticator) RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			apiKey, ok := FromContext(r.Context())
+			switch {
+			case !ok && a.required:
+				sendProblem(w, r, http.StatusUnauthorized, e.CodeUnauthorized, e.ErrUnauthorized.Error())
+				return
+			case ok && !apiKey.HasScope(scope):
+				sendProblem(w, r, http.StatusForbidden, e.CodeForbidden, fmt.Sprintf("the api key lacks the %s scope", scope))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func sendProblem(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="verve"`)
+	}
+	e.SendProblem(w, r, e.NewProblem(status, code, detail))
+}
@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"Verve/internal/model/entity"
+	"Verve/internal/model/request"
+	"Verve/internal/repository"
+	"Verve/internal/service"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// stubKeys authenticates the keys of its map.
+type stubKeys map[string]*entity.APIKey
+
+func (s stubKeys) Create(ctx context.Context, apiKey request.APIKeyRequest) (*entity.APIKey, error) {
+	return nil, nil
+}
+
+func (s stubKeys) Authenticate(ctx context.Context, key string) (*entity.APIKey, error) {
+	if apiKey, ok := s[key]; ok {
+		return apiKey, nil
+	}
+	return nil, repository.ErrAPIKeyNotFound
+}
+
+func (s stubKeys) Revoke(ctx context.Context, id string) error { return nil }
+
+func serve(a *Authenticator, scope string, header, value string) (*httptest.ResponseRecorder, *entity.APIKey) {
+	var principal *entity.APIKey
+	handler := a.Middleware(a.RequireScope(scope)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, _ = FromContext(r.Context())
+	})))
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if header != "" {
+		r.Header.Set(header, value)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w, principal
+}
+
+func TestMiddleware(t *testing.T) {
+	keys := stubKeys{
+		"vk_accept": {Id: "k1", Namespace: "shop", Scopes: []string{request.ScopeAccept}},
+	}
+	adminKey := "an-admin-key-of-the-configuration-32"
+	adminKeys := []string{service.HashAPIKey(adminKey)}
+
+	tests := []struct {
+		name       string
+		required   bool
+		scope      string
+		header     string
+		value      string
+		wantStatus int
+		wantKeyId  string
+	}{
+		{"anonymous allowed when optional", false, request.ScopeAccept, "", "", http.StatusOK, ""},
+		{"anonymous rejected when required", true, request.ScopeAccept, "", "", http.StatusUnauthorized, ""},
+		{"unknown key rejected when optional", false, request.ScopeAccept, APIKeyHeader, "vk_unknown", http.StatusUnauthorized, ""},
+		{"key with the scope", true, request.ScopeAccept, APIKeyHeader, "vk_accept", http.StatusOK, "k1"},
+		{"bearer token", true, request.ScopeAccept, "Authorization", "Bearer vk_accept", http.StatusOK, "k1"},
+		{"key without the scope", true, request.ScopeWebhooks, APIKeyHeader, "vk_accept", http.StatusForbidden, ""},
+		{"admin key of the configuration", true, request.ScopeAdmin, APIKeyHeader, adminKey, http.StatusOK, adminKeyId},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := New(keys, adminKeys, tt.required, slog.Default())
+			w, principal := serve(a, tt.scope, tt.header, tt.value)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if w.Code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Errorf("401 without a WWW-Authenticate header")
+			}
+			if tt.wantKeyId != "" && (principal == nil || principal.Id != tt.wantKeyId) {
+				t.Errorf("principal = %+v, want key %s", principal, tt.wantKeyId)
+			}
+		})
+	}
+}
@@ -0,0 +1,305 @@
+package appconfig
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// redactedValue replaces secrets when the configuration is printed.
+const redactedValue = "[REDACTED]"
+
+// Config is the typed configuration of the application. It is built by Load from
+// defaults, an optional YAML or JSON file, environment variables and flags, in
+// increasing order of precedence.
+type Config struct {
+	Server    ServerConfig    `json:"server" yaml:"server"`
+	Redis     RedisConfig     `json:"redis" yaml:"redis"`
+	Kafka     KafkaConfig     `json:"kafka" yaml:"kafka"`
+	Callback  CallbackConfig  `json:"callback" yaml:"callback"`
+	Id        IdConfig        `json:"id" yaml:"id"`
+	Tracing   TracingConfig   `json:"tracing" yaml:"tracing"`
+	Degraded  DegradedConfig  `json:"degraded" yaml:"degraded"`
+	RateLimit RateLimitConfig `json:"rate_limit" yaml:"rate_limit"`
+	Auth      AuthConfig      `json:"auth" yaml:"auth"`
+	Log       LogConfig       `json:"log" yaml:"log"`
+}
+
+type ServerConfig struct {
+	Port int `json:"port" yaml:"port"`
+}
+
+type RedisConfig struct {
+	Address  string `json:"address" yaml:"address"`
+	Port     int    `json:"port" yaml:"port"`
+	Password string `json:"password" yaml:"password"`
+	Database int    `json:"database" yaml:"database"`
+}
+
+// Addr returns the host:port of the Redis server.
+func (c RedisConfig) Addr() string {
+	return fmt.Sprintf("%s:%d", c.Address, c.Port)
+}
+
+type KafkaConfig struct {
+	Brokers []string `json:"brokers" yaml:"brokers"`
+	GroupID string   `json:"group_id" yaml:"group_id"`
+}
+
+type CallbackConfig struct {
+	Workers        int      `json:"workers" yaml:"workers"`
+	QueueSize      int      `json:"queue_size" yaml:"queue_size"`
+	Overflow       string   `json:"overflow" yaml:"overflow"`
+	AllowedSchemes []string `json:"allowed_schemes" yaml:"allowed_schemes"`
+	AllowedHosts   []string `json:"allowed_hosts" yaml:"allowed_hosts"`
+	DeniedHosts    []string `json:"denied_hosts" yaml:"denied_hosts"`
+	AllowedPorts   []int    `json:"allowed_ports" yaml:"allowed_ports"`
+	AllowPrivate   bool     `json:"allow_private" yaml:"allow_private"`
+	// SigningKeys holds comma separated id:secret pairs, callbacks are unsigned when empty.
+	SigningKeys string `json:"signing_keys" yaml:"signing_keys"`
+}
+
+// DegradedConfig controls the degraded mode: while Redis is unreachable, accepted
+// ids are kept in a local bucket of at most MaxIds ids and reconciled into Redis
+// once it recovers.
+type DegradedConfig struct {
+	Enabled bool `json:"enabled" yaml:"enabled"`
+	MaxIds  int  `json:"max_ids" yaml:"max_ids"`
+}
+
+// RateLimitConfig sets the limits of a client, identified by Key, on every route
+// and on the accept endpoint, and the limit of every id on the accept endpoint.
+// Rates are requests per second, a zero rate disables the limit.
+type RateLimitConfig struct {
+	Enabled bool `json:"enabled" yaml:"enabled"`
+	// Key identifies a client: ip, api_key or namespace.
+	Key string `json:"key" yaml:"key"`
+	// TrustForwarded reads the client ip from X-Forwarded-For, behind a trusted proxy only.
+	TrustForwarded bool `json:"trust_forwarded" yaml:"trust_forwarded"`
+	// TrustedProxies is the number of proxies in front of the service, each one
+	// appends the address it received the request from to X-Forwarded-For.
+	TrustedProxies int     `json:"trusted_proxies" yaml:"trusted_proxies"`
+	Rate           float64 `json:"rate" yaml:"rate"`
+	Burst          int     `json:"burst" yaml:"burst"`
+	AcceptRate     float64 `json:"accept_rate" yaml:"accept_rate"`
+	AcceptBurst    int     `json:"accept_burst" yaml:"accept_burst"`
+	IdRate         float64 `json:"id_rate" yaml:"id_rate"`
+	IdBurst        int     `json:"id_burst" yaml:"id_burst"`
+}
+
+// ForwardedHops returns the number of trusted X-Forwarded-For entries, zero when
+// the header is not trusted.
+func (c RateLimitConfig) ForwardedHops() int {
+	if !c.TrustForwarded {
+		return 0
+	}
+	return c.TrustedProxies
+}
+
+// AuthConfig controls API key authentication. Admin routes always require a key
+// with the admin scope; Enabled also requires a key on the API routes.
+type AuthConfig struct {
+	Enabled bool `json:"enabled" yaml:"enabled"`
+	// AdminKeys holds comma separated keys with the admin scope, used to create the stored keys.
+	AdminKeys string `json:"admin_keys" yaml:"admin_keys"`
+}
+
+// minAdminKeyLength is the shortest accepted admin key.
+const minAdminKeyLength = 32
+
+// AdminKeyList returns the admin keys of the configuration.
+func (c AuthConfig) AdminKeyList() []string {
+	keys := make([]string, 0)
+	for _, key := range strings.Split(c.AdminKeys, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// Log formats.
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// Log sinks.
+const (
+	LogSinkStdout = "stdout"
+	LogSinkFile   = "file"
+	LogSinkSyslog = "syslog"
+)
+
+// LogConfig sets the format and level of the logs, the sampling of the request
+// logs and the sinks the records are written to.
+type LogConfig struct {
+	Format string `json:"format" yaml:"format"`
+	// Level is debug, info, warn or error; it can be changed at runtime.
+	Level string `json:"level" yaml:"level"`
+	// RequestSampleRate is the fraction of successful requests logged, failed
+	// requests are always logged. Zero disables the logs of successful requests.
+	RequestSampleRate float64 `json:"request_sample_rate" yaml:"request_sample_rate"`
+	// Sinks lists where every record is written: stdout, file and syslog.
+	Sinks  []string        `json:"sinks" yaml:"sinks"`
+	File   LogFileConfig   `json:"file" yaml:"file"`
+	Syslog LogSyslogConfig `json:"syslog" yaml:"syslog"`
+	// CountFile, when set, receives the per-minute unique count records instead
+	// of the sinks. It is rotated with the limits of File.
+	CountFile string `json:"count_file" yaml:"count_file"`
+}
+
+// LogFileConfig sets the path of the file sink and its rotation. A zero limit
+// disables it.
+type LogFileConfig struct {
+	Path       string `json:"path" yaml:"path"`
+	MaxSizeMB  int    `json:"max_size_mb" yaml:"max_size_mb"`
+	MaxAgeDays int    `json:"max_age_days" yaml:"max_age_days"`
+	MaxBackups int    `json:"max_backups" yaml:"max_backups"`
+}
+
+// LogSyslogConfig sets the syslog daemon of the syslog sink, the local one when
+// Network is empty.
+type LogSyslogConfig struct {
+	Network string `json:"network" yaml:"network"`
+	Address string `json:"address" yaml:"address"`
+	Tag     string `json:"tag" yaml:"tag"`
+}
+
+// SlogLevel returns the parsed level, info when it is invalid.
+func (c LogConfig) SlogLevel() slog.Level {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Level)); err != nil {
+		return slog.LevelInfo
+	}
+	return level
+}
+
+type IdConfig struct {
+	Format    string `json:"format" yaml:"format"`
+	MaxLength int    `json:"max_length" yaml:"max_length"`
+}
+
+// Tracing exporters.
+const (
+	TracingExporterNone = "none"
+	TracingExporterOTLP = "otlp"
+)
+
+type TracingConfig struct {
+	// Exporter is none, the default, or otlp to send spans over OTLP/HTTP.
+	Exporter    string  `json:"exporter" yaml:"exporter"`
+	Endpoint    string  `json:"endpoint" yaml:"endpoint"`
+	Insecure    bool    `json:"insecure" yaml:"insecure"`
+	ServiceName string  `json:"service_name" yaml:"service_name"`
+	SampleRatio float64 `json:"sample_ratio" yaml:"sample_ratio"`
+}
+
+// Default returns the configuration used for every field that is not set.
+func Default() Config {
+	return Config{
+		Server: ServerConfig{Port: 8080},
+		Redis: RedisConfig{
+			Address: "localhost",
+			Port:    6379,
+		},
+		Kafka: KafkaConfig{
+			Brokers: []string{"localhost:9092"},
+			GroupID: "verve-group",
+		},
+		Callback: CallbackConfig{
+			Workers:        64,
+			QueueSize:      10000,
+			Overflow:       "drop",
+			AllowedSchemes: []string{"http", "https"},
+			AllowedPorts:   []int{80, 443},
+		},
+		Id: IdConfig{
+			Format:    "int64",
+			MaxLength: 64,
+		},
+		Degraded: DegradedConfig{
+			MaxIds: 100000,
+		},
+		RateLimit: RateLimitConfig{
+			Key:            "ip",
+			TrustedProxies: 1,
+			Rate:           50,
+			Burst:          100,
+			AcceptRate:     500,
+			AcceptBurst:    1000,
+			IdRate:         5,
+			IdBurst:        10,
+		},
+		Log: LogConfig{
+			Format:            LogFormatText,
+			Level:             "info",
+			RequestSampleRate: 1,
+			Sinks:             []string{LogSinkStdout},
+			File: LogFileConfig{
+				Path:       "logs/verve.log",
+				MaxSizeMB:  100,
+				MaxAgeDays: 7,
+				MaxBackups: 5,
+			},
+			Syslog: LogSyslogConfig{Tag: "verve"},
+		},
+		Tracing: TracingConfig{
+			Exporter:    TracingExporterNone,
+			Endpoint:    "localhost:4318",
+			ServiceName: "verve",
+			SampleRatio: 1,
+		},
+	}
+}
+
+// Redacted returns a copy whose secrets are masked, for printing.
+func (c Config) Redacted() Config {
+	if c.Redis.Password != "" {
+		c.Redis.Password = redactedValue
+	}
+	if c.Callback.SigningKeys != "" {
+		c.Callback.SigningKeys = redactedValue
+	}
+	if c.Auth.AdminKeys != "" {
+		c.Auth.AdminKeys = redactedValue
+	}
+	return c
+}
+
+// Write prints the configuration as YAML, with its secrets redacted.
+func (c Config) Write(w io.Writer) error {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(c.Redacted()); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// FieldError is an invalid configuration field.
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+// ValidationError lists every invalid field of a configuration.
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, 0, len(e.Errors)+1)
+	lines = append(lines, "invalid configuration:")
+	for _, fieldErr := range e.Errors {
+		lines = append(lines, fmt.Sprintf("  %s: %s", fieldErr.Field, fieldErr.Message))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (e *ValidationError) add(field, format string, args ...interface{}) {
+	e.Errors = append(e.Errors, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
@@ -0,0 +1,426 @@
+package appconfig
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"Verve/internal/model/request"
+	"Verve/internal/worker"
+	"Verve/pkg/signature"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFileEnv names the configuration file when the --config flag is not given.
+const ConfigFileEnv = "CONFIG_FILE"
+
+// Options are the flags that control loading rather than the configuration itself.
+type Options struct {
+	ConfigFile  string
+	PrintConfig bool
+}
+
+// field binds a configuration field to its environment variable and flag; the
+// flag is named after the dotted key.
+type field struct {
+	key   string
+	env   string
+	usage string
+	set   func(c *Config, value string) error
+}
+
+var fields = []field{
+	{"server.port", "PORT", "http listen port", setInt(func(c *Config) *int { return &c.Server.Port })},
+	{"redis.address", "DB_ADDRESS", "redis host", setString(func(c *Config) *string { return &c.Redis.Address })},
+	{"redis.port", "DB_PORT", "redis port", setInt(func(c *Config) *int { return &c.Redis.Port })},
+	{"redis.password", "DB_PASSWORD", "redis password", setString(func(c *Config) *string { return &c.Redis.Password })},
+	{"redis.database", "DB_DATABASE", "redis database number", setInt(func(c *Config) *int { return &c.Redis.Database })},
+	{"kafka.brokers", "event_broker", "comma separated kafka brokers", setList(func(c *Config) *[]string { return &c.Kafka.Brokers })},
+	{"kafka.group_id", "event_group", "kafka consumer group", setString(func(c *Config) *string { return &c.Kafka.GroupID })},
+	{"callback.workers", "CALLBACK_WORKERS", "callback worker count", setInt(func(c *Config) *int { return &c.Callback.Workers })},
+	{"callback.queue_size", "CALLBACK_QUEUE_SIZE", "callback queue size", setInt(func(c *Config) *int { return &c.Callback.QueueSize })},
+	{"callback.overflow", "CALLBACK_OVERFLOW", "callback queue overflow policy, drop or reject", setString(func(c *Config) *string { return &c.Callback.Overflow })},
+	{"callback.allowed_schemes", "CALLBACK_ALLOWED_SCHEMES", "comma separated callback url schemes", setList(func(c *Config) *[]string { return &c.Callback.AllowedSchemes })},
+	{"callback.allowed_hosts", "CALLBACK_ALLOWED_HOSTS", "comma separated callback hosts, any host when empty", setList(func(c *Config) *[]string { return &c.Callback.AllowedHosts })},
+	{"callback.denied_hosts", "CALLBACK_DENIED_HOSTS", "comma separated denied callback hosts", setList(func(c *Config) *[]string { return &c.Callback.DeniedHosts })},
+	{"callback.allowed_ports", "CALLBACK_ALLOWED_PORTS", "comma separated callback ports", setPorts(func(c *Config) *[]int { return &c.Callback.AllowedPorts })},
+	{"callback.allow_private", "CALLBACK_ALLOW_PRIVATE", "allow callbacks to private addresses", setBool(func(c *Config) *bool { return &c.Callback.AllowPrivate })},
+	{"callback.signing_keys", "CALLBACK_SIGNING_KEYS", "comma separated id:secret callback signing keys", setString(func(c *Config) *string { return &c.Callback.SigningKeys })},
+	{"id.format", "ID_FORMAT", "id format, int64, uuid or free", setString(func(c *Config) *string { return &c.Id.Format })},
+	{"id.max_length", "ID_MAX_LENGTH", "maximum id length", setInt(func(c *Config) *int { return &c.Id.MaxLength })},
+	{"tracing.exporter", "TRACING_EXPORTER", "span exporter, none or otlp", setString(func(c *Config) *string { return &c.Tracing.Exporter })},
+	{"tracing.endpoint", "OTEL_EXPORTER_OTLP_ENDPOINT", "OTLP/HTTP collector host:port", setString(func(c *Config) *string { return &c.Tracing.Endpoint })},
+	{"tracing.insecure", "TRACING_INSECURE", "send spans over plain http", setBool(func(c *Config) *bool { return &c.Tracing.Insecure })},
+	{"tracing.service_name", "OTEL_SERVICE_NAME", "service name of the spans", setString(func(c *Config) *string { return &c.Tracing.ServiceName })},
+	{"tracing.sample_ratio", "TRACING_SAMPLE_RATIO", "fraction of traces sampled, between 0 and 1", setFloat(func(c *Config) *float64 { return &c.Tracing.SampleRatio })},
+	{"degraded.enabled", "DEGRADED_MODE", "accept ids locally while redis is down", setBool(func(c *Config) *bool { return &c.Degraded.Enabled })},
+	{"degraded.max_ids", "DEGRADED_MAX_IDS", "maximum ids kept locally in degraded mode", setInt(func(c *Config) *int { return &c.Degraded.MaxIds })},
+	{"rate_limit.enabled", "RATE_LIMIT_ENABLED", "limit the request rate of clients", setBool(func(c *Config) *bool { return &c.RateLimit.Enabled })},
+	{"rate_limit.key", "RATE_LIMIT_KEY", "client identity, ip, api_key or namespace", setString(func(c *Config) *string { return &c.RateLimit.Key })},
+	{"rate_limit.trust_forwarded", "RATE_LIMIT_TRUST_FORWARDED", "read the client ip from X-Forwarded-For", setBool(func(c *Config) *bool { return &c.RateLimit.TrustForwarded })},
+	{"rate_limit.trusted_proxies", "RATE_LIMIT_TRUSTED_PROXIES", "number of proxies appending to X-Forwarded-For", setInt(func(c *Config) *int { return &c.RateLimit.TrustedProxies })},
+	{"rate_limit.rate", "RATE_LIMIT_RATE", "requests per second of a client on every route", setFloat(func(c *Config) *float64 { return &c.RateLimit.Rate })},
+	{"rate_limit.burst", "RATE_LIMIT_BURST", "burst of a client on every route", setInt(func(c *Config) *int { return &c.RateLimit.Burst })},
+	{"rate_limit.accept_rate", "RATE_LIMIT_ACCEPT_RATE", "requests per second of a client on the accept endpoint", setFloat(func(c *Config) *float64 { return &c.RateLimit.AcceptRate })},
+	{"rate_limit.accept_burst", "RATE_LIMIT_ACCEPT_BURST", "burst of a client on the accept endpoint", setInt(func(c *Config) *int { return &c.RateLimit.AcceptBurst })},
+	{"rate_limit.id_rate", "RATE_LIMIT_ID_RATE", "requests per second of an id on the accept endpoint", setFloat(func(c *Config) *float64 { return &c.RateLimit.IdRate })},
+	{"rate_limit.id_burst", "RATE_LIMIT_ID_BURST", "burst of an id on the accept endpoint", setInt(func(c *Config) *int { return &c.RateLimit.IdBurst })},
+	{"auth.enabled", "AUTH_ENABLED", "require an api key on the api routes", setBool(func(c *Config) *bool { return &c.Auth.Enabled })},
+	{"auth.admin_keys", "AUTH_ADMIN_KEYS", "comma separated api keys with the admin scope", setString(func(c *Config) *string { return &c.Auth.AdminKeys })},
+	{"log.format", "LOG_FORMAT", "log format, text or json", setString(func(c *Config) *string { return &c.Log.Format })},
+	{"log.level", "LOG_LEVEL", "log level, debug, info, warn or error", setString(func(c *Config) *string { return &c.Log.Level })},
+	{"log.request_sample_rate", "LOG_REQUEST_SAMPLE_RATE", "fraction of successful requests logged, between 0 and 1", setFloat(func(c *Config) *float64 { return &c.Log.RequestSampleRate })},
+	{"log.sinks", "LOG_SINKS", "comma separated log sinks, stdout, file or syslog", setList(func(c *Config) *[]string { return &c.Log.Sinks })},
+	{"log.file.path", "LOG_FILE_PATH", "path of the log file", setString(func(c *Config) *string { return &c.Log.File.Path })},
+	{"log.file.max_size_mb", "LOG_FILE_MAX_SIZE_MB", "size in megabytes at which the log files are rotated", setInt(func(c *Config) *int { return &c.Log.File.MaxSizeMB })},
+	{"log.file.max_age_days", "LOG_FILE_MAX_AGE_DAYS", "days the rotated log files are kept", setInt(func(c *Config) *int { return &c.Log.File.MaxAgeDays })},
+	{"log.file.max_backups", "LOG_FILE_MAX_BACKUPS", "number of rotated log files kept", setInt(func(c *Config) *int { return &c.Log.File.MaxBackups })},
+	{"log.syslog.network", "LOG_SYSLOG_NETWORK", "syslog network, udp or tcp, the local daemon when empty", setString(func(c *Config) *string { return &c.Log.Syslog.Network })},
+	{"log.syslog.address", "LOG_SYSLOG_ADDRESS", "syslog host:port", setString(func(c *Config) *string { return &c.Log.Syslog.Address })},
+	{"log.syslog.tag", "LOG_SYSLOG_TAG", "syslog tag", setString(func(c *Config) *string { return &c.Log.Syslog.Tag })},
+	{"log.count_file", "LOG_COUNT_FILE", "file of the per-minute unique count logs, the log sinks when empty", setString(func(c *Config) *string { return &c.Log.CountFile })},
+}
+
+// Load builds the configuration from the defaults, the file named by --config or
+// CONFIG_FILE, the non-empty environment variables (including a .env file) and
+// the command line flags, then validates it. Every invalid field is reported in a *ValidationError.
+func Load(args []string) (Config, Options, error) {
+	_ = godotenv.Load()
+	return load(args, os.LookupEnv, os.Stderr)
+}
+
+func load(args []string, lookupEnv func(string) (string, bool), output io.Writer) (Config, Options, error) {
+	var options Options
+	flagValues := make(map[string]string)
+
+	flags := flag.NewFlagSet("verve", flag.ContinueOnError)
+	flags.SetOutput(output)
+	flags.StringVar(&options.ConfigFile, "config", "", "path to a YAML or JSON configuration file")
+	flags.BoolVar(&options.PrintConfig, "print-config", false, "print the configuration with secrets redacted and exit")
+	for _, f := range fields {
+		key := f.key
+		flags.Func(key, fmt.Sprintf("%s (env %s)", f.usage, f.env), func(value string) error {
+			flagValues[key] = value
+			return nil
+		})
+	}
+	if err := flags.Parse(args); err != nil {
+		return Config{}, options, err
+	}
+
+	config := Default()
+	if options.ConfigFile == "" {
+		options.ConfigFile, _ = lookupEnv(ConfigFileEnv)
+	}
+	if options.ConfigFile != "" {
+		if err := config.readFile(options.ConfigFile); err != nil {
+			return Config{}, options, err
+		}
+	}
+
+	invalid := &ValidationError{}
+	for _, f := range fields {
+		// Empty variables, as left by env.sample.env, keep the default.
+		if value, ok := lookupEnv(f.env); ok && value != "" {
+			if err := f.set(&config, value); err != nil {
+				invalid.add(f.key, "invalid %s value %q: %v", f.env, value, err)
+			}
+		}
+	}
+	for _, f := range fields {
+		if value, ok := flagValues[f.key]; ok {
+			if err := f.set(&config, value); err != nil {
+				invalid.add(f.key, "invalid --%s value %q: %v", f.key, value, err)
+			}
+		}
+	}
+
+	var validationErr *ValidationError
+	if err := config.Validate(); errors.As(err, &validationErr) {
+		invalid.Errors = append(invalid.Errors, validationErr.Errors...)
+	}
+	if len(invalid.Errors) > 0 {
+		return config, options, invalid
+	}
+	return config, options, nil
+}
+
+// readFile overlays the YAML or JSON file on the configuration, unknown keys are rejected.
+func (c *Config) readFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(c)
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		err = decoder.Decode(c)
+		if errors.Is(err, io.EOF) {
+			err = nil
+		}
+	default:
+		return fmt.Errorf("unsupported config file %q, expected .yaml, .yml or .json", path)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// Validate checks every field and reports all the invalid ones at once.
+func (c Config) Validate() error {
+	invalid := &ValidationError{}
+
+	if c.Server.Port <= 0 || c.Server.Port > 65535 {
+		invalid.add("server.port", "must be between 1 and 65535, got %d", c.Server.Port)
+	}
+
+	if c.Redis.Address == "" {
+		invalid.add("redis.address", "is required")
+	}
+	if c.Redis.Port <= 0 || c.Redis.Port > 65535 {
+		invalid.add("redis.port", "must be between 1 and 65535, got %d", c.Redis.Port)
+	}
+	if c.Redis.Database < 0 {
+		invalid.add("redis.database", "must not be negative, got %d", c.Redis.Database)
+	}
+
+	if len(c.Kafka.Brokers) == 0 {
+		invalid.add("kafka.brokers", "at least one broker is required")
+	}
+	if c.Kafka.GroupID == "" {
+		invalid.add("kafka.group_id", "is required")
+	}
+
+	if c.Callback.Workers <= 0 {
+		invalid.add("callback.workers", "must be positive, got %d", c.Callback.Workers)
+	}
+	if c.Callback.QueueSize < 0 {
+		invalid.add("callback.queue_size", "must not be negative, got %d", c.Callback.QueueSize)
+	}
+	switch worker.OverflowPolicy(c.Callback.Overflow) {
+	case worker.OverflowDrop, worker.OverflowReject:
+	default:
+		invalid.add("callback.overflow", "must be %s or %s, got %q", worker.OverflowDrop, worker.OverflowReject, c.Callback.Overflow)
+	}
+	for _, scheme := range c.Callback.AllowedSchemes {
+		if scheme != "http" && scheme != "https" {
+			invalid.add("callback.allowed_schemes", "must be http or https, got %q", scheme)
+		}
+	}
+	for _, port := range c.Callback.AllowedPorts {
+		if port <= 0 || port > 65535 {
+			invalid.add("callback.allowed_ports", "must be between 1 and 65535, got %d", port)
+		}
+	}
+	if _, err := signature.ParseKeys(c.Callback.SigningKeys); err != nil {
+		// The keys are secret, only the parse error is reported.
+		invalid.add("callback.signing_keys", "%v", err)
+	}
+
+	if _, err := request.NewIdValidator(request.IdFormat(c.Id.Format), c.Id.MaxLength); err != nil {
+		invalid.add("id.format", "%v", err)
+	}
+	if c.Id.MaxLength <= 0 {
+		invalid.add("id.max_length", "must be positive, got %d", c.Id.MaxLength)
+	}
+
+	switch c.Tracing.Exporter {
+	case TracingExporterNone:
+	case TracingExporterOTLP:
+		if c.Tracing.Endpoint == "" {
+			invalid.add("tracing.endpoint", "is required with the otlp exporter")
+		}
+	default:
+		invalid.add("tracing.exporter", "must be %s or %s, got %q", TracingExporterNone, TracingExporterOTLP, c.Tracing.Exporter)
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		invalid.add("tracing.sample_ratio", "must be between 0 and 1, got %v", c.Tracing.SampleRatio)
+	}
+
+	if c.Degraded.MaxIds <= 0 {
+		invalid.add("degraded.max_ids", "must be positive, got %d", c.Degraded.MaxIds)
+	}
+
+	for _, key := range c.Auth.AdminKeyList() {
+		if len(key) < minAdminKeyLength {
+			// The keys are secret, only their length is reported.
+			invalid.add("auth.admin_keys", "every key must be at least %d characters, got one of %d", minAdminKeyLength, len(key))
+		}
+	}
+
+	if c.RateLimit.TrustForwarded && c.RateLimit.TrustedProxies < 1 {
+		invalid.add("rate_limit.trusted_proxies", "must be positive when forwarded addresses are trusted, got %d", c.RateLimit.TrustedProxies)
+	}
+	switch c.RateLimit.Key {
+	case "ip", "api_key", "namespace":
+	default:
+		invalid.add("rate_limit.key", "must be ip, api_key or namespace, got %q", c.RateLimit.Key)
+	}
+	for _, limit := range []struct {
+		rateKey, burstKey string
+		rate              float64
+		burst             int
+	}{
+		{"rate_limit.rate", "rate_limit.burst", c.RateLimit.Rate, c.RateLimit.Burst},
+		{"rate_limit.accept_rate", "rate_limit.accept_burst", c.RateLimit.AcceptRate, c.RateLimit.AcceptBurst},
+		{"rate_limit.id_rate", "rate_limit.id_burst", c.RateLimit.IdRate, c.RateLimit.IdBurst},
+	} {
+		if limit.rate < 0 {
+			invalid.add(limit.rateKey, "must not be negative, got %v", limit.rate)
+		}
+		if limit.rate > 0 && limit.burst <= 0 {
+			invalid.add(limit.burstKey, "must be positive when the rate is set, got %d", limit.burst)
+		}
+	}
+
+	switch c.Log.Format {
+	case LogFormatText, LogFormatJSON:
+	default:
+		invalid.add("log.format", "must be %s or %s, got %q", LogFormatText, LogFormatJSON, c.Log.Format)
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		invalid.add("log.level", "must be debug, info, warn or error, got %q", c.Log.Level)
+	}
+	if c.Log.RequestSampleRate < 0 || c.Log.RequestSampleRate > 1 {
+		invalid.add("log.request_sample_rate", "must be between 0 and 1, got %v", c.Log.RequestSampleRate)
+	}
+	if len(c.Log.Sinks) == 0 {
+		invalid.add("log.sinks", "must not be empty")
+	}
+	for _, sink := range c.Log.Sinks {
+		switch sink {
+		case LogSinkStdout, LogSinkSyslog:
+		case LogSinkFile:
+			if c.Log.File.Path == "" {
+				invalid.add("log.file.path", "must be set with the file sink")
+			}
+		default:
+			invalid.add("log.sinks", "must be %s, %s or %s, got %q", LogSinkStdout, LogSinkFile, LogSinkSyslog, sink)
+		}
+	}
+	if c.Log.CountFile != "" && slices.Contains(c.Log.Sinks, LogSinkFile) && filepath.Clean(c.Log.CountFile) == filepath.Clean(c.Log.File.Path) {
+		invalid.add("log.count_file", "must differ from log.file.path, got %q", c.Log.CountFile)
+	}
+	for _, limit := range []struct {
+		key   string
+		value int
+	}{
+		{"log.file.max_size_mb", c.Log.File.MaxSizeMB},
+		{"log.file.max_age_days", c.Log.File.MaxAgeDays},
+		{"log.file.max_backups", c.Log.File.MaxBackups},
+	} {
+		if limit.value < 0 {
+			invalid.add(limit.key, "must not be negative, got %d", limit.value)
+		}
+	}
+	switch c.Log.Syslog.Network {
+	case "":
+	case "udp", "tcp":
+		if c.Log.Syslog.Address == "" {
+			invalid.add("log.syslog.address", "must be set with a syslog network")
+		}
+	default:
+		invalid.add("log.syslog.network", "must be udp or tcp, got %q", c.Log.Syslog.Network)
+	}
+
+	if len(invalid.Errors) > 0 {
+		return invalid
+	}
+	return nil
+}
+
+func setString(target func(c *Config) *string) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		*target(c) = value
+		return nil
+	}
+}
+
+func setInt(target func(c *Config) *int) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		num, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return errors.New("not an integer")
+		}
+		*target(c) = num
+		return nil
+	}
+}
+
+func setFloat(target func(c *Config) *float64) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		num, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return errors.New("not a number")
+		}
+		*target(c) = num
+		return nil
+	}
+}
+
+func setBool(target func(c *Config) *bool) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		if strings.TrimSpace(value) == "" {
+			*target(c) = false
+			return nil
+		}
+		b, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return errors.New("not a boolean")
+		}
+		*target(c) = b
+		return nil
+	}
+}
+
+func setList(target func(c *Config) *[]string) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		*target(c) = splitList(value)
+		return nil
+	}
+}
+
+func setPorts(target func(c *Config) *[]int) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		ports := make([]int, 0)
+		for _, item := range splitList(value) {
+			num, err := strconv.Atoi(item)
+			if err != nil {
+				return fmt.Errorf("port %q is not an integer", item)
+			}
+			ports = append(ports, num)
+		}
+		*target(c) = ports
+		return nil
+	}
+}
+
+// splitList splits a comma separated list, dropping empty items.
+func splitList(value string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,119 @@
+package appconfig
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func envOf(values map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		value, ok := values[key]
+		return value, ok
+	}
+}
+
+func TestLoadDefaults(t *testing.T) {
+	config, options, err := load(nil, envOf(nil), io.Discard)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(config, Default()) {
+		t.Errorf("config = %+v, want the defaults", config)
+	}
+	if options.PrintConfig {
+		t.Error("print-config must be off by default")
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "verve.yaml")
+	file := "server:\n  port: 9000\nredis:\n  address: redis.internal\n  database: 2\n"
+	if err := os.WriteFile(path, []byte(file), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	env := envOf(map[string]string{
+		"DB_DATABASE":            "3",
+		"event_broker":           "k1:9092, k2:9092",
+		"CALLBACK_ALLOWED_HOSTS": "",
+	})
+	config, _, err := load([]string{"--config", path, "--server.port", "9100"}, env, io.Discard)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if config.Server.Port != 9100 {
+		t.Errorf("flags must win over the file, port = %d", config.Server.Port)
+	}
+	if config.Redis.Address != "redis.internal" {
+		t.Errorf("file value lost, address = %q", config.Redis.Address)
+	}
+	if config.Redis.Database != 3 {
+		t.Errorf("env must win over the file, database = %d", config.Redis.Database)
+	}
+	if !reflect.DeepEqual(config.Kafka.Brokers, []string{"k1:9092", "k2:9092"}) {
+		t.Errorf("brokers = %v", config.Kafka.Brokers)
+	}
+}
+
+func TestLoadReportsEveryInvalidField(t *testing.T) {
+	env := envOf(map[string]string{
+		"PORT":              "http",
+		"CALLBACK_WORKERS":  "0",
+		"CALLBACK_OVERFLOW": "block",
+		"ID_FORMAT":         "email",
+		"LOG_LEVEL":         "verbose",
+		"LOG_SINKS":         "stdout,kafka,file",
+		"LOG_FILE_PATH":     "logs/verve.log",
+		"LOG_COUNT_FILE":    "logs/./verve.log",
+	})
+	_, _, err := load([]string{"--redis.port", "70000"}, env, io.Discard)
+
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected a *ValidationError, got %v", err)
+	}
+	fields := make([]string, 0, len(validationErr.Errors))
+	for _, fieldErr := range validationErr.Errors {
+		fields = append(fields, fieldErr.Field)
+	}
+	for _, want := range []string{"server.port", "redis.port", "callback.workers", "callback.overflow", "id.format", "log.level", "log.sinks", "log.count_file"} {
+		if !strings.Contains(strings.Join(fields, ","), want) {
+			t.Errorf("missing error for %s in %v", want, fields)
+		}
+	}
+}
+
+func TestLoadRejectsUnknownFileKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "verve.json")
+	if err := os.WriteFile(path, []byte(`{"server":{"prot":9000}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := load([]string{"--config", path}, envOf(nil), io.Discard); err == nil {
+		t.Error("expected an error for an unknown key")
+	}
+}
+
+func TestWriteRedactsSecrets(t *testing.T) {
+	config := Default()
+	config.Redis.Password = "hunter2"
+	config.Callback.SigningKeys = "k1:shared-secret"
+
+	var out bytes.Buffer
+	if err := config.Write(&out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	printed := out.String()
+	if strings.Contains(printed, "hunter2") || strings.Contains(printed, "shared-secret") {
+		t.Errorf("secrets leaked:\n%s", printed)
+	}
+	if !strings.Contains(printed, redactedValue) {
+		t.Errorf("expected redacted values:\n%s", printed)
+	}
+}
@@ -1,51 +1,370 @@
 package appcontext
 
 import (
+	"Verve/internal/auth"
+	appconfig "Verve/internal/configs/appConfig"
 	"Verve/internal/configs/logger"
 	restclient "Verve/internal/configs/restClient"
+	urlpolicy "Verve/internal/configs/urlPolicy"
 	"Verve/internal/database"
 	"Verve/internal/event"
+	"Verve/internal/health"
+	"Verve/internal/lifecycle"
+	"Verve/internal/metrics"
+	"Verve/internal/model/request"
+	"Verve/internal/ratelimit"
 	"Verve/internal/repository"
 	"Verve/internal/service"
+	"Verve/internal/tracing"
+	"Verve/internal/worker"
+	"Verve/pkg/signature"
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
 )
 
+// AppContext is the composition root: it holds the dependency graph of one
+// instance of the application and the lifecycle of its subsystems.
 type AppContext struct {
-	Logger          *slog.Logger
+	Config appconfig.Config
+	Logger *slog.Logger
+	// LogLevel is the level of Logger, it can be changed at runtime.
+	LogLevel *slog.LevelVar
+	Database database.Service
+	// IdValidator normalizes the accepted ids, UrlPolicy guards the callback urls.
+	IdValidator     request.IdValidator
+	UrlPolicy       *urlpolicy.Policy
 	VerveService    service.VerveService
 	VerveRepository repository.VerveRepository
+	CallbackService service.CallbackService
+	WebhookService  service.WebhookService
+	APIKeyService   service.APIKeyService
+	AdminService    service.AdminService
 	RestClient      restclient.RestClient
 	Event           event.Event
+	// Publisher is Event, it lets operators pause the publishing of messages.
+	Publisher  *event.PausableEvent
+	WorkerPool worker.Pool
+	// LocalBucket holds the ids accepted in degraded mode, nil when it is disabled.
+	LocalBucket *service.LocalBucket
+	// RateLimiter is shared by the rate limit policies and the api key quotas.
+	RateLimiter ratelimit.Limiter
+	// Auth authenticates the api routes, AdminAuth the admin routes.
+	Auth      *auth.Authenticator
+	AdminAuth *auth.Authenticator
+	Health    *health.Checker
+	Lifecycle *lifecycle.Manager
+	// Metrics is served on /metrics, its gauges sample this instance.
+	Metrics *prometheus.Registry
+
+	shutdownTracing func(ctx context.Context) error
+	closeLogSinks   func(ctx context.Context) error
+	mu              sync.Mutex
+	cancel          context.CancelFunc
+	tasks           sync.WaitGroup
 }
 
-var appContext *AppContext
+// New builds the dependency graph described by config on top of db. Nothing is
+// started until Start is called.
+func New(config appconfig.Config, db database.Service) (*AppContext, error) {
+	policy := urlpolicy.New(
+		config.Callback.AllowedSchemes,
+		config.Callback.AllowedHosts,
+		config.Callback.DeniedHosts,
+		config.Callback.AllowedPorts,
+		config.Callback.AllowPrivate,
+	)
+	idValidator, err := request.NewIdValidator(request.IdFormat(config.Id.Format), config.Id.MaxLength)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id config: %w", err)
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), config.Tracing)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up tracing: %w", err)
+	}
+
+	logLevel := new(slog.LevelVar)
+	logLevel.Set(config.Log.SlogLevel())
+	appLogger, closeLogSinks, err := logger.InitLogger(config.Log, logLevel)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up logging: %w", err)
+	}
+	appContext := &AppContext{
+		Config:          config,
+		Logger:          appLogger,
+		LogLevel:        logLevel,
+		Database:        db,
+		IdValidator:     idValidator,
+		UrlPolicy:       policy,
+		RestClient:      restclient.NewRestClientWithPolicy(policy),
+		shutdownTracing: shutdownTracing,
+		closeLogSinks:   closeLogSinks,
+	}
+
+	kafkaEvent, err := event.NewKafkaEvent(event.KafkaConfig{
+		Brokers: config.Kafka.Brokers,
+		GroupID: config.Kafka.GroupID,
+	}, appContext.Logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kafka event: %w", err)
+	}
+	appContext.Publisher = event.NewPausableEvent(kafkaEvent, event.DefaultMaxHeld)
+	appContext.Event = appContext.Publisher
 
-func LoadAppContext(db database.Service) {
-	if appContext == nil {
-		appContext = &AppContext{}
+	pool, err := worker.NewPool(worker.Config{
+		Concurrency: config.Callback.Workers,
+		QueueSize:   config.Callback.QueueSize,
+		Overflow:    worker.OverflowPolicy(config.Callback.Overflow),
+	}, appContext.Logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create worker pool: %w", err)
 	}
-	appContext.Logger = logger.InitLogger("text")
-	appContext.RestClient = restclient.NewRestClient()
-	event, err := event.NewKafkaEvent(appContext.Logger)
-	appContext.Event = event
+	appContext.WorkerPool = pool
+
+	signer, err := loadSigner(config.Callback.SigningKeys, appContext.Logger)
 	if err != nil {
-		appContext.Logger.Error("Failed to create kafka event", "error", err.Error())
-		errs := fmt.Errorf("failed to create kafka event in load app context %w", err)
-		panic(errs)
+		return nil, fmt.Errorf("invalid callback signing keys: %w", err)
 	}
+
 	appContext.VerveRepository = repository.NewImplVerveRepository(db)
-	appContext.VerveService = service.NewImplVerveService(appContext.VerveRepository, appContext.RestClient, appContext.Logger, appContext.Event)
+	webhookRepository := repository.NewImplWebhookRepository(db)
+	appContext.CallbackService = service.NewImplCallbackService(repository.NewImplCallbackRepository(db), webhookRepository, appContext.RestClient, appContext.Logger, appContext.WorkerPool, signer)
+	appContext.WebhookService = service.NewImplWebhookService(webhookRepository, appContext.CallbackService, appContext.Logger)
+	if config.Degraded.Enabled {
+		appContext.LocalBucket = service.NewLocalBucket(config.Degraded.MaxIds)
+	}
+	appContext.VerveService = service.NewImplVerveService(appContext.VerveRepository, appContext.CallbackService, appContext.WebhookService, appContext.Logger, appContext.Event, appContext.LocalBucket)
 
-	initBackgroundTasks()
+	appContext.AdminService = service.NewImplAdminService(appContext.VerveService, appContext.VerveRepository, appContext.Publisher, appContext.LocalBucket, appContext.LogLevel, appContext.Logger)
+
+	appContext.RateLimiter = ratelimit.NewFallbackLimiter(ratelimit.NewRedisLimiter(db), ratelimit.NewLocalLimiter(), appContext.Logger)
+
+	appContext.APIKeyService = service.NewImplAPIKeyService(repository.NewImplAPIKeyRepository(db), appContext.Logger)
+	adminKeys := make([]string, 0)
+	for _, key := range config.Auth.AdminKeyList() {
+		adminKeys = append(adminKeys, service.HashAPIKey(key))
+	}
+	appContext.Auth = auth.New(appContext.APIKeyService, adminKeys, config.Auth.Enabled, appContext.Logger)
+	appContext.AdminAuth = auth.New(appContext.APIKeyService, adminKeys, true, appContext.Logger)
+
+	appContext.registerMetrics()
+	appContext.Health = health.NewChecker(health.DefaultCacheTTL, health.DefaultTimeout, appContext.healthChecks()...)
+
+	appContext.Lifecycle = lifecycle.New(appContext.Logger)
+	appContext.registerHooks()
+
+	return appContext, nil
+}
+
+// registerHooks registers the subsystems in dependency order, they are stopped in
+// reverse: background tasks first, then the callback workers, Kafka, Redis, the
+// tracer provider, so spans of the shutdown itself are exported, and finally the
+// log sinks.
+func (a *AppContext) registerHooks() {
+	a.Lifecycle.Append(lifecycle.Hook{
+		Name: "log sinks",
+		Stop: a.closeLogSinks,
+	})
+	a.Lifecycle.Append(lifecycle.Hook{
+		Name: "tracing",
+		Stop: a.shutdownTracing,
+	})
+	a.Lifecycle.Append(lifecycle.Hook{
+		Name: "redis",
+		Stop: func(ctx context.Context) error { return a.Database.Close() },
+	})
+	a.Lifecycle.Append(lifecycle.Hook{
+		Name: "kafka",
+		// Messages held by a paused publisher are only kept in memory, they are
+		// published before the producer is closed and the hook fails when they cannot be.
+		Stop: a.Publisher.Shutdown,
+	})
+	a.Lifecycle.Append(lifecycle.Hook{
+		Name:    "callback workers",
+		Stop:    a.WorkerPool.Shutdown,
+		Timeout: 30 * time.Second,
+	})
+	a.Lifecycle.Append(lifecycle.Hook{
+		Name: "background tasks",
+		// The tasks outlive the start context, they run until the hook is stopped.
+		Start:   func(ctx context.Context) error { return a.StartTasks(context.Background()) },
+		Stop:    a.StopTasks,
+		Timeout: 30 * time.Second,
+	})
 }
 
-func initBackgroundTasks() {
-	go appContext.VerveService.LogUniqueCountEveryMinute(context.Background())
-	go appContext.VerveService.SendUniqueCountEveryMinute(context.Background())
+// backlogHighWatermark is the share of the callback queue above which the
+// instance reports itself degraded.
+const backlogHighWatermark = 0.9
+
+// healthChecks returns the dependency checks of /readyz. Only Redis is critical:
+// without Kafka the counts are still served and the callbacks still delivered.
+// In degraded mode Redis is not critical either; the instance stays ready until
+// its local bucket is full.
+func (a *AppContext) healthChecks() []health.Check {
+	checks := []health.Check{
+		{Name: "redis", Critical: a.LocalBucket == nil, Run: a.checkRedis},
+		{Name: "kafka", Run: a.Event.Ping},
+		{Name: "callback_backlog", Run: a.checkBacklog},
+	}
+	if a.LocalBucket != nil {
+		checks = append(checks,
+			health.Check{Name: "degraded_mode", Run: a.checkDegradedMode},
+			health.Check{Name: "local_bucket", Critical: true, Run: a.checkLocalBucket},
+		)
+	}
+	return checks
+}
+
+func (a *AppContext) checkRedis(ctx context.Context) error {
+	stats := a.Database.Health(ctx)
+	if stats["redis_status"] != "up" {
+		return errors.New(stats["redis_message"])
+	}
+	return nil
+}
+
+func (a *AppContext) checkDegradedMode(ctx context.Context) error {
+	state := a.LocalBucket.State()
+	if !state.Degraded {
+		return nil
+	}
+	return fmt.Errorf("degraded since %s, %d ids and %d urls waiting for reconciliation, counts are approximate",
+		state.Since.Format(time.RFC3339), state.Ids, state.Urls)
 }
 
-func GetAppContext() *AppContext {
-	return appContext
+func (a *AppContext) checkLocalBucket(ctx context.Context) error {
+	if a.LocalBucket.Full() {
+		return fmt.Errorf("local bucket is full: %w", service.ErrBucketFull)
+	}
+	return nil
+}
+
+func (a *AppContext) checkBacklog(ctx context.Context) error {
+	size := a.Config.Callback.QueueSize
+	if size == 0 {
+		return nil
+	}
+	depth := a.WorkerPool.QueueDepth()
+	if float64(depth) >= float64(size)*backlogHighWatermark {
+		return fmt.Errorf("callback queue holds %d of %d tasks", depth, size)
+	}
+	return nil
+}
+
+// metricsSampleTimeout bounds the Redis read behind the window gauge at scrape time.
+const metricsSampleTimeout = 2 * time.Second
+
+// registerMetrics builds the metrics registry whose gauges sample this instance.
+func (a *AppContext) registerMetrics() {
+	a.Metrics = metrics.NewRegistry(metrics.Sources{
+		WindowCount: func() float64 {
+			ctx, cancel := context.WithTimeout(context.Background(), metricsSampleTimeout)
+			defer cancel()
+			count, err := a.VerveRepository.GetUniqueCount(ctx, service.WindowStart(time.Now()))
+			if err != nil {
+				return math.NaN()
+			}
+			return float64(count)
+		},
+		QueueDepth:   func() float64 { return float64(a.WorkerPool.QueueDepth()) },
+		DroppedTasks: func() float64 { return float64(a.WorkerPool.Dropped()) },
+	})
+}
+
+// loadSigner builds the callback signer from the signing keys, callbacks are
+// sent unsigned when no key is configured.
+func loadSigner(signingKeys string, logger *slog.Logger) (*signature.Signer, error) {
+	keys, err := signature.ParseKeys(signingKeys)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		logger.Warn("No callback signing keys configured, callbacks will be sent unsigned")
+		return nil, nil
+	}
+	return signature.NewSigner(keys...)
+}
+
+// Start starts every registered subsystem in order.
+func (a *AppContext) Start(ctx context.Context) error {
+	return a.Lifecycle.Start(ctx)
+}
+
+// Stop stops the started subsystems in reverse order and reports every failure.
+func (a *AppContext) Stop(ctx context.Context) error {
+	return a.Lifecycle.Stop(ctx)
+}
+
+// StartTasks launches the background tasks. They run until StopTasks is called or ctx is done.
+func (a *AppContext) StartTasks(ctx context.Context) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.cancel != nil {
+		return errors.New("background tasks already started")
+	}
+
+	ctx, a.cancel = context.WithCancel(ctx)
+	a.run(ctx, a.VerveService.LogUniqueCountEveryMinute)
+	a.run(ctx, a.VerveService.SendUniqueCountEveryMinute)
+	a.run(ctx, a.CallbackService.RunDeliveryLoop)
+	if a.LocalBucket != nil {
+		a.run(ctx, a.VerveService.RunReconcileLoop)
+	}
+	return nil
+}
+
+func (a *AppContext) run(ctx context.Context, task func(ctx context.Context)) {
+	a.tasks.Add(1)
+	go func() {
+		defer a.tasks.Done()
+		task(ctx)
+	}()
+}
+
+// StopTasks stops the background tasks, waiting at most until ctx expires, then
+// reconciles the degraded mode bucket and flushes the last closed window in case
+// its timer had not fired yet. The flush is a no-op when the window was already
+// finalized.
+func (a *AppContext) StopTasks(ctx context.Context) error {
+	a.mu.Lock()
+	cancel := a.cancel
+	a.cancel = nil
+	a.mu.Unlock()
+
+	if cancel == nil {
+		return nil
+	}
+
+	cancel()
+	stopped := make(chan struct{})
+	go func() {
+		a.tasks.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		return fmt.Errorf("background tasks did not stop: %w", ctx.Err())
+	}
+
+	// The bucket lives in memory only, this is its last chance to reach Redis.
+	if a.LocalBucket != nil {
+		if err := a.VerveService.Reconcile(ctx); err != nil {
+			a.Logger.Error("Degraded mode ids are lost", "ids", a.LocalBucket.State().Ids, "error", err)
+		}
+	}
+
+	window := service.WindowStart(time.Now()).Add(-time.Minute)
+	if err := a.VerveService.FlushWindow(ctx, window); err != nil {
+		return fmt.Errorf("failed to flush the last window: %w", err)
+	}
+	return nil
 }
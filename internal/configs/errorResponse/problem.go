@@ -0,0 +1,92 @@
+package errorResponse
+
+import (
+	"Verve/internal/requestid"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// ProblemContentType is the media type of RFC 7807 problem details.
+const ProblemContentType = "application/problem+json"
+
+// Error codes carried by problem details and the legacy ErrorCodeHeader.
+const (
+	CodeBadRequest   = "bad_request"
+	CodeValidation   = "validation_failed"
+	CodeUnauthorized = "unauthorized"
+	CodeForbidden    = "forbidden"
+	CodeNotFound     = "not_found"
+	CodeRateLimited  = "rate_limited"
+	CodeUnavailable  = "backend_unavailable"
+	CodeQueueFull    = "callback_queue_full"
+	CodeInternal     = "internal_error"
+)
+
+var (
+	// ErrUnavailable marks a failure of a backend the request depends on.
+	ErrUnavailable = errors.New("backend unavailable")
+	// ErrRateLimited marks a request rejected by a rate limit.
+	ErrRateLimited = errors.New("rate limit exceeded")
+	// ErrUnauthorized marks a request without valid credentials.
+	ErrUnauthorized = errors.New("missing or invalid api key")
+	// ErrForbidden marks a request whose credentials do not allow it.
+	ErrForbidden = errors.New("forbidden")
+)
+
+// ProblemDetail describes one failed field of a request.
+type ProblemDetail struct {
+	Field   string `json:"field,omitempty"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Problem is an RFC 7807 problem details body extended with a machine readable
+// code, the request id and per field details.
+type Problem struct {
+	Type      string          `json:"type"`
+	Title     string          `json:"title"`
+	Status    int             `json:"status"`
+	Detail    string          `json:"detail,omitempty"`
+	Instance  string          `json:"instance,omitempty"`
+	Code      string          `json:"code"`
+	RequestId string          `json:"request_id,omitempty"`
+	Details   []ProblemDetail `json:"details,omitempty"`
+}
+
+// NewProblem creates a problem with the standard title of the status.
+func NewProblem(status int, code, detail string) Problem {
+	return Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// SendProblem writes the problem as application/problem+json, filling in the
+// request path and id.
+func SendProblem(w http.ResponseWriter, r *http.Request, problem Problem) {
+	if problem.Instance == "" {
+		problem.Instance = r.URL.Path
+	}
+	if problem.RequestId == "" {
+		problem.RequestId = requestid.FromContext(r.Context())
+	}
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(problem.Status)
+	json.NewEncoder(w).Encode(problem)
+}
+
+// WantsJSON reports whether the client asked for a JSON response in its Accept header.
+func WantsJSON(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType := strings.TrimSpace(strings.SplitN(part, ";", 2)[0])
+		if mediaType == "application/json" || mediaType == ProblemContentType || strings.HasSuffix(mediaType, "+json") {
+			return true
+		}
+	}
+	return false
+}
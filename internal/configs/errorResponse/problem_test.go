@@ -0,0 +1,64 @@
+package errorResponse
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWantsJSON(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   bool
+	}{
+		{"", false},
+		{"*/*", false},
+		{"text/plain", false},
+		{"application/json", true},
+		{"text/html, application/json;q=0.9", true},
+		{"application/problem+json", true},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/api/verve/accept", nil)
+		r.Header.Set("Accept", tt.accept)
+		if got := WantsJSON(r); got != tt.want {
+			t.Errorf("WantsJSON(%q) = %v, want %v", tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestSendProblem(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/api/verve/webhooks/w1", nil)
+	w := httptest.NewRecorder()
+
+	SendProblem(w, r, NewProblem(http.StatusNotFound, CodeNotFound, "webhook subscription not found"))
+
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != ProblemContentType {
+		t.Errorf("Content-Type = %q, want %q", ct, ProblemContentType)
+	}
+	var problem Problem
+	if err := json.NewDecoder(w.Body).Decode(&problem); err != nil {
+		t.Fatalf("invalid problem body: %v", err)
+	}
+	if problem.Code != CodeNotFound || problem.Title != "Not Found" || problem.Instance != "/api/verve/webhooks/w1" {
+		t.Errorf("unexpected problem %+v", problem)
+	}
+}
+
+func TestSendResponseIsPlainText(t *testing.T) {
+	w := httptest.NewRecorder()
+
+	SendResponse(w, http.StatusOK, "ok")
+
+	if ct := w.Header().Get("Content-Type"); ct != PlainTextContentType {
+		t.Errorf("Content-Type = %q, want %q", ct, PlainTextContentType)
+	}
+	if w.Body.String() != "ok" {
+		t.Errorf("body = %q, want ok", w.Body.String())
+	}
+}
@@ -1,10 +1,24 @@
 package errorResponse
 
 import (
+	"encoding/json"
 	"net/http"
 )
 
+// ErrorCodeHeader carries the machine readable error code on plaintext responses.
+const ErrorCodeHeader = "X-Verve-Error"
+
+// PlainTextContentType is the content type of the plaintext responses.
+const PlainTextContentType = "text/plain; charset=utf-8"
+
 func SendResponse(w http.ResponseWriter, statusCode int, message string) {
+	w.Header().Set("Content-Type", PlainTextContentType)
 	w.WriteHeader(statusCode)
 	w.Write([]byte(message))
 }
+
+func SendJSONResponse(w http.ResponseWriter, statusCode int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(body)
+}
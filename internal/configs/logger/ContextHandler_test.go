@@ -0,0 +1,29 @@
+package logger
+
+import (
+	"Verve/internal/requestid"
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestContextHandlerAddsRequestId(t *testing.T) {
+	var out bytes.Buffer
+	logger := slog.New(ContextHandler{slog.NewJSONHandler(&out, nil)}).With("component", "test")
+
+	logger.InfoContext(requestid.WithID(context.Background(), "req-1"), "with id")
+	logger.Info("without id")
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d records, want 2", len(lines))
+	}
+	if !strings.Contains(lines[0], `"request_id":"req-1"`) {
+		t.Errorf("record %s misses the request id", lines[0])
+	}
+	if strings.Contains(lines[1], "request_id") {
+		t.Errorf("record %s has a request id", lines[1])
+	}
+}
@@ -0,0 +1,125 @@
+package logger
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+)
+
+// FanoutHandler sends every record to each of its handlers that is enabled for
+// its level, e.g. to stdout and to a file.
+type FanoutHandler []slog.Handler
+
+func (h FanoutHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, handler := range h {
+		if handler.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h FanoutHandler) Handle(ctx context.Context, record slog.Record) error {
+	var errs []error
+	for _, handler := range h {
+		if !handler.Enabled(ctx, record.Level) {
+			continue
+		}
+		// A handler may add attributes to the record, each one gets its own copy.
+		if err := handler.Handle(ctx, record.Clone()); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (h FanoutHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make(FanoutHandler, len(h))
+	for i, handler := range h {
+		handlers[i] = handler.WithAttrs(attrs)
+	}
+	return handlers
+}
+
+func (h FanoutHandler) WithGroup(name string) slog.Handler {
+	handlers := make(FanoutHandler, len(h))
+	for i, handler := range h {
+		handlers[i] = handler.WithGroup(name)
+	}
+	return handlers
+}
+
+// StreamKey is the attribute naming the stream of a record, see StreamHandler.
+const StreamKey = "stream"
+
+// StreamCounts is the stream of the per-minute unique count records.
+const StreamCounts = "counts"
+
+// Stream returns the attribute routing a record, or the records of a logger
+// created with With, to the sink of the stream.
+func Stream(name string) slog.Attr {
+	return slog.String(StreamKey, name)
+}
+
+// StreamHandler routes the records of a stream to the handler of the stream, and
+// every other record to the default handler. Records of a stream without a
+// handler go to the default handler.
+type StreamHandler struct {
+	Default slog.Handler
+	Streams map[string]slog.Handler
+}
+
+func (h StreamHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	if h.Default.Enabled(ctx, level) {
+		return true
+	}
+	for _, handler := range h.Streams {
+		if handler.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h StreamHandler) Handle(ctx context.Context, record slog.Record) error {
+	handler := h.Default
+	record.Attrs(func(attr slog.Attr) bool {
+		if attr.Key != StreamKey {
+			return true
+		}
+		if stream, ok := h.Streams[attr.Value.String()]; ok {
+			handler = stream
+		}
+		return false
+	})
+	if !handler.Enabled(ctx, record.Level) {
+		return nil
+	}
+	return handler.Handle(ctx, record)
+}
+
+// WithAttrs binds the logger to a stream when attrs name one, its records then
+// only reach the handler of the stream.
+func (h StreamHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	for _, attr := range attrs {
+		if attr.Key != StreamKey {
+			continue
+		}
+		if stream, ok := h.Streams[attr.Value.String()]; ok {
+			return stream.WithAttrs(attrs)
+		}
+	}
+	streams := make(map[string]slog.Handler, len(h.Streams))
+	for name, handler := range h.Streams {
+		streams[name] = handler.WithAttrs(attrs)
+	}
+	return StreamHandler{Default: h.Default.WithAttrs(attrs), Streams: streams}
+}
+
+func (h StreamHandler) WithGroup(name string) slog.Handler {
+	streams := make(map[string]slog.Handler, len(h.Streams))
+	for stream, handler := range h.Streams {
+		streams[stream] = handler.WithGroup(name)
+	}
+	return StreamHandler{Default: h.Default.WithGroup(name), Streams: streams}
+}
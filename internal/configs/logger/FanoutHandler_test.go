@@ -0,0 +1,49 @@
+package logger
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestFanoutHandlerWritesToEveryEnabledHandler(t *testing.T) {
+	var info, errs bytes.Buffer
+	logger := slog.New(FanoutHandler{
+		slog.NewTextHandler(&info, nil),
+		slog.NewTextHandler(&errs, &slog.HandlerOptions{Level: slog.LevelError}),
+	}).With("component", "test")
+
+	logger.Info("started")
+	logger.Error("failed")
+
+	if got := strings.Count(info.String(), "component=test"); got != 2 {
+		t.Errorf("info handler got %d records, want 2:\n%s", got, info.String())
+	}
+	if strings.Contains(errs.String(), "started") || !strings.Contains(errs.String(), "failed") {
+		t.Errorf("error handler must only get the error record:\n%s", errs.String())
+	}
+}
+
+func TestStreamHandlerRoutesTheStream(t *testing.T) {
+	var out, counts bytes.Buffer
+	logger := slog.New(StreamHandler{
+		Default: slog.NewTextHandler(&out, nil),
+		Streams: map[string]slog.Handler{StreamCounts: slog.NewTextHandler(&counts, nil)},
+	})
+
+	logger.Info("request")
+	logger.Info("count", Stream(StreamCounts), "count", 3)
+	logger.With(Stream(StreamCounts)).Info("bound count", "count", 4)
+	logger.Info("unknown stream", Stream("audit"))
+
+	if !strings.Contains(out.String(), "request") || !strings.Contains(out.String(), "unknown stream") {
+		t.Errorf("default handler misses records:\n%s", out.String())
+	}
+	if strings.Contains(out.String(), "count=") {
+		t.Errorf("count records reached the default handler:\n%s", out.String())
+	}
+	if !strings.Contains(counts.String(), "count=3") || !strings.Contains(counts.String(), "count=4") {
+		t.Errorf("stream handler misses the counts:\n%s", counts.String())
+	}
+}
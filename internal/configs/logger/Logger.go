@@ -1,31 +1,104 @@
 package logger
 
 import (
+	appconfig "Verve/internal/configs/appConfig"
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
 	"os"
 )
 
 var logger *slog.Logger
 
-// InitLogger initializes the logger with the specified format ("text" or "json")
-func InitLogger(format string) *slog.Logger {
-	var handler slog.Handler
+// InitLogger initializes the logger with the format, "text" or "json", and the
+// sinks of config. The level is read from level on every record, so it can be
+// changed at runtime. Records of the counts stream go to config.CountFile when it
+// is set. The returned function closes the files and the syslog connection.
+func InitLogger(config appconfig.LogConfig, level *slog.LevelVar) (*slog.Logger, func(ctx context.Context) error, error) {
+	var closers []io.Closer
+	closeSinks := func(ctx context.Context) error {
+		var errs []error
+		for _, closer := range closers {
+			errs = append(errs, closer.Close())
+		}
+		return errors.Join(errs...)
+	}
+	newHandler := func(w io.Writer) slog.Handler {
+		return newFormatHandler(config.Format, w, level)
+	}
+
+	handlers := make(FanoutHandler, 0, len(config.Sinks))
+	for _, sink := range config.Sinks {
+		switch sink {
+		case appconfig.LogSinkStdout:
+			handlers = append(handlers, newHandler(os.Stdout))
+		case appconfig.LogSinkFile:
+			file, err := openFile(config.File.Path, config.File)
+			if err != nil {
+				_ = closeSinks(context.Background())
+				return nil, nil, err
+			}
+			closers = append(closers, file)
+			handlers = append(handlers, newHandler(file))
+		case appconfig.LogSinkSyslog:
+			handler, err := NewSyslogHandler(config.Syslog.Network, config.Syslog.Address, config.Syslog.Tag, newHandler)
+			if err != nil {
+				_ = closeSinks(context.Background())
+				return nil, nil, fmt.Errorf("failed to connect to syslog: %w", err)
+			}
+			closers = append(closers, handler)
+			handlers = append(handlers, handler)
+		default:
+			_ = closeSinks(context.Background())
+			return nil, nil, fmt.Errorf("unknown log sink %q", sink)
+		}
+	}
+
+	var handler slog.Handler = handlers
+	if len(handlers) == 1 {
+		handler = handlers[0]
+	}
+	if config.CountFile != "" {
+		file, err := openFile(config.CountFile, config.File)
+		if err != nil {
+			_ = closeSinks(context.Background())
+			return nil, nil, err
+		}
+		closers = append(closers, file)
+		handler = StreamHandler{
+			Default: handler,
+			Streams: map[string]slog.Handler{StreamCounts: newHandler(file)},
+		}
+	}
+
+	// Initialize the global logger with the chosen handler, records logged with
+	// the context of a request carry its id
+	logger = slog.New(ContextHandler{handler})
 
+	// Return the logger
+	return logger, closeSinks, nil
+}
+
+func newFormatHandler(format string, w io.Writer, level *slog.LevelVar) slog.Handler {
 	// Choose the format (e.g., "text" or "json")
 	switch format {
-	case "json":
-		handler = slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
-			Level: slog.LevelInfo, // Set the log level to info
+	case appconfig.LogFormatJSON:
+		return slog.NewJSONHandler(w, &slog.HandlerOptions{
+			Level: level,
 		})
 	default: // Default to text format
-		handler = slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
-			Level: slog.LevelInfo, // Set the log level to info
+		return slog.NewTextHandler(w, &slog.HandlerOptions{
+			Level: level,
 		})
 	}
+}
 
-	// Initialize the global logger with the chosen handler
-	logger = slog.New(handler)
-
-	// Return the logger
-	return logger
+func openFile(path string, rotation appconfig.LogFileConfig) (*RotatingFile, error) {
+	file, err := OpenRotatingFile(path, rotation.MaxSizeMB, rotation.MaxAgeDays, rotation.MaxBackups)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open log file %s: %w", path, err)
+	}
+	return file, nil
 }
@@ -0,0 +1,53 @@
+package logger
+
+import (
+	appconfig "Verve/internal/configs/appConfig"
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInitLoggerRoutesCountsToTheCountFile(t *testing.T) {
+	dir := t.TempDir()
+	config := appconfig.Default().Log
+	config.Format = appconfig.LogFormatJSON
+	config.Sinks = []string{appconfig.LogSinkFile}
+	config.File.Path = filepath.Join(dir, "verve.log")
+	config.CountFile = filepath.Join(dir, "counts.log")
+
+	logger, closeSinks, err := InitLogger(config, new(slog.LevelVar))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	logger.Info("Request", "status", 200)
+	logger.Info("Unique count in the last minute", Stream(StreamCounts), "count", 7)
+	if err := closeSinks(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	logs, err := os.ReadFile(config.File.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts, err := os.ReadFile(config.CountFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(logs), `"status":200`) || strings.Contains(string(logs), `"count"`) {
+		t.Errorf("log file = %s", logs)
+	}
+	if !strings.Contains(string(counts), `"count":7`) || strings.Contains(string(counts), `"status"`) {
+		t.Errorf("count file = %s", counts)
+	}
+}
+
+func TestInitLoggerRejectsUnknownSinks(t *testing.T) {
+	config := appconfig.Default().Log
+	config.Sinks = []string{"kafka"}
+	if _, _, err := InitLogger(config, new(slog.LevelVar)); err == nil {
+		t.Error("expected an error for an unknown sink")
+	}
+}
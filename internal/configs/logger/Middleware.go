@@ -0,0 +1,62 @@
+package logger
+
+import (
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// RequestLogger logs one record per request with its status and latency, the
+// request id is added by ContextHandler. Failed requests are always logged, at
+// warn for client errors and error for server errors; only sampleRate of the
+// successful ones are logged, at info.
+func RequestLogger(logger *slog.Logger, sampleRate float64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r)
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			level := slog.LevelInfo
+			switch {
+			case status >= http.StatusInternalServerError:
+				level = slog.LevelError
+			case status >= http.StatusBadRequest:
+				level = slog.LevelWarn
+			case !sampled(sampleRate):
+				return
+			}
+			if !logger.Enabled(r.Context(), level) {
+				return
+			}
+
+			attrs := []slog.Attr{
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", status),
+				slog.Int("bytes", ww.BytesWritten()),
+				slog.Duration("latency", time.Since(start)),
+				slog.String("remote_addr", r.RemoteAddr),
+			}
+			if routeCtx := chi.RouteContext(r.Context()); routeCtx != nil && routeCtx.RoutePattern() != "" {
+				attrs = append(attrs, slog.String("route", routeCtx.RoutePattern()))
+			}
+			if sampleRate < 1 && level == slog.LevelInfo {
+				attrs = append(attrs, slog.Float64("sample_rate", sampleRate))
+			}
+			logger.LogAttrs(r.Context(), level, "Request", attrs...)
+		})
+	}
+}
+
+func sampled(sampleRate float64) bool {
+	return sampleRate >= 1 || (sampleRate > 0 && rand.Float64() < sampleRate)
+}
@@ -0,0 +1,44 @@
+package logger
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestLogger(t *testing.T) {
+	tests := []struct {
+		name       string
+		sampleRate float64
+		status     int
+		want       string
+	}{
+		{"logs every success without sampling", 1, http.StatusOK, "level=INFO"},
+		{"drops successes with a zero sample rate", 0, http.StatusOK, ""},
+		{"always logs client errors", 0, http.StatusTooManyRequests, "level=WARN"},
+		{"always logs server errors", 0, http.StatusInternalServerError, "level=ERROR"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			logger := slog.New(slog.NewTextHandler(&out, nil))
+			handler := RequestLogger(logger, tt.sampleRate)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+			}))
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/verve/accept", nil))
+
+			if tt.want == "" {
+				if out.Len() != 0 {
+					t.Fatalf("expected no record, got %q", out.String())
+				}
+				return
+			}
+			if !strings.Contains(out.String(), tt.want) || !strings.Contains(out.String(), "status=") {
+				t.Fatalf("record %q does not contain %s", out.String(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package logger
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat stamps the rotated files, it sorts in chronological order.
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// RotatingFile is a log file that is rotated once it reaches maxSize bytes. The
+// rotated files are named after the file and the time of the rotation; the ones
+// older than maxAge and beyond the maxBackups most recent are removed. A zero
+// limit disables it.
+type RotatingFile struct {
+	path       string
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+	now        func() time.Time
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// OpenRotatingFile opens, or creates, the log file at path.
+func OpenRotatingFile(path string, maxSizeMB, maxAgeDays, maxBackups int) (*RotatingFile, error) {
+	f := &RotatingFile{
+		path:       path,
+		maxSize:    int64(maxSizeMB) * 1024 * 1024,
+		maxAge:     time.Duration(maxAgeDays) * 24 * time.Hour,
+		maxBackups: maxBackups,
+		now:        time.Now,
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *RotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(f.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create log directory: %w", err)
+	}
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("failed to stat log file: %w", err)
+	}
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+// Write appends p to the file, rotating it first when p would not fit. When the
+// rotation fails p is still appended to the current file and the rotation is
+// retried on the next write.
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	var rotateErr error
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		if rotateErr = f.rotate(); f.file == nil {
+			return 0, rotateErr
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, errors.Join(rotateErr, err)
+}
+
+func (f *RotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return fmt.Errorf("failed to close log file: %w", err)
+	}
+	f.file = nil
+	ext := filepath.Ext(f.path)
+	backup := fmt.Sprintf("%s-%s%s", strings.TrimSuffix(f.path, ext), f.now().UTC().Format(backupTimeFormat), ext)
+	if err := os.Rename(f.path, backup); err != nil {
+		// Keep writing to the current file rather than stopping the sink.
+		if reopenErr := f.open(); reopenErr != nil {
+			return errors.Join(fmt.Errorf("failed to rotate log file: %w", err), reopenErr)
+		}
+		return fmt.Errorf("failed to rotate log file: %w", err)
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+	f.removeBackups()
+	return nil
+}
+
+// removeBackups removes the rotated files beyond the limits. Failures are ignored,
+// they are retried on the next rotation.
+func (f *RotatingFile) removeBackups() {
+	ext := filepath.Ext(f.path)
+	prefix := strings.TrimSuffix(f.path, ext) + "-"
+	matches, err := filepath.Glob(prefix + "*" + ext)
+	if err != nil {
+		return
+	}
+	// The glob also matches the other files named after this one, such as
+	// verve-counts.log next to verve.log; only the stamped ones are backups.
+	backups := make([]string, 0, len(matches))
+	for _, match := range matches {
+		stamp := strings.TrimSuffix(strings.TrimPrefix(match, prefix), ext)
+		if _, err := time.Parse(backupTimeFormat, stamp); err == nil {
+			backups = append(backups, match)
+		}
+	}
+	// Newest first.
+	sort.Sort(sort.Reverse(sort.StringSlice(backups)))
+	for i, backup := range backups {
+		expired := false
+		if f.maxAge > 0 {
+			if info, err := os.Stat(backup); err == nil && f.now().Sub(info.ModTime()) > f.maxAge {
+				expired = true
+			}
+		}
+		if expired || (f.maxBackups > 0 && i >= f.maxBackups) {
+			_ = os.Remove(backup)
+		}
+	}
+}
+
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
@@ -0,0 +1,174 @@
+package logger
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotatingFileRotatesAtMaxSize(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "verve.log")
+	file, err := OpenRotatingFile(path, 1, 0, 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer file.Close()
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	file.now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+	line := []byte(strings.Repeat("x", 1023) + "\n")
+	// 4MB in 1KB lines, rotated three times; only the 2 newest backups are kept.
+	for i := 0; i < 4*1024; i++ {
+		if _, err := file.Write(line); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	backups, err := filepath.Glob(filepath.Join(dir, "verve-*.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 2 {
+		t.Fatalf("got backups %v, want 2", backups)
+	}
+	if !strings.HasSuffix(backups[1], "verve-2024-01-01T00-00-03.000.log") {
+		t.Errorf("newest backup = %s", backups[1])
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != 1024*1024 {
+		t.Errorf("current file size = %d, want 1MB", info.Size())
+	}
+}
+
+func TestRotatingFileRemovesExpiredBackups(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "verve.log")
+	expired := filepath.Join(dir, "verve-2024-01-01T00-00-00.000.log")
+	if err := os.WriteFile(expired, []byte("old\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(expired, time.Now().Add(-48*time.Hour), time.Now().Add(-48*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(strings.Repeat("x", 1024*1024)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := OpenRotatingFile(path, 1, 1, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer file.Close()
+	if _, err := file.Write([]byte("rotate\n")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := os.Stat(expired); !os.IsNotExist(err) {
+		t.Errorf("expired backup was kept: %v", err)
+	}
+	backups, _ := filepath.Glob(filepath.Join(dir, "verve-*.log"))
+	if len(backups) != 1 {
+		t.Errorf("got backups %v, want the new one only", backups)
+	}
+}
+
+func TestRotatingFileWriteAfterClose(t *testing.T) {
+	file, err := OpenRotatingFile(filepath.Join(t.TempDir(), "verve.log"), 0, 0, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := file.Write([]byte("late\n")); err == nil {
+		t.Error("expected an error writing to a closed file")
+	}
+}
+
+func TestRotatingFileKeepsSiblingFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "verve.log")
+	siblings := []string{
+		filepath.Join(dir, "verve-counts.log"),
+		filepath.Join(dir, "verve-counts-2024-01-01T00-00-00.000.log"),
+	}
+	for _, sibling := range siblings {
+		if err := os.WriteFile(sibling, []byte("count\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(path, []byte(strings.Repeat("x", 1024*1024)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := OpenRotatingFile(path, 1, 0, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer file.Close()
+	if _, err := file.Write([]byte("rotate\n")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, sibling := range siblings {
+		if _, err := os.Stat(sibling); err != nil {
+			t.Errorf("sibling %s was removed: %v", sibling, err)
+		}
+	}
+}
+
+func TestRotatingFileKeepsWritingWhenTheRotationFails(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "verve.log")
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	// A non empty directory in place of the backup makes the rename fail.
+	backup := filepath.Join(dir, "verve-"+now.Format(backupTimeFormat)+".log")
+	if err := os.MkdirAll(filepath.Join(backup, "taken"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(strings.Repeat("x", 1024*1024)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := OpenRotatingFile(path, 1, 0, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer file.Close()
+	file.now = func() time.Time { return now }
+
+	if _, err := file.Write([]byte("first\n")); err == nil {
+		t.Error("expected the rotation error")
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("log file is gone: %v", err)
+	}
+	now = now.Add(time.Second)
+	if _, err := file.Write([]byte("second\n")); err != nil {
+		t.Fatalf("unexpected error once the rotation succeeds: %v", err)
+	}
+
+	rotated, err := os.ReadFile(filepath.Join(dir, "verve-"+now.Format(backupTimeFormat)+".log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(string(rotated), "first\n") {
+		t.Error("the record written during the failed rotation was lost")
+	}
+	current, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(current) != "second\n" {
+		t.Errorf("current file = %q, want the second record", current)
+	}
+}
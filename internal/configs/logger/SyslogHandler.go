@@ -0,0 +1,78 @@
+//go:build !windows && !plan9
+
+package logger
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"log/syslog"
+	"strings"
+	"sync"
+)
+
+// syslogWriter sends each record formatted by a SyslogHandler as one message at
+// the priority of the record level.
+type syslogWriter struct {
+	mu     sync.Mutex
+	writer *syslog.Writer
+	level  slog.Level
+}
+
+func (w *syslogWriter) Write(p []byte) (int, error) {
+	message := strings.TrimSuffix(string(p), "\n")
+	var err error
+	switch {
+	case w.level >= slog.LevelError:
+		err = w.writer.Err(message)
+	case w.level >= slog.LevelWarn:
+		err = w.writer.Warning(message)
+	case w.level >= slog.LevelInfo:
+		err = w.writer.Info(message)
+	default:
+		err = w.writer.Debug(message)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// SyslogHandler formats records with handler and sends them to syslog. The
+// syslog priority follows the level of the record.
+type SyslogHandler struct {
+	slog.Handler
+	writer *syslogWriter
+}
+
+// NewSyslogHandler dials the syslog daemon at address over network, the local
+// one when network is empty, and formats the records with newHandler.
+func NewSyslogHandler(network, address, tag string, newHandler func(w io.Writer) slog.Handler) (*SyslogHandler, error) {
+	writer, err := syslog.Dial(network, address, syslog.LOG_INFO|syslog.LOG_DAEMON, tag)
+	if err != nil {
+		return nil, err
+	}
+	w := &syslogWriter{writer: writer}
+	return &SyslogHandler{Handler: newHandler(w), writer: w}, nil
+}
+
+func (h *SyslogHandler) Handle(ctx context.Context, record slog.Record) error {
+	// The formatting handler writes synchronously, the lock ties the write to
+	// the level of this record.
+	h.writer.mu.Lock()
+	defer h.writer.mu.Unlock()
+	h.writer.level = record.Level
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *SyslogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &SyslogHandler{Handler: h.Handler.WithAttrs(attrs), writer: h.writer}
+}
+
+func (h *SyslogHandler) WithGroup(name string) slog.Handler {
+	return &SyslogHandler{Handler: h.Handler.WithGroup(name), writer: h.writer}
+}
+
+func (h *SyslogHandler) Close() error {
+	return h.writer.writer.Close()
+}
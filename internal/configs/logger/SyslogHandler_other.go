@@ -0,0 +1,23 @@
+//go:build windows || plan9
+
+package logger
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+)
+
+// SyslogHandler is not available on this platform.
+type SyslogHandler struct {
+	slog.Handler
+}
+
+// NewSyslogHandler fails, log/syslog is not implemented on this platform.
+func NewSyslogHandler(network, address, tag string, newHandler func(w io.Writer) slog.Handler) (*SyslogHandler, error) {
+	return nil, errors.New("syslog is not supported on this platform")
+}
+
+func (h *SyslogHandler) Close() error {
+	return nil
+}
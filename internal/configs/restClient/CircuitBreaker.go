@@ -0,0 +1,110 @@
+package restclient
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+type breakerState int
+
+const (
+	stateClosed breakerState = iota
+	stateOpen
+	stateHalfOpen
+)
+
+// BreakerConfig configures the per-host circuit breakers.
+type BreakerConfig struct {
+	// FailureThreshold is the number of consecutive failures that opens the circuit.
+	FailureThreshold int
+	// OpenTimeout is how long the circuit stays open before a trial call is let through.
+	OpenTimeout time.Duration
+}
+
+func DefaultBreakerConfig() BreakerConfig {
+	return BreakerConfig{
+		FailureThreshold: 5,
+		OpenTimeout:      30 * time.Second,
+	}
+}
+
+type circuitBreaker struct {
+	mu       sync.Mutex
+	config   BreakerConfig
+	state    breakerState
+	failures int
+	openedAt time.Time
+	trial    bool
+}
+
+// allow reports whether a call may go through. In the half open state a single
+// trial call is let through until its outcome is recorded.
+func (b *circuitBreaker) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case stateOpen:
+		if now.Sub(b.openedAt) < b.config.OpenTimeout {
+			return false
+		}
+		b.state = stateHalfOpen
+		b.trial = true
+		return true
+	case stateHalfOpen:
+		if b.trial {
+			return false
+		}
+		b.trial = true
+		return true
+	default:
+		return true
+	}
+}
+
+func (b *circuitBreaker) record(success bool, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+	if success {
+		b.state = stateClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == stateHalfOpen || b.failures >= b.config.FailureThreshold {
+		b.state = stateOpen
+		b.openedAt = now
+	}
+}
+
+// breakerRegistry holds one breaker per host.
+type breakerRegistry struct {
+	mu       sync.Mutex
+	config   BreakerConfig
+	breakers map[string]*circuitBreaker
+}
+
+func newBreakerRegistry(config BreakerConfig) *breakerRegistry {
+	return &breakerRegistry{
+		config:   config,
+		breakers: make(map[string]*circuitBreaker),
+	}
+}
+
+func (r *breakerRegistry) get(host string) *circuitBreaker {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	breaker, ok := r.breakers[host]
+	if !ok {
+		breaker = &circuitBreaker{config: r.config}
+		r.breakers[host] = breaker
+	}
+	return breaker
+}
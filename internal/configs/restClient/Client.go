@@ -0,0 +1,275 @@
+package restclient
+
+import (
+	"Verve/internal/tracing"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxResponseBytes bounds how much of a response body is buffered into a Response.
+const maxResponseBytes = 1 << 20
+
+// Client is the context aware HTTP client. Calls are cancelled with ctx and
+// configured per call through RequestOption values.
+type Client interface {
+	Do(ctx context.Context, method, path string, body interface{}, opts ...RequestOption) (*Response, error)
+}
+
+// Response is a fully read HTTP response, its body is already closed.
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	Attempts   int
+}
+
+// DecodeJSON unmarshals the response body into v.
+func (r *Response) DecodeJSON(v interface{}) error {
+	if err := json.Unmarshal(r.Body, v); err != nil {
+		return fmt.Errorf("failed to decode response body: %w", err)
+	}
+	return nil
+}
+
+// toHTTP rebuilds an *http.Response for the legacy RestClient methods.
+func (r *Response) toHTTP() *http.Response {
+	return &http.Response{
+		StatusCode:    r.StatusCode,
+		Status:        fmt.Sprintf("%d %s", r.StatusCode, http.StatusText(r.StatusCode)),
+		Header:        r.Header,
+		Body:          io.NopCloser(bytes.NewReader(r.Body)),
+		ContentLength: int64(len(r.Body)),
+	}
+}
+
+type requestOptions struct {
+	headers map[string]string
+	query   url.Values
+	timeout time.Duration
+	retry   RetryPolicy
+}
+
+// RequestOption configures a single call made through Client.Do.
+type RequestOption func(*requestOptions)
+
+// WithHeader sets a header on the call, overriding the client defaults.
+func WithHeader(key, value string) RequestOption {
+	return func(o *requestOptions) {
+		o.headers[key] = value
+	}
+}
+
+// WithHeaders sets several headers on the call.
+func WithHeaders(headers map[string]string) RequestOption {
+	return func(o *requestOptions) {
+		for key, value := range headers {
+			o.headers[key] = value
+		}
+	}
+}
+
+// WithQuery adds a query parameter to the url of the call.
+func WithQuery(key, value string) RequestOption {
+	return func(o *requestOptions) {
+		o.query.Add(key, value)
+	}
+}
+
+// WithTimeout bounds every attempt of the call; ctx bounds the call as a whole.
+func WithTimeout(timeout time.Duration) RequestOption {
+	return func(o *requestOptions) {
+		o.timeout = timeout
+	}
+}
+
+// WithRetry retries the call according to the policy, calls are not retried by default.
+func WithRetry(policy RetryPolicy) RequestOption {
+	return func(o *requestOptions) {
+		o.retry = policy
+	}
+}
+
+// Do performs the request through the host circuit breaker, retrying network errors
+// and retryable statuses as configured. A body given as []byte is sent as is,
+// anything else is encoded as JSON. A non-2xx final response is returned along
+// with a *StatusError.
+func (c *RestHttpClient) Do(ctx context.Context, method, path string, body interface{}, opts ...RequestOption) (*Response, error) {
+	options := requestOptions{
+		headers: make(map[string]string, len(c.headers)),
+		query:   url.Values{},
+		retry:   NoRetry,
+	}
+	for key, value := range c.headers {
+		options.headers[key] = value
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	payload, err := encodeBody(body)
+	if err != nil {
+		return nil, err
+	}
+	target, err := url.Parse(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(options.query) > 0 {
+		query := target.Query()
+		for key, values := range options.query {
+			for _, value := range values {
+				query.Add(key, value)
+			}
+		}
+		target.RawQuery = query.Encode()
+	}
+	breaker := c.breakers.get(target.Host)
+
+	var lastErr error
+	var lastResp *Response
+	attempts := options.retry.attempts()
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if !breaker.allow(time.Now()) {
+			return nil, fmt.Errorf("%s %s: %w", method, path, ErrCircuitOpen)
+		}
+
+		resp, err := c.send(ctx, method, target.String(), payload, options)
+		var retryAfter time.Duration
+		retryable := false
+		switch {
+		case err != nil:
+			breaker.record(false, time.Now())
+			lastErr = err
+			retryable = ctx.Err() == nil
+		case ClassifyStatus(resp.StatusCode) == ClassSuccess:
+			breaker.record(true, time.Now())
+			resp.Attempts = attempt
+			return resp, nil
+		default:
+			retryable = options.retry.isRetryableStatus(resp.StatusCode)
+			// Only server side trouble counts against the host, a 4xx is the caller's fault.
+			breaker.record(!retryable && ClassifyStatus(resp.StatusCode) != ClassServerError, time.Now())
+			retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+			resp.Attempts = attempt
+			lastResp = resp
+			lastErr = &StatusError{Method: method, URL: path, StatusCode: resp.StatusCode, Attempts: attempt}
+		}
+
+		if !retryable || attempt == attempts {
+			break
+		}
+
+		timer := time.NewTimer(options.retry.backoff(attempt, retryAfter))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return lastResp, ctx.Err()
+		}
+	}
+	return lastResp, lastErr
+}
+
+// DoJSON performs the request and decodes a 2xx response body into T.
+func DoJSON[T any](ctx context.Context, client Client, method, path string, body interface{}, opts ...RequestOption) (T, error) {
+	var result T
+	resp, err := client.Do(ctx, method, path, body, opts...)
+	if err != nil {
+		return result, err
+	}
+	err = resp.DecodeJSON(&result)
+	return result, err
+}
+
+func (c *RestHttpClient) send(ctx context.Context, method, path string, payload []byte, options requestOptions) (*Response, error) {
+	if options.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, options.timeout)
+		defer cancel()
+	}
+
+	var reqBody io.Reader
+	if payload != nil {
+		reqBody = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, path, reqBody)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set headers
+	for key, value := range options.headers {
+		req.Header.Set(key, value)
+	}
+
+	ctx, span := tracing.Tracer().Start(ctx, method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(method),
+			semconv.ServerAddress(req.URL.Hostname()),
+			semconv.URLPath(req.URL.Path),
+		))
+	defer span.End()
+	// Send the W3C traceparent so the receiver can continue the trace.
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := c.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+	if ClassifyStatus(resp.StatusCode) != ClassSuccess {
+		span.SetStatus(codes.Error, resp.Status)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	// Discard anything past the limit so the connection can be reused.
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	return &Response{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Body:       respBody,
+	}, nil
+}
+
+func encodeBody(body interface{}) ([]byte, error) {
+	switch b := body.(type) {
+	case nil:
+		return nil, nil
+	case []byte:
+		return b, nil
+	default:
+		return json.Marshal(body)
+	}
+}
+
+// legacyResponse maps the result of Do back to the RestClient contract, where any
+// response status is returned without an error.
+func legacyResponse(resp *Response, err error) (*http.Response, error) {
+	var statusErr *StatusError
+	if err != nil && !(errors.As(err, &statusErr) && resp != nil) {
+		return nil, err
+	}
+	return resp.toHTTP(), nil
+}
@@ -1,84 +1,102 @@
 package restclient
 
 import (
-	"bytes"
-	"encoding/json"
+	urlpolicy "Verve/internal/configs/urlPolicy"
+	"context"
+	"fmt"
+	"net"
 	"net/http"
 	"time"
 )
 
+// RestClient is the original context free API, kept as a thin adapter over Client.
 type RestClient interface {
+	Client
 	Get(path string) (*http.Response, error)
 	Post(path string, body interface{}) (*http.Response, error)
 	Put(path string, body interface{}) (*http.Response, error)
 	Delete(path string) (*http.Response, error)
+	PostWithRetry(path string, body interface{}, policy RetryPolicy) (*http.Response, error)
 }
 
 // RestClient represents a simple HTTP client
 type RestHttpClient struct {
 	httpClient *http.Client
 	headers    map[string]string
+	breakers   *breakerRegistry
 }
 
-// NewRestClient creates a new REST client instance
+// NewRestClient creates a new REST client instance guarded by the built-in callback url policy
 func NewRestClient() RestClient {
+	return NewRestClientWithPolicy(urlpolicy.New(nil, nil, nil, nil, false))
+}
+
+// NewRestClientWithPolicy creates a new REST client instance whose connections and
+// redirects are checked against the given url policy
+func NewRestClientWithPolicy(policy *urlpolicy.Policy) RestClient {
+	dialer := &net.Dialer{
+		Timeout:   5 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	transport := &http.Transport{
+		// No proxy: connecting through one would bypass the address checks at dial time.
+		Proxy:                 nil,
+		DialContext:           policy.DialContext(dialer),
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   10,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
 	return &RestHttpClient{
 		httpClient: &http.Client{
-			Timeout: time.Second * 30,
+			Timeout:   time.Second * 30,
+			Transport: transport,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) >= 5 {
+					return fmt.Errorf("stopped after %d redirects", len(via))
+				}
+				return policy.CheckURL(req.URL)
+			},
 		},
 		headers: map[string]string{
 			"Content-Type": "application/json",
 		},
+		breakers: newBreakerRegistry(DefaultBreakerConfig()),
 	}
 }
 
 // Get performs a GET request
 func (c *RestHttpClient) Get(path string) (*http.Response, error) {
-	return c.doRequest("GET", path, nil)
+	return legacyResponse(c.Do(context.Background(), "GET", path, nil))
 }
 
 // Post performs a POST request
 func (c *RestHttpClient) Post(path string, body interface{}) (*http.Response, error) {
-	return c.doRequest("POST", path, body)
+	return legacyResponse(c.Do(context.Background(), "POST", path, body))
 }
 
 // Put performs a PUT request
 func (c *RestHttpClient) Put(path string, body interface{}) (*http.Response, error) {
-	return c.doRequest("PUT", path, body)
+	return legacyResponse(c.Do(context.Background(), "PUT", path, body))
 }
 
 // Delete performs a DELETE request
 func (c *RestHttpClient) Delete(path string) (*http.Response, error) {
-	return c.doRequest("DELETE", path, nil)
-}
-
-// SetHeader sets a custom header
-func (c *RestHttpClient) SetHeader(key, value string) {
-	c.headers[key] = value
+	return legacyResponse(c.Do(context.Background(), "DELETE", path, nil))
 }
 
-// doRequest performs the HTTP request
-func (c *RestHttpClient) doRequest(method, path string, body interface{}) (*http.Response, error) {
-	url := path
-	var reqBody *bytes.Buffer
-
-	if body != nil {
-		jsonBody, err := json.Marshal(body)
-		if err != nil {
-			return nil, err
-		}
-		reqBody = bytes.NewBuffer(jsonBody)
-	}
-
-	req, err := http.NewRequest(method, url, reqBody)
+// PostWithRetry performs a POST request retried according to the policy. Non-2xx
+// final responses are returned as *StatusError.
+func (c *RestHttpClient) PostWithRetry(path string, body interface{}, policy RetryPolicy) (*http.Response, error) {
+	resp, err := c.Do(context.Background(), "POST", path, body, WithRetry(policy))
 	if err != nil {
 		return nil, err
 	}
+	return resp.toHTTP(), nil
+}
 
-	// Set headers
-	for key, value := range c.headers {
-		req.Header.Set(key, value)
-	}
-
-	return c.httpClient.Do(req)
+// SetHeader sets a custom header sent on every call
+func (c *RestHttpClient) SetHeader(key, value string) {
+	c.headers[key] = value
 }
@@ -0,0 +1,59 @@
+package restclient
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// StatusClass groups response codes by how the caller should react to them.
+type StatusClass int
+
+const (
+	ClassSuccess StatusClass = iota
+	ClassRedirect
+	ClassClientError
+	ClassServerError
+)
+
+func (c StatusClass) String() string {
+	switch c {
+	case ClassSuccess:
+		return "success"
+	case ClassRedirect:
+		return "redirect"
+	case ClassClientError:
+		return "client_error"
+	default:
+		return "server_error"
+	}
+}
+
+// ClassifyStatus maps a response code to its StatusClass.
+func ClassifyStatus(statusCode int) StatusClass {
+	switch {
+	case statusCode >= 200 && statusCode < 300:
+		return ClassSuccess
+	case statusCode >= 300 && statusCode < 400:
+		return ClassRedirect
+	case statusCode >= 400 && statusCode < 500:
+		return ClassClientError
+	default:
+		return ClassServerError
+	}
+}
+
+// StatusError is returned when the final response of a call is not a 2xx.
+type StatusError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Attempts   int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s %s returned %d %s after %d attempt(s)", e.Method, e.URL, e.StatusCode, http.StatusText(e.StatusCode), e.Attempts)
+}
+
+func (e *StatusError) Class() StatusClass {
+	return ClassifyStatus(e.StatusCode)
+}
@@ -0,0 +1,300 @@
+package urlpolicy
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Violation reports which rule a callback url failed.
+type Violation struct {
+	Rule    string
+	Message string
+}
+
+func (v *Violation) Error() string {
+	return v.Message
+}
+
+// Is matches any Violation with the same rule, so that the sentinel errors below
+// can be used with errors.Is.
+func (v *Violation) Is(target error) bool {
+	t, ok := target.(*Violation)
+	return ok && v.Rule == t.Rule
+}
+
+var (
+	ErrInvalidURL       = &Violation{Rule: "invalid_url", Message: "url is invalid"}
+	ErrSchemeNotAllowed = &Violation{Rule: "scheme_not_allowed", Message: "url scheme is not allowed"}
+	ErrHostNotAllowed   = &Violation{Rule: "host_not_allowed", Message: "url host is not allowed"}
+	ErrPortNotAllowed   = &Violation{Rule: "port_not_allowed", Message: "url port is not allowed"}
+	ErrBlockedAddress   = &Violation{Rule: "blocked_address", Message: "url resolves to a blocked address"}
+	ErrUnresolvable     = &Violation{Rule: "unresolvable", Message: "url host could not be resolved"}
+	ErrCredentialsInURL = &Violation{Rule: "credentials_not_allowed", Message: "url must not contain credentials"}
+)
+
+const defaultResolveTimeout = 2 * time.Second
+
+// blockedPrefixes are never reachable from callbacks: loopback, private, link-local
+// (including the cloud metadata address 169.254.169.254), CGNAT, multicast and reserved ranges,
+// plus the 6to4 and Teredo ranges, which embed an IPv4 address that could be private.
+var blockedPrefixes = mustParsePrefixes(
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.0.0.0/24",
+	"192.0.2.0/24",
+	"192.168.0.0/16",
+	"198.18.0.0/15",
+	"198.51.100.0/24",
+	"203.0.113.0/24",
+	"224.0.0.0/4",
+	"240.0.0.0/4",
+	"::/128",
+	"::1/128",
+	"64:ff9b::/96",
+	"100::/64",
+	"2001::/32",
+	"2001:db8::/32",
+	"2002::/16",
+	"fc00::/7",
+	"fe80::/10",
+	"ff00::/8",
+)
+
+// metadataAddresses are cloud metadata endpoints outside the ranges above.
+var metadataAddresses = []netip.Addr{
+	netip.MustParseAddr("100.100.100.200"),
+	netip.MustParseAddr("fd00:ec2::254"),
+}
+
+// Policy decides which callback urls the service is allowed to call.
+type Policy struct {
+	AllowedSchemes []string
+	// AllowedHosts restricts callbacks to these hosts when non-empty. An entry
+	// starting with "*." matches any subdomain.
+	AllowedHosts []string
+	DeniedHosts  []string
+	// AllowedPorts restricts the destination port when non-empty.
+	AllowedPorts []int
+	// AllowPrivate disables the address checks, it is meant for local development only.
+	AllowPrivate bool
+	Resolver     *net.Resolver
+}
+
+// New builds a policy. Schemes default to http and https and ports default to 80 and 443.
+func New(schemes, hosts, denied []string, ports []int, private bool) *Policy {
+	policy := &Policy{
+		AllowedSchemes: schemes,
+		AllowedHosts:   hosts,
+		DeniedHosts:    denied,
+		AllowedPorts:   ports,
+		AllowPrivate:   private,
+		Resolver:       net.DefaultResolver,
+	}
+	if len(policy.AllowedSchemes) == 0 {
+		policy.AllowedSchemes = []string{"http", "https"}
+	}
+	if len(policy.AllowedPorts) == 0 {
+		policy.AllowedPorts = []int{80, 443}
+	}
+	return policy
+}
+
+// ValidateURL checks the url against the policy and resolves its host to make
+// sure none of its addresses is blocked.
+func (p *Policy) ValidateURL(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ErrInvalidURL
+	}
+	if err := p.CheckURL(u); err != nil {
+		return err
+	}
+
+	host := u.Hostname()
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return p.CheckAddr(addr)
+	}
+
+	addrs, err := p.lookup(ctx, host)
+	if err != nil || len(addrs) == 0 {
+		return ErrUnresolvable
+	}
+	for _, addr := range addrs {
+		if err := p.CheckAddr(addr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type resolveCacheKey struct{}
+
+// resolveCache keeps the lookups of the hosts validated under one context.
+type resolveCache struct {
+	mu      sync.Mutex
+	results map[string]resolveResult
+}
+
+type resolveResult struct {
+	addrs []netip.Addr
+	err   error
+}
+
+// WithResolveCache returns a copy of ctx under which ValidateURL resolves every
+// host once, so that validating a batch does one lookup per distinct host rather
+// than one per url. The cache lives as long as the context, e.g. one request.
+func WithResolveCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, resolveCacheKey{}, &resolveCache{results: make(map[string]resolveResult)})
+}
+
+// lookup resolves host, through the cache of ctx when it has one.
+func (p *Policy) lookup(ctx context.Context, host string) ([]netip.Addr, error) {
+	cache, _ := ctx.Value(resolveCacheKey{}).(*resolveCache)
+	if cache != nil {
+		cache.mu.Lock()
+		result, ok := cache.results[host]
+		cache.mu.Unlock()
+		if ok {
+			return result.addrs, result.err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultResolveTimeout)
+	defer cancel()
+	addrs, err := p.Resolver.LookupNetIP(ctx, "ip", host)
+	if cache != nil {
+		cache.mu.Lock()
+		cache.results[host] = resolveResult{addrs: addrs, err: err}
+		cache.mu.Unlock()
+	}
+	return addrs, err
+}
+
+// CheckURL runs the checks that do not need DNS: scheme, credentials, host lists and port.
+func (p *Policy) CheckURL(u *url.URL) error {
+	if u.Host == "" || u.Hostname() == "" {
+		return ErrInvalidURL
+	}
+	if !containsFold(p.AllowedSchemes, u.Scheme) {
+		return ErrSchemeNotAllowed
+	}
+	if u.User != nil {
+		return ErrCredentialsInURL
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if matchHost(p.DeniedHosts, host) {
+		return ErrHostNotAllowed
+	}
+	if len(p.AllowedHosts) > 0 && !matchHost(p.AllowedHosts, host) {
+		return ErrHostNotAllowed
+	}
+
+	port := u.Port()
+	if port == "" {
+		switch strings.ToLower(u.Scheme) {
+		case "https":
+			port = "443"
+		default:
+			port = "80"
+		}
+	}
+	return p.checkPort(port)
+}
+
+// CheckAddr rejects addresses in the blocked ranges unless private addresses are allowed.
+func (p *Policy) CheckAddr(addr netip.Addr) error {
+	if p.AllowPrivate {
+		return nil
+	}
+	addr = addr.Unmap()
+	for _, metadata := range metadataAddresses {
+		if addr == metadata {
+			return ErrBlockedAddress
+		}
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return ErrBlockedAddress
+		}
+	}
+	return nil
+}
+
+// DialContext wraps the dialer so that the address actually connected to is
+// checked after DNS resolution. This closes the gap between validating a url
+// and the connection, for example DNS rebinding or redirects.
+func (p *Policy) DialContext(dialer *net.Dialer) func(ctx context.Context, network, address string) (net.Conn, error) {
+	guarded := *dialer
+	guarded.Control = func(network, address string, c syscall.RawConn) error {
+		addrPort, err := netip.ParseAddrPort(address)
+		if err != nil {
+			return ErrInvalidURL
+		}
+		if err := p.checkPort(strconv.Itoa(int(addrPort.Port()))); err != nil {
+			return err
+		}
+		return p.CheckAddr(addrPort.Addr())
+	}
+	return guarded.DialContext
+}
+
+func (p *Policy) checkPort(port string) error {
+	if len(p.AllowedPorts) == 0 {
+		return nil
+	}
+	num, err := strconv.Atoi(port)
+	if err != nil {
+		return ErrInvalidURL
+	}
+	for _, allowed := range p.AllowedPorts {
+		if allowed == num {
+			return nil
+		}
+	}
+	return ErrPortNotAllowed
+}
+
+func matchHost(patterns []string, host string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		if strings.HasPrefix(pattern, "*.") {
+			if strings.HasSuffix(host, pattern[1:]) {
+				return true
+			}
+			continue
+		}
+		if host == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func mustParsePrefixes(prefixes ...string) []netip.Prefix {
+	result := make([]netip.Prefix, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		result = append(result, netip.MustParsePrefix(prefix))
+	}
+	return result
+}
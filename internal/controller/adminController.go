@@ -0,0 +1,128 @@
+package controller
+
+import (
+	e "Verve/internal/configs/errorResponse"
+	"Verve/internal/model/request"
+	"Verve/internal/model/response"
+	"Verve/internal/service"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// AdminController serves the admin endpoints, all of them require the admin scope.
+type AdminController struct {
+	apiKeyService service.APIKeyService
+	adminService  service.AdminService
+}
+
+func NewAdminController(apiKeyService service.APIKeyService, adminService service.AdminService) *AdminController {
+	return &AdminController{
+		apiKeyService: apiKeyService,
+		adminService:  adminService,
+	}
+}
+
+// CreateAPIKey creates a key; the response is the only one carrying the plaintext key.
+func (c *AdminController) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	apiKeyRequest, err := request.DecodeAPIKey(w, r)
+	if err != nil {
+		e.SendProblem(w, r, e.NewProblem(http.StatusBadRequest, e.CodeBadRequest, err.Error()))
+		return
+	}
+	if err := apiKeyRequest.Validate(r.Context()); err != nil {
+		sendError(w, r, err, "invalid request")
+		return
+	}
+
+	apiKey, err := c.apiKeyService.Create(r.Context(), *apiKeyRequest)
+	if err != nil {
+		sendError(w, r, err, "failed to create api key")
+		return
+	}
+
+	e.SendJSONResponse(w, http.StatusCreated, apiKey)
+}
+
+// RevokeAPIKey deletes a key, it is rejected from the next request on.
+func (c *AdminController) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	if err := c.apiKeyService.Revoke(r.Context(), chi.URLParam(r, "id")); err != nil {
+		sendError(w, r, err, "failed to revoke api key")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetWindow returns the counts, callbacks and publisher state of the current window.
+func (c *AdminController) GetWindow(w http.ResponseWriter, r *http.Request) {
+	state, err := c.adminService.Window(r.Context())
+	if err != nil {
+		sendError(w, r, err, "failed to load window")
+		return
+	}
+
+	e.SendJSONResponse(w, http.StatusOK, state)
+}
+
+// FlushWindow finalizes the current window now and returns the state it was flushed with.
+func (c *AdminController) FlushWindow(w http.ResponseWriter, r *http.Request) {
+	state, err := c.adminService.FlushCurrentWindow(r.Context())
+	if err != nil {
+		sendError(w, r, err, "failed to flush window")
+		return
+	}
+
+	e.SendJSONResponse(w, http.StatusOK, state)
+}
+
+// ResetNamespace drops the ids of a namespace from the current window.
+func (c *AdminController) ResetNamespace(w http.ResponseWriter, r *http.Request) {
+	namespace := chi.URLParam(r, "namespace")
+	if err := request.ValidateNamespace(namespace); err != nil {
+		sendError(w, r, err, "invalid request")
+		return
+	}
+	if err := c.adminService.ResetNamespace(r.Context(), namespace); err != nil {
+		sendError(w, r, err, "failed to reset namespace")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PausePublisher holds the messages published from now on.
+func (c *AdminController) PausePublisher(w http.ResponseWriter, r *http.Request) {
+	e.SendJSONResponse(w, http.StatusOK, c.adminService.PausePublisher())
+}
+
+// ResumePublisher publishes the held messages and resumes publishing.
+func (c *AdminController) ResumePublisher(w http.ResponseWriter, r *http.Request) {
+	state, err := c.adminService.ResumePublisher(r.Context())
+	if err != nil {
+		sendError(w, r, err, "failed to resume publisher")
+		return
+	}
+
+	e.SendJSONResponse(w, http.StatusOK, state)
+}
+
+func (c *AdminController) GetLogLevel(w http.ResponseWriter, r *http.Request) {
+	e.SendJSONResponse(w, http.StatusOK, response.LogLevelResponse{Level: c.adminService.LogLevel().String()})
+}
+
+// PutLogLevel changes the log level of the instance until it restarts.
+func (c *AdminController) PutLogLevel(w http.ResponseWriter, r *http.Request) {
+	logLevelRequest, err := request.DecodeLogLevel(w, r)
+	if err != nil {
+		e.SendProblem(w, r, e.NewProblem(http.StatusBadRequest, e.CodeBadRequest, err.Error()))
+		return
+	}
+	if err := logLevelRequest.Validate(r.Context()); err != nil {
+		sendError(w, r, err, "invalid request")
+		return
+	}
+
+	c.adminService.SetLogLevel(logLevelRequest.SlogLevel())
+	e.SendJSONResponse(w, http.StatusOK, response.LogLevelResponse{Level: c.adminService.LogLevel().String()})
+}
@@ -0,0 +1,67 @@
+package controller
+
+import (
+	e "Verve/internal/configs/errorResponse"
+	"Verve/internal/database"
+	"Verve/internal/model/request"
+	"Verve/internal/model/response"
+	"Verve/internal/repository"
+	"Verve/internal/worker"
+	"errors"
+	"net/http"
+)
+
+// problemFromError maps a domain error to problem details. Unknown errors become a
+// 500 whose detail is fallback, so internal messages are not leaked.
+func problemFromError(err error, fallback string) e.Problem {
+	var validationErr *request.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		problem := e.NewProblem(http.StatusBadRequest, e.CodeValidation, validationErr.Error())
+		problem.Details = []e.ProblemDetail{{
+			Field:   validationErr.Field,
+			Code:    validationErr.Code(),
+			Message: validationErr.Message,
+		}}
+		return problem
+	case errors.Is(err, repository.ErrDeliveryNotFound),
+		errors.Is(err, repository.ErrTemplateNotFound),
+		errors.Is(err, repository.ErrWebhookNotFound):
+		return e.NewProblem(http.StatusNotFound, e.CodeNotFound, err.Error())
+	case errors.Is(err, e.ErrUnauthorized):
+		return e.NewProblem(http.StatusUnauthorized, e.CodeUnauthorized, err.Error())
+	case errors.Is(err, e.ErrForbidden):
+		return e.NewProblem(http.StatusForbidden, e.CodeForbidden, err.Error())
+	case errors.Is(err, repository.ErrAPIKeyNotFound):
+		return e.NewProblem(http.StatusNotFound, e.CodeNotFound, err.Error())
+	case errors.Is(err, e.ErrRateLimited):
+		return e.NewProblem(http.StatusTooManyRequests, e.CodeRateLimited, err.Error())
+	case errors.Is(err, worker.ErrQueueFull):
+		return e.NewProblem(http.StatusServiceUnavailable, e.CodeQueueFull, "callback queue is full, retry later")
+	case errors.Is(err, e.ErrUnavailable), database.IsUnavailable(err):
+		return e.NewProblem(http.StatusServiceUnavailable, e.CodeUnavailable, fallback)
+	default:
+		return e.NewProblem(http.StatusInternalServerError, e.CodeInternal, fallback)
+	}
+}
+
+// sendError writes err as problem details.
+func sendError(w http.ResponseWriter, r *http.Request, err error, fallback string) {
+	e.SendProblem(w, r, problemFromError(err, fallback))
+}
+
+// sendLegacyError keeps the plaintext "failed" body of the legacy route unless the
+// client asks for JSON; the error code is always reported in ErrorCodeHeader.
+func sendLegacyError(w http.ResponseWriter, r *http.Request, err error, fallback string) {
+	problem := problemFromError(err, fallback)
+	if e.WantsJSON(r) {
+		e.SendProblem(w, r, problem)
+		return
+	}
+	code := problem.Code
+	if len(problem.Details) > 0 {
+		code = problem.Details[0].Code
+	}
+	w.Header().Set(e.ErrorCodeHeader, code)
+	e.SendResponse(w, problem.Status, response.StatusFailed)
+}
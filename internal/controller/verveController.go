@@ -1,27 +1,383 @@
 package controller
 
 import (
-	appcontext "Verve/internal/configs/appContext"
+	"Verve/internal/auth"
 	e "Verve/internal/configs/errorResponse"
+	urlpolicy "Verve/internal/configs/urlPolicy"
+	"Verve/internal/model/entity"
 	"Verve/internal/model/request"
+	"Verve/internal/model/response"
+	"Verve/internal/ratelimit"
+	"Verve/internal/repository"
+	"Verve/internal/service"
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
+
+	"github.com/go-chi/chi/v5"
 )
 
-func GetApi(w http.ResponseWriter, r *http.Request) {
-	appCtx := appcontext.GetAppContext()
+// VerveController serves the accept, callback and webhook endpoints.
+type VerveController struct {
+	verveService    service.VerveService
+	callbackService service.CallbackService
+	webhookService  service.WebhookService
+	idPolicy        *ratelimit.Policy
+	ids             request.IdValidator
+	urls            *urlpolicy.Policy
+}
+
+// NewVerveController creates the controller; idPolicy limits the requests of every
+// id on the accept endpoint and may be nil. Accepted ids are normalized by ids and
+// callback urls are checked against urls.
+func NewVerveController(verveService service.VerveService, callbackService service.CallbackService, webhookService service.WebhookService, idPolicy *ratelimit.Policy, ids request.IdValidator, urls *urlpolicy.Policy) *VerveController {
+	return &VerveController{
+		verveService:    verveService,
+		callbackService: callbackService,
+		webhookService:  webhookService,
+		idPolicy:        idPolicy,
+		ids:             ids,
+		urls:            urls,
+	}
+}
+
+// allowId applies the id policy to an accepted request.
+func (c *VerveController) allowId(ctx context.Context, req request.VerveRequest) (ratelimit.Result, error) {
+	return c.idPolicy.Allow(ctx, idKey(req))
+}
+
+// allowIds applies the id policy to a batch of accepted requests with a single
+// limiter call and returns one error per request.
+func (c *VerveController) allowIds(ctx context.Context, reqs []request.VerveRequest) []error {
+	keys := make([]string, len(reqs))
+	for i, req := range reqs {
+		keys[i] = idKey(req)
+	}
+	return c.idPolicy.AllowN(ctx, keys)
+}
+
+func idKey(req request.VerveRequest) string {
+	return req.Namespace + ":" + req.Id
+}
+
+// keyNamespace applies the namespace of the authenticated api key: requests of a
+// namespaced key default to its namespace and may not name another one.
+func keyNamespace(ctx context.Context, namespace string) (string, error) {
+	apiKey, ok := auth.FromContext(ctx)
+	if !ok || apiKey.Namespace == "" {
+		return namespace, nil
+	}
+	if namespace != "" && namespace != apiKey.Namespace {
+		return "", fmt.Errorf("%w: the api key is restricted to the %s namespace", e.ErrForbidden, apiKey.Namespace)
+	}
+	return apiKey.Namespace, nil
+}
+
+// ownedByKey reports whether a record of the namespace is visible to the
+// authenticated api key: a namespaced key only sees the records of its namespace.
+func ownedByKey(ctx context.Context, namespace string) bool {
+	apiKey, ok := auth.FromContext(ctx)
+	return !ok || apiKey.Namespace == "" || apiKey.Namespace == namespace
+}
+
+// validationCode returns the "field.rule" code of a validation error, or an empty string.
+func validationCode(err error) string {
+	var validationErr *request.ValidationError
+	if errors.As(err, &validationErr) {
+		return validationErr.Code()
+	}
+	return ""
+}
+
+// GetApi is the legacy accept route. It answers plaintext ok/failed unless the
+// client asks for JSON, in which case errors are problem details.
+func (c *VerveController) GetApi(w http.ResponseWriter, r *http.Request) {
+	request, err := request.SanitizeUrlParams(r, c.ids, c.urls)
+	if err != nil {
+		sendLegacyError(w, r, err, "invalid request")
+		return
+	}
+	if request.Namespace, err = keyNamespace(r.Context(), request.Namespace); err != nil {
+		sendLegacyError(w, r, err, "forbidden namespace")
+		return
+	}
+
+	if result, err := c.allowId(r.Context(), *request); err != nil {
+		// The headers of the client policy are only replaced when the id is the one limited.
+		ratelimit.SetHeaders(w, result)
+		sendLegacyError(w, r, err, "rate limited")
+		return
+	}
+
+	err = c.verveService.SaveAndPost(r.Context(), *request)
+	if err != nil {
+		sendLegacyError(w, r, err, "failed to save id")
+		return
+	}
+
+	if e.WantsJSON(r) {
+		e.SendJSONResponse(w, http.StatusOK, response.StatusResponse{Status: response.StatusOk})
+		return
+	}
+	e.SendResponse(w, http.StatusOK, response.StatusOk)
+}
+
+// PostApi accepts a JSON body holding one item or an array of items and
+// returns a result for every item in the order they were received.
+func (c *VerveController) PostApi(w http.ResponseWriter, r *http.Request) {
+	requests, err := request.DecodeAcceptBody(w, r)
+	if err != nil {
+		e.SendProblem(w, r, e.NewProblem(http.StatusBadRequest, e.CodeBadRequest, err.Error()))
+		return
+	}
+
+	// The urls of a batch often share a host, it is resolved once.
+	validateCtx := urlpolicy.WithResolveCache(r.Context())
+	results := make([]response.AcceptResult, len(requests))
+	checked := make([]request.VerveRequest, 0, len(requests))
+	checkedIndexes := make([]int, 0, len(requests))
+	for i, req := range requests {
+		results[i] = response.AcceptResult{Id: req.Id, Status: response.StatusOk}
+		if req.Namespace, err = keyNamespace(r.Context(), req.Namespace); err != nil {
+			results[i].Status = response.StatusFailed
+			results[i].Error = err.Error()
+			results[i].Code = e.CodeForbidden
+			continue
+		}
+		if err := req.Validate(validateCtx, c.ids, c.urls); err != nil {
+			results[i].Status = response.StatusFailed
+			results[i].Error = err.Error()
+			results[i].Code = validationCode(err)
+			continue
+		}
+		results[i].Id = req.Id
+		checked = append(checked, req)
+		checkedIndexes = append(checkedIndexes, i)
+	}
+
+	valid := make([]request.VerveRequest, 0, len(checked))
+	validIndexes := make([]int, 0, len(checked))
+	limited := 0
+	for j, err := range c.allowIds(r.Context(), checked) {
+		i := checkedIndexes[j]
+		if err != nil {
+			results[i].Status = response.StatusFailed
+			results[i].Error = err.Error()
+			results[i].Code = e.CodeRateLimited
+			limited++
+			continue
+		}
+		valid = append(valid, checked[j])
+		validIndexes = append(validIndexes, i)
+	}
+
+	statusCode := http.StatusOK
+	switch {
+	case len(valid) == 0 && limited == len(requests):
+		statusCode = http.StatusTooManyRequests
+	case len(valid) == 0:
+		statusCode = http.StatusBadRequest
+	case len(valid) < len(requests):
+		statusCode = http.StatusMultiStatus
+	}
+
+	if len(valid) > 0 {
+		err = c.verveService.SaveAllAndPost(r.Context(), valid)
+		if err != nil {
+			problem := problemFromError(err, "failed to save id")
+			for _, i := range validIndexes {
+				results[i].Status = response.StatusFailed
+				results[i].Error = problem.Detail
+				results[i].Code = problem.Code
+			}
+			statusCode = problem.Status
+		}
+	}
+
+	e.SendJSONResponse(w, statusCode, response.AcceptResponse{Results: results})
+}
 
-	request, err := request.SanitizeUrlParams(r)
+// GetCallback returns the delivery status, attempts and last error of a callback.
+func (c *VerveController) GetCallback(w http.ResponseWriter, r *http.Request) {
+	delivery, err := c.callbackService.GetDelivery(r.Context(), chi.URLParam(r, "id"))
+	if err == nil && !ownedByKey(r.Context(), delivery.Namespace) {
+		// The deliveries of other namespaces are not revealed to exist.
+		err = repository.ErrDeliveryNotFound
+	}
+	if err != nil {
+		sendError(w, r, err, "failed to load callback delivery")
+		return
+	}
 
+	e.SendJSONResponse(w, http.StatusOK, delivery)
+}
+
+// ListCallbacks returns the deliveries sent to the url query parameter for the
+// window query parameter, an empty list when the url got no callback for it. A
+// namespaced key only gets the deliveries of its namespace.
+func (c *VerveController) ListCallbacks(w http.ResponseWriter, r *http.Request) {
+	query, err := request.ParseDeliveryQuery(r)
 	if err != nil {
-		e.SendResponse(w, http.StatusBadRequest, "failed")
+		sendError(w, r, err, "invalid request")
 		return
 	}
 
-	err = appCtx.VerveService.SaveAndPost(r.Context(), *request)
+	deliveries, err := c.callbackService.FindDeliveries(r.Context(), query.Url, query.Window)
 	if err != nil {
-		e.SendResponse(w, http.StatusInternalServerError, "failed")
+		sendError(w, r, err, "failed to find callback deliveries")
 		return
 	}
+	owned := make([]entity.CallbackDelivery, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		if ownedByKey(r.Context(), delivery.Namespace) {
+			owned = append(owned, delivery)
+		}
+	}
+	deliveries = owned
 
-	e.SendResponse(w, http.StatusOK, "ok")
+	e.SendJSONResponse(w, http.StatusOK, deliveries)
+}
+
+// PutCallbackTemplate registers the payload format, method and headers used for a callback target.
+// Templates are kept per namespace, given by the namespace query parameter or the
+// api key, and only shape the callbacks of that namespace.
+func (c *VerveController) PutCallbackTemplate(w http.ResponseWriter, r *http.Request) {
+	templateRequest, err := request.DecodeCallbackTemplate(w, r)
+	if err != nil {
+		e.SendProblem(w, r, e.NewProblem(http.StatusBadRequest, e.CodeBadRequest, err.Error()))
+		return
+	}
+	if err := templateRequest.Validate(r.Context(), c.urls); err != nil {
+		sendError(w, r, err, "invalid request")
+		return
+	}
+
+	template := entity.GetTemplateFromRequest(*templateRequest)
+	if template.Namespace, err = keyNamespace(r.Context(), r.URL.Query().Get("namespace")); err != nil {
+		sendError(w, r, err, "forbidden namespace")
+		return
+	}
+	if err := c.callbackService.SaveTemplate(r.Context(), template); err != nil {
+		sendError(w, r, err, "failed to save callback template")
+		return
+	}
+
+	e.SendJSONResponse(w, http.StatusOK, template)
+}
+
+// GetCallbackTemplate returns the template registered for the url and namespace query parameters.
+func (c *VerveController) GetCallbackTemplate(w http.ResponseWriter, r *http.Request) {
+	namespace, err := keyNamespace(r.Context(), r.URL.Query().Get("namespace"))
+	if err != nil {
+		sendError(w, r, err, "forbidden namespace")
+		return
+	}
+
+	template, err := c.callbackService.GetTemplate(r.Context(), namespace, r.URL.Query().Get("url"))
+	if err != nil {
+		sendError(w, r, err, "failed to load callback template")
+		return
+	}
+
+	e.SendJSONResponse(w, http.StatusOK, template)
+}
+
+// DeleteCallbackTemplate removes the template of the url and namespace query parameters, callbacks fall back to the default format.
+func (c *VerveController) DeleteCallbackTemplate(w http.ResponseWriter, r *http.Request) {
+	namespace, err := keyNamespace(r.Context(), r.URL.Query().Get("namespace"))
+	if err != nil {
+		sendError(w, r, err, "forbidden namespace")
+		return
+	}
+
+	if err := c.callbackService.DeleteTemplate(r.Context(), namespace, r.URL.Query().Get("url")); err != nil {
+		sendError(w, r, err, "failed to delete callback template")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CreateWebhook registers a namespace subscription; the response is the only one carrying the secret.
+func (c *VerveController) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	webhookRequest, err := request.DecodeWebhook(w, r)
+	if err != nil {
+		e.SendProblem(w, r, e.NewProblem(http.StatusBadRequest, e.CodeBadRequest, err.Error()))
+		return
+	}
+	if webhookRequest.Namespace, err = keyNamespace(r.Context(), webhookRequest.Namespace); err != nil {
+		sendError(w, r, err, "forbidden namespace")
+		return
+	}
+	if err := webhookRequest.Validate(r.Context(), c.urls); err != nil {
+		sendError(w, r, err, "invalid request")
+		return
+	}
+
+	subscription, err := c.webhookService.Create(r.Context(), *webhookRequest)
+	if err != nil {
+		sendError(w, r, err, "failed to create webhook")
+		return
+	}
+
+	e.SendJSONResponse(w, http.StatusCreated, subscription)
+}
+
+// ListWebhooks returns the subscriptions of the namespace query parameter, without their secrets.
+func (c *VerveController) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	namespace, err := keyNamespace(r.Context(), r.URL.Query().Get("namespace"))
+	if err != nil {
+		sendError(w, r, err, "forbidden namespace")
+		return
+	}
+
+	subscriptions, err := c.webhookService.List(r.Context(), namespace)
+	if err != nil {
+		sendError(w, r, err, "failed to list webhooks")
+		return
+	}
+
+	e.SendJSONResponse(w, http.StatusOK, subscriptions)
+}
+
+// GetWebhook returns a subscription without its secret.
+func (c *VerveController) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	subscription, err := c.ownedWebhook(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		sendError(w, r, err, "failed to load webhook")
+		return
+	}
+
+	e.SendJSONResponse(w, http.StatusOK, subscription)
+}
+
+// DeleteWebhook removes a subscription; its pending deliveries are failed when next attempted.
+func (c *VerveController) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if _, err := c.ownedWebhook(r.Context(), id); err != nil {
+		sendError(w, r, err, "failed to delete webhook")
+		return
+	}
+
+	err := c.webhookService.Delete(r.Context(), id)
+	if err != nil {
+		sendError(w, r, err, "failed to delete webhook")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ownedWebhook loads a subscription visible to the authenticated api key; the
+// subscriptions of other namespaces are reported as not found.
+func (c *VerveController) ownedWebhook(ctx context.Context, id string) (*entity.WebhookSubscription, error) {
+	subscription, err := c.webhookService.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !ownedByKey(ctx, subscription.Namespace) {
+		return nil, repository.ErrWebhookNotFound
+	}
+	return subscription, nil
 }
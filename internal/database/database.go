@@ -1,52 +1,71 @@
 package database
 
 import (
+	appconfig "Verve/internal/configs/appConfig"
+	"Verve/internal/metrics"
+	"Verve/internal/tracing"
 	"context"
+	"errors"
 	"fmt"
-	"log"
 	"math"
-	"os"
+	"net"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
-	_ "github.com/joho/godotenv/autoload"
 	"github.com/redis/go-redis/v9"
 )
 
 type Service interface {
-	Health() map[string]string
+	Health(ctx context.Context) map[string]string
+	Close() error
 	Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error
 	Get(ctx context.Context, key string) (string, error)
+	MGet(ctx context.Context, keys []string) (map[string]string, error)
 	Del(ctx context.Context, key string) error
 	CountByPrefix(ctx context.Context, prefix string) (int64, error)
 	SAdd(ctx context.Context, key string, members ...interface{}) error
+	SAddBatch(ctx context.Context, members map[string][]interface{}, ttl time.Duration) error
 	SCard(ctx context.Context, key string) (int64, error)
+	SMembers(ctx context.Context, key string) ([]string, error)
+	SRem(ctx context.Context, key string, members ...interface{}) error
+	SAddWithTTL(ctx context.Context, key string, ttl time.Duration, members ...interface{}) error
+	SPopN(ctx context.Context, key string, count int64) ([]string, error)
+	SetNX(ctx context.Context, key string, value interface{}, ttl time.Duration) (bool, error)
+	SetNXBatch(ctx context.Context, values map[string]interface{}, ttl time.Duration) error
+	ZAdd(ctx context.Context, key string, score float64, member string) error
+	ZRangeByScore(ctx context.Context, key string, max float64, limit int64) ([]string, error)
+	ZRem(ctx context.Context, key string, member string) (bool, error)
+	Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error)
 }
 
-type service struct {
-	db *redis.Client
-}
-
-var (
-	address  = os.Getenv("DB_ADDRESS")
-	port     = os.Getenv("DB_PORT")
-	password = os.Getenv("DB_PASSWORD")
-	database = os.Getenv("DB_DATABASE")
-)
+// ErrNotFound is returned by Get when the key does not exist.
+var ErrNotFound = errors.New("key not found")
 
-func New() Service {
-	num, err := strconv.Atoi(database)
-	if err != nil {
-		log.Fatalf("database incorrect %v", err)
+// IsUnavailable reports whether err means Redis could not be reached or did not
+// answer in time, as opposed to rejecting the command.
+func IsUnavailable(err error) bool {
+	if err == nil {
+		return false
 	}
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, redis.ErrClosed) ||
+		errors.Is(err, context.DeadlineExceeded)
+}
 
-	fullAddress := fmt.Sprintf("%s:%s", address, port)
+type service struct {
+	db      *redis.Client
+	scripts sync.Map
+}
 
+// New creates the Redis client described by the configuration; it connects lazily.
+func New(config appconfig.RedisConfig) Service {
 	rdb := redis.NewClient(&redis.Options{
-		Addr:     fullAddress,
-		Password: password,
-		DB:       num,
+		Addr:     config.Addr(),
+		Password: config.Password,
+		DB:       config.Database,
 		// Note: It's important to add this for a secure connection. Most cloud services that offer Redis should already have this configured in their services.
 		// For manual setup, please refer to the Redis documentation: https://redis.io/docs/latest/operate/oss_and_stack/management/security/encryption/
 		// TLSConfig: &tls.Config{
@@ -54,14 +73,22 @@ func New() Service {
 		// },
 	})
 
+	rdb.AddHook(metrics.RedisHook{})
+	rdb.AddHook(tracing.RedisHook{})
+
 	s := &service{db: rdb}
 
 	return s
 }
 
+// Close closes the Redis client and its connection pool.
+func (s *service) Close() error {
+	return s.db.Close()
+}
+
 // Health returns the health status and statistics of the Redis server.
-func (s *service) Health() map[string]string {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second) // Default is now 5s
+func (s *service) Health(ctx context.Context) map[string]string {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second) // Default is now 5s
 	defer cancel()
 
 	stats := make(map[string]string)
@@ -76,10 +103,11 @@ func (s *service) Health() map[string]string {
 func (s *service) checkRedisHealth(ctx context.Context, stats map[string]string) map[string]string {
 	// Ping the Redis server to check its availability.
 	pong, err := s.db.Ping(ctx).Result()
-	// Note: By extracting and simplifying like this, `log.Fatalf("db down: %v", err)`
-	// can be changed into a standard error instead of a fatal error.
 	if err != nil {
-		log.Fatalf(fmt.Sprintf("db down: %v", err))
+		// Redis being unreachable is reported, never fatal: it may only be a blip.
+		stats["redis_status"] = "down"
+		stats["redis_message"] = fmt.Sprintf("db down: %v", err)
+		return stats
 	}
 
 	// Redis is up
@@ -210,7 +238,30 @@ func (s *service) Set(ctx context.Context, key string, value interface{}, ttl ti
 
 func (s *service) Get(ctx context.Context, key string) (string, error) {
 	// Using Get to retrieve the value of a key
-	return s.db.Get(ctx, key).Result()
+	value, err := s.db.Get(ctx, key).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", ErrNotFound
+	}
+	return value, err
+}
+
+// MGet returns the values of the keys in one round trip, keys that do not exist
+// are left out.
+func (s *service) MGet(ctx context.Context, keys []string) (map[string]string, error) {
+	values := make(map[string]string, len(keys))
+	if len(keys) == 0 {
+		return values, nil
+	}
+	results, err := s.db.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for i, result := range results {
+		if value, ok := result.(string); ok {
+			values[keys[i]] = value
+		}
+	}
+	return values, nil
 }
 
 func (s *service) Del(ctx context.Context, key string) error {
@@ -233,3 +284,93 @@ func (s *service) SAdd(ctx context.Context, key string, members ...interface{})
 func (s *service) SCard(ctx context.Context, key string) (int64, error) {
 	return s.db.SCard(ctx, key).Result()
 }
+
+// SAddBatch adds members to several sets in a single pipelined round trip and,
+// when ttl is positive, sets it on every set written to.
+func (s *service) SAddBatch(ctx context.Context, members map[string][]interface{}, ttl time.Duration) error {
+	_, err := s.db.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for key, values := range members {
+			if len(values) == 0 {
+				continue
+			}
+			pipe.SAdd(ctx, key, values...)
+			if ttl > 0 {
+				pipe.Expire(ctx, key, ttl)
+			}
+		}
+		return nil
+	})
+	return err
+}
+
+func (s *service) SMembers(ctx context.Context, key string) ([]string, error) {
+	return s.db.SMembers(ctx, key).Result()
+}
+
+func (s *service) SRem(ctx context.Context, key string, members ...interface{}) error {
+	return s.db.SRem(ctx, key, members...).Err()
+}
+
+// SAddWithTTL adds members to a set and refreshes its expiration in one round trip.
+func (s *service) SAddWithTTL(ctx context.Context, key string, ttl time.Duration, members ...interface{}) error {
+	_, err := s.db.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SAdd(ctx, key, members...)
+		pipe.Expire(ctx, key, ttl)
+		return nil
+	})
+	return err
+}
+
+// SPopN removes and returns up to count random members of a set. Each member is
+// returned to exactly one caller, which makes it safe to share work between replicas.
+func (s *service) SPopN(ctx context.Context, key string, count int64) ([]string, error) {
+	return s.db.SPopN(ctx, key, count).Result()
+}
+
+func (s *service) SetNX(ctx context.Context, key string, value interface{}, ttl time.Duration) (bool, error) {
+	return s.db.SetNX(ctx, key, value, ttl).Result()
+}
+
+// SetNXBatch sets the keys that do not exist yet, with the ttl, in a single
+// pipelined round trip.
+func (s *service) SetNXBatch(ctx context.Context, values map[string]interface{}, ttl time.Duration) error {
+	if len(values) == 0 {
+		return nil
+	}
+	_, err := s.db.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for key, value := range values {
+			pipe.SetNX(ctx, key, value, ttl)
+		}
+		return nil
+	})
+	return err
+}
+
+func (s *service) ZAdd(ctx context.Context, key string, score float64, member string) error {
+	return s.db.ZAdd(ctx, key, redis.Z{Score: score, Member: member}).Err()
+}
+
+// ZRangeByScore returns up to limit members with a score lower or equal to max, lowest first.
+func (s *service) ZRangeByScore(ctx context.Context, key string, max float64, limit int64) ([]string, error) {
+	return s.db.ZRangeByScore(ctx, key, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatFloat(max, 'f', -1, 64),
+		Count: limit,
+	}).Result()
+}
+
+// ZRem removes the member and reports whether it was present, so that concurrent
+// callers can use it to claim a member exclusively.
+func (s *service) ZRem(ctx context.Context, key string, member string) (bool, error) {
+	removed, err := s.db.ZRem(ctx, key, member).Result()
+	return removed > 0, err
+}
+
+// Eval runs a Lua script, by its SHA1 once Redis has cached it.
+func (s *service) Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+	cached, ok := s.scripts.Load(script)
+	if !ok {
+		cached, _ = s.scripts.LoadOrStore(script, redis.NewScript(script))
+	}
+	return cached.(*redis.Script).Run(ctx, s.db, keys, args...).Result()
+}
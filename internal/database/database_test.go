@@ -1,6 +1,7 @@
 package database
 
 import (
+	appconfig "Verve/internal/configs/appConfig"
 	"context"
 	"log"
 	"testing"
@@ -8,6 +9,9 @@ import (
 	"github.com/testcontainers/testcontainers-go/modules/redis"
 )
 
+// testConfig points at the Redis container started by TestMain.
+var testConfig appconfig.RedisConfig
+
 func mustStartRedisContainer() (func(context.Context) error, error) {
 	dbContainer, err := redis.Run(
 		context.Background(),
@@ -29,9 +33,11 @@ func mustStartRedisContainer() (func(context.Context) error, error) {
 		return dbContainer.Terminate, err
 	}
 
-	address = dbHost
-	port = dbPort.Port()
-	database = "0"
+	testConfig = appconfig.RedisConfig{
+		Address:  dbHost,
+		Port:     dbPort.Int(),
+		Database: 0,
+	}
 
 	return dbContainer.Terminate, err
 }
@@ -50,16 +56,16 @@ func TestMain(m *testing.M) {
 }
 
 func TestNew(t *testing.T) {
-	srv := New()
+	srv := New(testConfig)
 	if srv == nil {
 		t.Fatal("New() returned nil")
 	}
 }
 
 func TestHealth(t *testing.T) {
-	srv := New()
+	srv := New(testConfig)
 
-	stats := srv.Health()
+	stats := srv.Health(context.Background())
 
 	if stats["redis_status"] != "up" {
 		t.Fatalf("expected status to be up, got %s", stats["redis_status"])
@@ -1,25 +1,28 @@
 package event
 
 import (
+	"Verve/internal/metrics"
+	"Verve/internal/requestid"
+	"Verve/internal/tracing"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
-	"os"
-	"strings"
 	"time"
 
 	"github.com/Shopify/sarama"
-)
-
-var (
-	Brokers = strings.Split(os.Getenv("event_broker"), ",") //[]string{"localhost:9092"}
-	GroupID = os.Getenv("event_group")                      // "verve-group"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Event interface {
 	Publish(ctx context.Context, topic string, message interface{}) error
 	Subscribe(ctx context.Context, topic string, handler func([]byte) error) error
+	// Ping checks that the brokers of the producer are reachable.
+	Ping(ctx context.Context) error
 	Close() error
 }
 
@@ -29,25 +32,27 @@ type KafkaConfig struct {
 }
 
 type kafkaEvent struct {
+	client   sarama.Client
 	producer sarama.SyncProducer
 	consumer sarama.ConsumerGroup
 	logger   *slog.Logger
 }
 
-func NewKafkaEvent(logger *slog.Logger) (Event, error) {
-	config := KafkaConfig{
-		Brokers: Brokers,
-		GroupID: GroupID,
-	}
+func NewKafkaEvent(config KafkaConfig, logger *slog.Logger) (Event, error) {
 	// Producer config
 	producerConfig := sarama.NewConfig()
 	producerConfig.Producer.RequiredAcks = sarama.WaitForAll
 	producerConfig.Producer.Retry.Max = 5
 	producerConfig.Producer.Return.Successes = true
 
-	// Create producer
-	producer, err := sarama.NewSyncProducer(config.Brokers, producerConfig)
+	// Create producer, its client is kept to probe the brokers
+	client, err := sarama.NewClient(config.Brokers, producerConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client: %w", err)
+	}
+	producer, err := sarama.NewSyncProducerFromClient(client)
 	if err != nil {
+		_ = client.Close()
 		return nil, fmt.Errorf("failed to create producer: %w", err)
 	}
 
@@ -59,10 +64,13 @@ func NewKafkaEvent(logger *slog.Logger) (Event, error) {
 	// Create consumer group
 	consumer, err := sarama.NewConsumerGroup(config.Brokers, config.GroupID, consumerConfig)
 	if err != nil {
+		_ = producer.Close()
+		_ = client.Close()
 		return nil, fmt.Errorf("failed to create consumer: %w", err)
 	}
 
 	return &kafkaEvent{
+		client:   client,
 		producer: producer,
 		consumer: consumer,
 		logger:   logger,
@@ -81,8 +89,25 @@ func (k *kafkaEvent) Publish(ctx context.Context, topic string, message interfac
 		Timestamp: time.Now(),
 	}
 
+	carrier := producerHeaderCarrier{msg: msg}
+	for key, value := range headersFromContext(ctx) {
+		carrier.Set(key, value)
+	}
+	if id := requestid.FromContext(ctx); id != "" {
+		carrier.Set(requestid.Header, id)
+	}
+
+	ctx, span := tracing.Tracer().Start(ctx, topic+" publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(semconv.MessagingSystemKafka, semconv.MessagingDestinationName(topic)))
+	defer span.End()
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+
 	_, _, err = k.producer.SendMessage(msg)
+	metrics.KafkaPublished.WithLabelValues(topic, metrics.Result(err)).Inc()
 	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 		return fmt.Errorf("failed to send message: %w", err)
 	}
 
@@ -108,14 +133,35 @@ func (k *kafkaEvent) Subscribe(ctx context.Context, topic string, handler func([
 	return nil
 }
 
+// Ping refreshes the cluster metadata through the producer client. sarama does
+// not take a context, so the refresh is abandoned, not cancelled, when ctx ends.
+func (k *kafkaEvent) Ping(ctx context.Context) error {
+	done := make(chan error, 1)
+	go func() { done <- k.client.RefreshMetadata() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("failed to refresh metadata: %w", err)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close closes the producer, its client and the consumer group, even when one fails.
 func (k *kafkaEvent) Close() error {
+	var errs []error
 	if err := k.producer.Close(); err != nil {
-		return fmt.Errorf("failed to close producer: %w", err)
+		errs = append(errs, fmt.Errorf("failed to close producer: %w", err))
+	}
+	if err := k.client.Close(); err != nil && !errors.Is(err, sarama.ErrClosedClient) {
+		errs = append(errs, fmt.Errorf("failed to close client: %w", err))
 	}
 	if err := k.consumer.Close(); err != nil {
-		return fmt.Errorf("failed to close consumer: %w", err)
+		errs = append(errs, fmt.Errorf("failed to close consumer: %w", err))
 	}
-	return nil
+	return errors.Join(errs...)
 }
 
 type consumerHandler struct {
@@ -127,10 +173,19 @@ func (h *consumerHandler) Setup(_ sarama.ConsumerGroupSession) error   { return
 func (h *consumerHandler) Cleanup(_ sarama.ConsumerGroupSession) error { return nil }
 func (h *consumerHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
 	for msg := range claim.Messages() {
+		// The processing span continues the trace of the producer.
+		ctx := otel.GetTextMapPropagator().Extract(session.Context(), consumerHeaderCarrier{msg: msg})
+		_, span := tracing.Tracer().Start(ctx, msg.Topic+" process",
+			trace.WithSpanKind(trace.SpanKindConsumer),
+			trace.WithAttributes(semconv.MessagingSystemKafka, semconv.MessagingDestinationName(msg.Topic)))
 		if err := h.handler(msg.Value); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			span.End()
 			h.logger.Error("Failed to process message", "error", err)
 			continue
 		}
+		span.End()
 		session.MarkMessage(msg, "")
 	}
 	return nil
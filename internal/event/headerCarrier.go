@@ -0,0 +1,85 @@
+package event
+
+import (
+	"context"
+
+	"github.com/Shopify/sarama"
+)
+
+// producerHeaderCarrier injects trace context into the headers of a produced message.
+type producerHeaderCarrier struct {
+	msg *sarama.ProducerMessage
+}
+
+func (c producerHeaderCarrier) Get(key string) string {
+	for _, header := range c.msg.Headers {
+		if string(header.Key) == key {
+			return string(header.Value)
+		}
+	}
+	return ""
+}
+
+func (c producerHeaderCarrier) Set(key, value string) {
+	for i, header := range c.msg.Headers {
+		if string(header.Key) == key {
+			c.msg.Headers[i].Value = []byte(value)
+			return
+		}
+	}
+	c.msg.Headers = append(c.msg.Headers, sarama.RecordHeader{Key: []byte(key), Value: []byte(value)})
+}
+
+func (c producerHeaderCarrier) Keys() []string {
+	keys := make([]string, 0, len(c.msg.Headers))
+	for _, header := range c.msg.Headers {
+		keys = append(keys, string(header.Key))
+	}
+	return keys
+}
+
+// consumerHeaderCarrier extracts trace context from the headers of a consumed message.
+type consumerHeaderCarrier struct {
+	msg *sarama.ConsumerMessage
+}
+
+func (c consumerHeaderCarrier) Get(key string) string {
+	for _, header := range c.msg.Headers {
+		if header != nil && string(header.Key) == key {
+			return string(header.Value)
+		}
+	}
+	return ""
+}
+
+// Set is a no-op, consumed messages are read only.
+func (c consumerHeaderCarrier) Set(key, value string) {}
+
+func (c consumerHeaderCarrier) Keys() []string {
+	keys := make([]string, 0, len(c.msg.Headers))
+	for _, header := range c.msg.Headers {
+		if header != nil {
+			keys = append(keys, string(header.Key))
+		}
+	}
+	return keys
+}
+
+type headersKey struct{}
+
+// WithHeader returns a copy of ctx whose published messages carry the header.
+func WithHeader(ctx context.Context, key, value string) context.Context {
+	previous, _ := ctx.Value(headersKey{}).(map[string]string)
+	headers := make(map[string]string, len(previous)+1)
+	for k, v := range previous {
+		headers[k] = v
+	}
+	headers[key] = value
+	return context.WithValue(ctx, headersKey{}, headers)
+}
+
+// headersFromContext returns the headers set with WithHeader.
+func headersFromContext(ctx context.Context) map[string]string {
+	headers, _ := ctx.Value(headersKey{}).(map[string]string)
+	return headers
+}
@@ -0,0 +1,127 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrPublisherPaused is returned by Publish when the publisher is paused and holds
+// as many messages as it can.
+var ErrPublisherPaused = errors.New("publisher is paused and holds too many messages")
+
+// ErrHeldMessagesLost is returned when a paused publisher is closed with messages
+// that could not be published.
+var ErrHeldMessagesLost = errors.New("held messages were lost")
+
+// DefaultMaxHeld is the number of messages a paused publisher holds before rejecting new ones.
+const DefaultMaxHeld = 10000
+
+// PublisherState describes a pausable publisher.
+type PublisherState struct {
+	Paused bool      `json:"paused"`
+	Held   int       `json:"held"`
+	Since  time.Time `json:"since,omitempty"`
+}
+
+type heldMessage struct {
+	ctx     context.Context
+	topic   string
+	message interface{}
+}
+
+// PausableEvent lets an operator pause the publishing of messages, e.g. during a
+// broker maintenance. Messages published while paused are held in memory, up to
+// maxHeld, and published in order on Resume. Subscriptions are not affected.
+type PausableEvent struct {
+	Event
+	maxHeld int
+
+	mu     sync.Mutex
+	paused bool
+	since  time.Time
+	held   []heldMessage
+}
+
+func NewPausableEvent(event Event, maxHeld int) *PausableEvent {
+	return &PausableEvent{Event: event, maxHeld: maxHeld}
+}
+
+func (p *PausableEvent) Publish(ctx context.Context, topic string, message interface{}) error {
+	p.mu.Lock()
+	if !p.paused {
+		p.mu.Unlock()
+		return p.Event.Publish(ctx, topic, message)
+	}
+	defer p.mu.Unlock()
+	if len(p.held) >= p.maxHeld {
+		return ErrPublisherPaused
+	}
+	// The message keeps the headers and trace of ctx, not its cancellation.
+	p.held = append(p.held, heldMessage{ctx: context.WithoutCancel(ctx), topic: topic, message: message})
+	return nil
+}
+
+// Pause holds the messages published from now on.
+func (p *PausableEvent) Pause() PublisherState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.paused {
+		p.paused = true
+		p.since = time.Now()
+	}
+	return p.state()
+}
+
+// Resume publishes the held messages and resumes publishing. When a held message
+// fails, it and the following ones are kept and the publisher stays paused.
+func (p *PausableEvent) Resume(ctx context.Context) (PublisherState, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for len(p.held) > 0 {
+		if err := ctx.Err(); err != nil {
+			return p.state(), err
+		}
+		held := p.held[0]
+		if err := p.Event.Publish(held.ctx, held.topic, held.message); err != nil {
+			return p.state(), fmt.Errorf("failed to publish held message: %w", err)
+		}
+		p.held = p.held[1:]
+	}
+	p.held = nil
+	p.paused = false
+	p.since = time.Time{}
+	return p.state(), nil
+}
+
+// Shutdown publishes the held messages, resuming the publisher, then closes the
+// underlying event. Held messages live in memory only: the ones that cannot be
+// published are lost, and the returned error wraps ErrHeldMessagesLost.
+func (p *PausableEvent) Shutdown(ctx context.Context) error {
+	var errs []error
+	if state, err := p.Resume(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("%w: %d messages: %w", ErrHeldMessagesLost, state.Held, err))
+	}
+	if err := p.Event.Close(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// Close is Shutdown without a deadline, so that closing a paused publisher never
+// drops its held messages silently.
+func (p *PausableEvent) Close() error {
+	return p.Shutdown(context.Background())
+}
+
+func (p *PausableEvent) State() PublisherState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.state()
+}
+
+func (p *PausableEvent) state() PublisherState {
+	return PublisherState{Paused: p.paused, Held: len(p.held), Since: p.since}
+}
@@ -0,0 +1,135 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Status is the state of a check or of the whole instance.
+type Status string
+
+const (
+	StatusUp Status = "up"
+	// StatusDegraded means a non critical dependency failed: the instance still
+	// serves requests but some work, such as publishing events, is impaired.
+	StatusDegraded Status = "degraded"
+	// StatusDown means a critical dependency failed and the instance should be
+	// taken out of rotation.
+	StatusDown Status = "down"
+)
+
+const (
+	// DefaultCacheTTL is how long a report is reused before the checks run again.
+	DefaultCacheTTL = 2 * time.Second
+	// DefaultTimeout bounds every check.
+	DefaultTimeout = 2 * time.Second
+)
+
+// Check is a dependency probe. A failing critical check makes the instance down,
+// any other failing check makes it degraded.
+type Check struct {
+	Name     string
+	Critical bool
+	Run      func(ctx context.Context) error
+}
+
+// Result is the outcome of one check.
+type Result struct {
+	Status    Status    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	Critical  bool      `json:"critical"`
+	Duration  string    `json:"duration"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// Report is the aggregated outcome of every check.
+type Report struct {
+	Status    Status            `json:"status"`
+	Checks    map[string]Result `json:"checks"`
+	CheckedAt time.Time         `json:"checked_at"`
+}
+
+// Checker runs the checks concurrently and caches the report, so that frequent
+// probes from several load balancers do not hammer the dependencies.
+type Checker struct {
+	checks  []Check
+	ttl     time.Duration
+	timeout time.Duration
+	now     func() time.Time
+
+	mu     sync.Mutex
+	report *Report
+}
+
+// NewChecker creates a checker caching reports for ttl and bounding every check by timeout.
+func NewChecker(ttl, timeout time.Duration, checks ...Check) *Checker {
+	return &Checker{
+		checks:  checks,
+		ttl:     ttl,
+		timeout: timeout,
+		now:     time.Now,
+	}
+}
+
+// Report returns the cached report, or runs the checks when it has expired.
+// Concurrent callers wait for a single run instead of starting their own. The
+// run is detached from the cancellation of ctx, as its report is shared.
+func (c *Checker) Report(ctx context.Context) Report {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.report != nil && c.now().Sub(c.report.CheckedAt) < c.ttl {
+		return *c.report
+	}
+	report := c.run(context.WithoutCancel(ctx))
+	c.report = &report
+	return report
+}
+
+func (c *Checker) run(ctx context.Context) Report {
+	results := make([]Result, len(c.checks))
+	var wg sync.WaitGroup
+	for i, check := range c.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = c.runCheck(ctx, check)
+		}()
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusUp, Checks: make(map[string]Result, len(c.checks)), CheckedAt: c.now()}
+	for i, check := range c.checks {
+		result := results[i]
+		report.Checks[check.Name] = result
+		switch {
+		case result.Status == StatusDown:
+			report.Status = StatusDown
+		case result.Status == StatusDegraded && report.Status == StatusUp:
+			report.Status = StatusDegraded
+		}
+	}
+	return report
+}
+
+func (c *Checker) runCheck(ctx context.Context, check Check) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := c.now()
+	err := check.Run(ctx)
+	result := Result{
+		Status:    StatusUp,
+		Critical:  check.Critical,
+		Duration:  time.Since(start).String(),
+		CheckedAt: start,
+	}
+	if err != nil {
+		result.Error = err.Error()
+		result.Status = StatusDegraded
+		if check.Critical {
+			result.Status = StatusDown
+		}
+	}
+	return result
+}
@@ -0,0 +1,69 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func failing(ctx context.Context) error { return errors.New("unreachable") }
+func passing(ctx context.Context) error { return nil }
+
+func TestReportStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		checks []Check
+		want   Status
+	}{
+		{"all up", []Check{{Name: "redis", Critical: true, Run: passing}, {Name: "kafka", Run: passing}}, StatusUp},
+		{"non critical failure", []Check{{Name: "redis", Critical: true, Run: passing}, {Name: "kafka", Run: failing}}, StatusDegraded},
+		{"critical failure", []Check{{Name: "redis", Critical: true, Run: failing}, {Name: "kafka", Run: failing}}, StatusDown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := NewChecker(time.Second, time.Second, tt.checks...).Report(context.Background())
+			if report.Status != tt.want {
+				t.Errorf("status = %s, want %s", report.Status, tt.want)
+			}
+			if len(report.Checks) != len(tt.checks) {
+				t.Errorf("got %d results, want %d", len(report.Checks), len(tt.checks))
+			}
+		})
+	}
+}
+
+func TestReportIsCached(t *testing.T) {
+	var runs atomic.Int32
+	now := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	checker := NewChecker(2*time.Second, time.Second, Check{Name: "redis", Run: func(ctx context.Context) error {
+		runs.Add(1)
+		return nil
+	}})
+	checker.now = func() time.Time { return now }
+
+	checker.Report(context.Background())
+	checker.Report(context.Background())
+	if got := runs.Load(); got != 1 {
+		t.Fatalf("runs = %d, want 1 within the ttl", got)
+	}
+
+	now = now.Add(2 * time.Second)
+	checker.Report(context.Background())
+	if got := runs.Load(); got != 2 {
+		t.Fatalf("runs = %d, want 2 after the ttl", got)
+	}
+}
+
+func TestCheckTimeout(t *testing.T) {
+	checker := NewChecker(time.Second, 10*time.Millisecond, Check{Name: "kafka", Run: func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}})
+
+	report := checker.Report(context.Background())
+	if got := report.Checks["kafka"]; got.Status != StatusDegraded || got.Error == "" {
+		t.Errorf("result = %+v, want degraded with the timeout error", got)
+	}
+}
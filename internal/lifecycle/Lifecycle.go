@@ -0,0 +1,117 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// DefaultStopTimeout bounds a stop hook that does not set its own timeout.
+const DefaultStopTimeout = 10 * time.Second
+
+// Hook is a subsystem managed by the lifecycle. Start and Stop are optional.
+type Hook struct {
+	Name  string
+	Start func(ctx context.Context) error
+	Stop  func(ctx context.Context) error
+	// Timeout bounds Stop; DefaultStopTimeout is used when zero.
+	Timeout time.Duration
+}
+
+// Manager starts hooks in the order they were appended and stops the started
+// ones in reverse order, so a subsystem is stopped before the ones it depends on.
+type Manager struct {
+	logger  *slog.Logger
+	mu      sync.Mutex
+	hooks   []Hook
+	started []Hook
+}
+
+func New(logger *slog.Logger) *Manager {
+	return &Manager{logger: logger}
+}
+
+// Append registers a hook; hooks appended after Start are not started.
+func (m *Manager) Append(hook Hook) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hooks = append(m.hooks, hook)
+}
+
+// Start runs the start hooks in order. When one fails, the hooks already started
+// are stopped and the start error is returned.
+func (m *Manager) Start(ctx context.Context) error {
+	m.mu.Lock()
+	if len(m.started) > 0 {
+		m.mu.Unlock()
+		return errors.New("lifecycle already started")
+	}
+	hooks := append([]Hook(nil), m.hooks...)
+	m.mu.Unlock()
+
+	for _, hook := range hooks {
+		if hook.Start != nil {
+			m.logger.Info("Starting", "hook", hook.Name)
+			if err := hook.Start(ctx); err != nil {
+				startErr := fmt.Errorf("failed to start %s: %w", hook.Name, err)
+				if stopErr := m.Stop(context.Background()); stopErr != nil {
+					return errors.Join(startErr, stopErr)
+				}
+				return startErr
+			}
+		}
+		m.mu.Lock()
+		m.started = append(m.started, hook)
+		m.mu.Unlock()
+	}
+	return nil
+}
+
+// Stop runs the stop hooks of the started hooks in reverse order, each bounded by
+// its own timeout. Every hook is stopped even when an earlier one fails; the
+// failures are joined in the returned error.
+func (m *Manager) Stop(ctx context.Context) error {
+	m.mu.Lock()
+	started := m.started
+	m.started = nil
+	m.mu.Unlock()
+
+	var errs []error
+	for i := len(started) - 1; i >= 0; i-- {
+		hook := started[i]
+		if hook.Stop == nil {
+			continue
+		}
+		m.logger.Info("Stopping", "hook", hook.Name)
+		if err := stopHook(ctx, hook); err != nil {
+			m.logger.Error("Failed to stop", "hook", hook.Name, "error", err)
+			errs = append(errs, fmt.Errorf("failed to stop %s: %w", hook.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// stopHook runs the stop hook and gives up once its timeout expires, even when
+// the hook itself ignores the context.
+func stopHook(ctx context.Context, hook Hook) error {
+	timeout := hook.Timeout
+	if timeout <= 0 {
+		timeout = DefaultStopTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- hook.Stop(ctx)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,97 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func recordingHook(name string, calls *[]string, stopErr error) Hook {
+	return Hook{
+		Name: name,
+		Start: func(ctx context.Context) error {
+			*calls = append(*calls, "start "+name)
+			return nil
+		},
+		Stop: func(ctx context.Context) error {
+			*calls = append(*calls, "stop "+name)
+			return stopErr
+		},
+	}
+}
+
+func TestStartStopOrder(t *testing.T) {
+	var calls []string
+	manager := New(slog.Default())
+	manager.Append(recordingHook("redis", &calls, nil))
+	manager.Append(recordingHook("kafka", &calls, errors.New("close failed")))
+	manager.Append(recordingHook("http", &calls, nil))
+
+	if err := manager.Start(context.Background()); err != nil {
+		t.Fatalf("unexpected start error: %v", err)
+	}
+	if err := manager.Start(context.Background()); err == nil {
+		t.Error("expected an error when starting twice")
+	}
+	err := manager.Stop(context.Background())
+	if err == nil {
+		t.Error("expected the kafka stop error")
+	}
+
+	want := []string{"start redis", "start kafka", "start http", "stop http", "stop kafka", "stop redis"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+}
+
+func TestStartFailureStopsStartedHooks(t *testing.T) {
+	var calls []string
+	manager := New(slog.Default())
+	manager.Append(recordingHook("redis", &calls, nil))
+	manager.Append(Hook{
+		Name:  "kafka",
+		Start: func(ctx context.Context) error { return errors.New("no brokers") },
+		Stop: func(ctx context.Context) error {
+			t.Error("a hook that failed to start must not be stopped")
+			return nil
+		},
+	})
+	manager.Append(recordingHook("http", &calls, nil))
+
+	if err := manager.Start(context.Background()); err == nil {
+		t.Fatal("expected a start error")
+	}
+
+	want := []string{"start redis", "stop redis"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+}
+
+func TestStopTimeout(t *testing.T) {
+	var calls []string
+	manager := New(slog.Default())
+	manager.Append(recordingHook("redis", &calls, nil))
+	manager.Append(Hook{
+		Name: "stuck",
+		Stop: func(ctx context.Context) error {
+			time.Sleep(time.Second)
+			return nil
+		},
+		Timeout: 10 * time.Millisecond,
+	})
+
+	if err := manager.Start(context.Background()); err != nil {
+		t.Fatalf("unexpected start error: %v", err)
+	}
+	err := manager.Stop(context.Background())
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected a deadline error, got %v", err)
+	}
+	if calls[len(calls)-1] != "stop redis" {
+		t.Errorf("hooks after a timed out one must still be stopped, calls = %v", calls)
+	}
+}
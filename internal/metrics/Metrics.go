@@ -0,0 +1,133 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Label values shared by the collectors.
+const (
+	ResultOk    = "ok"
+	ResultError = "error"
+
+	OutcomeDelivered = "delivered"
+	OutcomeRetried   = "retried"
+	OutcomeFailed    = "failed"
+
+	// unmatchedRoute labels requests that matched no route, to bound the cardinality.
+	unmatchedRoute = "unmatched"
+)
+
+var (
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "verve_http_requests_total",
+		Help: "HTTP requests by route pattern, method and status code.",
+	}, []string{"route", "method", "status"})
+
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "verve_http_request_duration_seconds",
+		Help:    "HTTP request latency by route pattern, method and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	RedisCommandDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "verve_redis_command_duration_seconds",
+		Help:    "Redis command latency by command and result; pipelines are labelled pipeline.",
+		Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"command", "result"})
+
+	KafkaPublished = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "verve_kafka_publish_total",
+		Help: "Kafka messages published by topic and result.",
+	}, []string{"topic", "result"})
+
+	CallbackAttempts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "verve_callback_attempts_total",
+		Help: "Callback delivery attempts by outcome: delivered, retried or failed.",
+	}, []string{"outcome"})
+)
+
+// Sources sample the state of one application instance at scrape time, a nil
+// source reads as zero.
+type Sources struct {
+	WindowCount  func() float64
+	QueueDepth   func() float64
+	DroppedTasks func() float64
+}
+
+// NewRegistry returns a registry holding the process collectors, the shared
+// counters and the gauges of the instance described by sources.
+func NewRegistry(sources Sources) *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPRequestDuration,
+		RedisCommandDuration,
+		KafkaPublished,
+		CallbackAttempts,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "verve_window_unique_count",
+			Help: "Unique ids received so far in the current window.",
+		}, sample(sources.WindowCount)),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "verve_worker_queue_depth",
+			Help: "Callback tasks waiting for a worker.",
+		}, sample(sources.QueueDepth)),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "verve_worker_dropped_total",
+			Help: "Callback tasks dropped because the worker queue was full.",
+		}, sample(sources.DroppedTasks)),
+	)
+	return registry
+}
+
+func sample(source func() float64) func() float64 {
+	if source == nil {
+		return func() float64 { return 0 }
+	}
+	return source
+}
+
+// Handler serves the registry in the Prometheus exposition format.
+func Handler(registry *prometheus.Registry) http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{Registry: registry})
+}
+
+// Result returns the result label of an error.
+func Result(err error) string {
+	if err != nil {
+		return ResultError
+	}
+	return ResultOk
+}
+
+// Middleware counts and times requests by chi route pattern, so ids in the
+// path do not create new series.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		route := unmatchedRoute
+		if routeCtx := chi.RouteContext(r.Context()); routeCtx != nil && routeCtx.RoutePattern() != "" {
+			route = routeCtx.RoutePattern()
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		labels := prometheus.Labels{"route": route, "method": r.Method, "status": strconv.Itoa(status)}
+		HTTPRequests.With(labels).Inc()
+		HTTPRequestDuration.With(labels).Observe(time.Since(start).Seconds())
+	})
+}
@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestMiddlewareLabelsByRoutePattern(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(Middleware)
+	r.Get("/api/verve/webhooks/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	for _, id := range []string{"w1", "w2"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/verve/webhooks/"+id, nil))
+	}
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/nope", nil))
+
+	if got := testutil.ToFloat64(HTTPRequests.WithLabelValues("/api/verve/webhooks/{id}", http.MethodGet, "404")); got != 2 {
+		t.Errorf("route requests = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(HTTPRequests.WithLabelValues(unmatchedRoute, http.MethodGet, "404")); got != 1 {
+		t.Errorf("unmatched requests = %v, want 1", got)
+	}
+}
+
+func TestSampledGauges(t *testing.T) {
+	first := NewRegistry(Sources{
+		WindowCount:  func() float64 { return 42 },
+		QueueDepth:   func() float64 { return 3 },
+		DroppedTasks: func() float64 { return 1 },
+	})
+	// A second instance in the same process samples its own sources.
+	second := NewRegistry(Sources{WindowCount: func() float64 { return 7 }})
+
+	tests := []struct {
+		name     string
+		registry *prometheus.Registry
+		want     []string
+	}{
+		{"first", first, []string{"verve_window_unique_count 42", "verve_worker_queue_depth 3", "verve_worker_dropped_total 1"}},
+		{"second", second, []string{"verve_window_unique_count 7", "verve_worker_queue_depth 0", "verve_worker_dropped_total 0"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			Handler(tt.registry).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+			body := w.Body.String()
+			for _, want := range tt.want {
+				if !strings.Contains(body, want) {
+					t.Errorf("missing %q in exposition", want)
+				}
+			}
+		})
+	}
+}
+
+func TestRedisResult(t *testing.T) {
+	if got := redisResult(redis.Nil); got != ResultOk {
+		t.Errorf("a missing key must not count as an error, got %s", got)
+	}
+	if got := redisResult(errors.New("connection refused")); got != ResultError {
+		t.Errorf("got %s, want %s", got, ResultError)
+	}
+}
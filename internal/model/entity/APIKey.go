@@ -0,0 +1,46 @@
+package entity
+
+import (
+	"Verve/internal/model/request"
+	"time"
+)
+
+// APIKey is the metadata of an API key. Only the SHA-256 hash of the key is
+// stored, the plaintext key is returned once, when the key is created.
+type APIKey struct {
+	Id        string    `json:"id"`
+	Name      string    `json:"name,omitempty"`
+	Namespace string    `json:"namespace,omitempty"`
+	Scopes    []string  `json:"scopes"`
+	Quota     Quota     `json:"quota"`
+	CreatedAt time.Time `json:"created_at"`
+	// Key is the plaintext key, only set in the response of its creation.
+	Key string `json:"key,omitempty"`
+}
+
+// Quota limits the requests of a key, a zero rate sets no quota.
+type Quota struct {
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+}
+
+// HasScope reports whether the key grants scope; the admin scope grants every scope.
+func (k APIKey) HasScope(scope string) bool {
+	for _, granted := range k.Scopes {
+		if granted == scope || granted == request.ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+func GetAPIKeyFromRequest(id string, apiKey request.APIKeyRequest, now time.Time) APIKey {
+	return APIKey{
+		Id:        id,
+		Name:      apiKey.Name,
+		Namespace: apiKey.Namespace,
+		Scopes:    apiKey.Scopes,
+		Quota:     Quota{Rate: apiKey.QuotaRate, Burst: apiKey.QuotaBurst},
+		CreatedAt: now,
+	}
+}
@@ -0,0 +1,38 @@
+package entity
+
+import "time"
+
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// CallbackDelivery is the persisted state of one callback to one url.
+type CallbackDelivery struct {
+	Id             string            `json:"id"`
+	SubscriptionId string            `json:"subscription_id,omitempty"`
+	Event          string            `json:"event,omitempty"`
+	Url            string            `json:"url"`
+	Method         string            `json:"method"`
+	ContentType    string            `json:"content_type"`
+	Headers        map[string]string `json:"headers,omitempty"`
+	Body           string            `json:"body"`
+	Status         string            `json:"status"`
+	Attempts       int               `json:"attempts"`
+	MaxAttempts    int               `json:"max_attempts"`
+	LastError      string            `json:"last_error,omitempty"`
+	LastStatusCode int               `json:"last_status_code,omitempty"`
+	CreatedAt      time.Time         `json:"created_at"`
+	UpdatedAt      time.Time         `json:"updated_at"`
+	NextAttemptAt  time.Time         `json:"next_attempt_at,omitempty"`
+	// Namespace is the namespace whose count the delivery carries, only the api
+	// keys of that namespace, or without one, can read it.
+	Namespace string `json:"namespace,omitempty"`
+	// WindowStart is the window whose count the delivery carries.
+	WindowStart time.Time `json:"window_start,omitempty"`
+	// TraceParent is the W3C trace context of the enqueuing operation, attempts link to it.
+	TraceParent string `json:"trace_parent,omitempty"`
+	// RequestId is the id of the request that spawned the delivery, sent in the X-Request-Id header.
+	RequestId string `json:"request_id,omitempty"`
+}
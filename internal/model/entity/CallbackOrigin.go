@@ -0,0 +1,8 @@
+package entity
+
+// CallbackOrigin is the request that registered a callback url for a window: its
+// id is sent with the callback and its namespace scopes the delivery.
+type CallbackOrigin struct {
+	RequestId string `json:"request_id,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+}
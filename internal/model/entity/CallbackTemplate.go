@@ -0,0 +1,90 @@
+package entity
+
+import (
+	"Verve/internal/model/request"
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// CallbackTemplate describes how the callbacks of a target are sent.
+type CallbackTemplate struct {
+	Url         string            `json:"url"`
+	Method      string            `json:"method"`
+	ContentType string            `json:"content_type"`
+	Fields      []string          `json:"fields"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	// Namespace is the namespace whose callbacks the template shapes, the empty
+	// string is the default namespace.
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// DefaultCallbackTemplate keeps the original `{"count": N}` JSON POST.
+func DefaultCallbackTemplate(url string) CallbackTemplate {
+	return CallbackTemplate{
+		Url:         url,
+		Method:      "POST",
+		ContentType: request.ContentTypeJSON,
+		Fields:      []string{request.FieldCount},
+	}
+}
+
+func GetTemplateFromRequest(template request.CallbackTemplateRequest) CallbackTemplate {
+	return CallbackTemplate{
+		Url:         template.Url,
+		Method:      template.Method,
+		ContentType: template.ContentType,
+		Fields:      template.Fields,
+		Headers:     template.Headers,
+	}
+}
+
+// CallbackPayload holds every value a callback can carry.
+type CallbackPayload struct {
+	Count       int64
+	WindowStart time.Time
+	WindowEnd   time.Time
+	Namespace   string
+	Timestamp   time.Time
+	Approximate bool
+}
+
+// Render encodes the template fields of the payload and returns the body along with its MIME type.
+func (t CallbackTemplate) Render(payload CallbackPayload) ([]byte, string, error) {
+	values := make(map[string]interface{}, len(t.Fields))
+	for _, field := range t.Fields {
+		switch field {
+		case request.FieldCount:
+			values[field] = payload.Count
+		case request.FieldWindowStart:
+			values[field] = payload.WindowStart.UTC().Format(time.RFC3339)
+		case request.FieldWindowEnd:
+			values[field] = payload.WindowEnd.UTC().Format(time.RFC3339)
+		case request.FieldNamespace:
+			values[field] = payload.Namespace
+		case request.FieldTimestamp:
+			values[field] = payload.Timestamp.UTC().Format(time.RFC3339)
+		case request.FieldApproximate:
+			values[field] = payload.Approximate
+		}
+	}
+
+	if t.ContentType == request.ContentTypeForm {
+		form := url.Values{}
+		for field, value := range values {
+			switch v := value.(type) {
+			case int64:
+				form.Set(field, strconv.FormatInt(v, 10))
+			case string:
+				form.Set(field, v)
+			case bool:
+				form.Set(field, strconv.FormatBool(v))
+			}
+		}
+		return []byte(form.Encode()), "application/x-www-form-urlencoded", nil
+	}
+
+	body, err := json.Marshal(values)
+	return body, "application/json", err
+}
@@ -3,11 +3,31 @@ package entity
 import "Verve/internal/model/request"
 
 type VerveEntity struct {
-	Id string `json:"id"`
+	Id        string `json:"id"`
+	Namespace string `json:"namespace,omitempty"`
 }
 
 func GetEntityFromRequest(request request.VerveRequest) VerveEntity {
 	return VerveEntity{
-		Id: request.Id,
+		Id:        request.Id,
+		Namespace: request.Namespace,
 	}
 }
+
+func GetEntitiesFromRequests(requests []request.VerveRequest) []VerveEntity {
+	entities := make([]VerveEntity, 0, len(requests))
+	for _, request := range requests {
+		entities = append(entities, GetEntityFromRequest(request))
+	}
+	return entities
+}
+
+// TotalCount sums unique counts keyed by namespace, the count of a window across
+// every namespace.
+func TotalCount(counts map[string]int64) int64 {
+	var total int64
+	for _, count := range counts {
+		total += count
+	}
+	return total
+}
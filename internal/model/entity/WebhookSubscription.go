@@ -0,0 +1,46 @@
+package entity
+
+import (
+	"Verve/internal/model/request"
+	"time"
+)
+
+// WebhookSubscription is a target registered to receive the events of a namespace.
+type WebhookSubscription struct {
+	Id        string           `json:"id"`
+	Namespace string           `json:"namespace"`
+	Secret    string           `json:"secret,omitempty"`
+	Events    []string         `json:"events"`
+	Template  CallbackTemplate `json:"template"`
+	CreatedAt time.Time        `json:"created_at"`
+}
+
+// Matches reports whether the subscription wants the event; an empty filter matches every event.
+func (s WebhookSubscription) Matches(event string) bool {
+	if len(s.Events) == 0 {
+		return true
+	}
+	for _, e := range s.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Redacted returns a copy without the secret, for listing.
+func (s WebhookSubscription) Redacted() WebhookSubscription {
+	s.Secret = ""
+	return s
+}
+
+func GetSubscriptionFromRequest(id string, webhook request.WebhookRequest, now time.Time) WebhookSubscription {
+	return WebhookSubscription{
+		Id:        id,
+		Namespace: webhook.Namespace,
+		Secret:    webhook.Secret,
+		Events:    webhook.Events,
+		Template:  GetTemplateFromRequest(webhook.CallbackTemplateRequest),
+		CreatedAt: now,
+	}
+}
@@ -0,0 +1,87 @@
+package request
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// API key scopes. The admin scope grants every other scope.
+const (
+	ScopeAccept    = "accept"
+	ScopeCallbacks = "callbacks"
+	ScopeWebhooks  = "webhooks"
+	ScopeAdmin     = "admin"
+)
+
+// APIKeyScopes lists the scopes a key can be granted.
+var APIKeyScopes = []string{ScopeAccept, ScopeCallbacks, ScopeWebhooks, ScopeAdmin}
+
+// maxKeyNameLength bounds the free form name of a key.
+const maxKeyNameLength = 128
+
+// APIKeyRequest creates an API key. A key bound to a namespace can only write ids
+// into that namespace; a key without a namespace is not restricted.
+type APIKeyRequest struct {
+	Name      string   `json:"name"`
+	Namespace string   `json:"namespace"`
+	Scopes    []string `json:"scopes"`
+	// QuotaRate and QuotaBurst limit the requests of the key across every route,
+	// a zero rate sets no quota.
+	QuotaRate  float64 `json:"quota_rate"`
+	QuotaBurst int     `json:"quota_burst"`
+}
+
+func DecodeAPIKey(w http.ResponseWriter, r *http.Request) (*APIKeyRequest, error) {
+	var apiKey APIKeyRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&apiKey); err != nil {
+		return nil, fmt.Errorf("invalid request body: %w", err)
+	}
+	return &apiKey, nil
+}
+
+// Validate checks the key and fills in the defaults: the accept scope, and a
+// burst of one second of requests when only the quota rate is set.
+func (k *APIKeyRequest) Validate(ctx context.Context) error {
+	if len(k.Name) > maxKeyNameLength {
+		return &ValidationError{
+			Field:   "name",
+			Rule:    RuleTooLong,
+			Message: fmt.Sprintf("name must be at most %d characters", maxKeyNameLength),
+		}
+	}
+	if k.Namespace != "" && !namespacePattern.MatchString(k.Namespace) {
+		return &ValidationError{
+			Field:   "namespace",
+			Rule:    RuleInvalidFormat,
+			Message: fmt.Sprintf("namespace must match %s", namespacePattern.String()),
+		}
+	}
+	if len(k.Scopes) == 0 {
+		k.Scopes = []string{ScopeAccept}
+	}
+	for _, scope := range k.Scopes {
+		if !contains(APIKeyScopes, scope) {
+			return &ValidationError{
+				Field:   "scopes",
+				Rule:    RuleInvalidFormat,
+				Message: fmt.Sprintf("unknown scope %q, expected one of %s", scope, strings.Join(APIKeyScopes, ", ")),
+			}
+		}
+	}
+	if k.QuotaRate < 0 || k.QuotaBurst < 0 {
+		return &ValidationError{
+			Field:   "quota_rate",
+			Rule:    RuleInvalidFormat,
+			Message: "quota_rate and quota_burst must not be negative",
+		}
+	}
+	if k.QuotaRate > 0 && k.QuotaBurst == 0 {
+		k.QuotaBurst = max(int(k.QuotaRate), 1)
+	}
+	return nil
+}
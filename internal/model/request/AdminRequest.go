@@ -0,0 +1,58 @@
+package request
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+)
+
+// LogLevelRequest changes the log level of a running instance.
+type LogLevelRequest struct {
+	// Level is a slog level name, such as debug, info, warn or error.
+	Level string `json:"level"`
+
+	level slog.Level
+}
+
+func DecodeLogLevel(w http.ResponseWriter, r *http.Request) (*LogLevelRequest, error) {
+	var logLevel LogLevelRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&logLevel); err != nil {
+		return nil, fmt.Errorf("invalid request body: %w", err)
+	}
+	return &logLevel, nil
+}
+
+func (l *LogLevelRequest) Validate(ctx context.Context) error {
+	if l.Level == "" {
+		return &ValidationError{Field: "level", Rule: RuleMissing, Message: "level is required"}
+	}
+	if err := l.level.UnmarshalText([]byte(l.Level)); err != nil {
+		return &ValidationError{
+			Field:   "level",
+			Rule:    RuleInvalidFormat,
+			Message: fmt.Sprintf("unknown level %q, expected debug, info, warn or error", l.Level),
+		}
+	}
+	return nil
+}
+
+// SlogLevel returns the validated level.
+func (l *LogLevelRequest) SlogLevel() slog.Level {
+	return l.level
+}
+
+// ValidateNamespace checks a namespace taken from a path parameter.
+func ValidateNamespace(namespace string) error {
+	if !namespacePattern.MatchString(namespace) {
+		return &ValidationError{
+			Field:   "namespace",
+			Rule:    RuleInvalidFormat,
+			Message: fmt.Sprintf("namespace must match %s", namespacePattern.String()),
+		}
+	}
+	return nil
+}
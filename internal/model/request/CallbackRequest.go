@@ -0,0 +1,38 @@
+package request
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// DeliveryQuery looks up the callback deliveries sent to a url for a window, so
+// that a partner can find out what happened to a notification it did not get.
+type DeliveryQuery struct {
+	Url string
+	// Window is the start of the one minute window, any time within it is accepted.
+	Window time.Time
+}
+
+// ParseDeliveryQuery reads the url and window query parameters; the window is an
+// RFC 3339 time. Failures are returned as *ValidationError.
+func ParseDeliveryQuery(r *http.Request) (*DeliveryQuery, error) {
+	query := r.URL.Query()
+	url := query.Get("url")
+	if url == "" {
+		return nil, &ValidationError{Field: "url", Rule: RuleMissing, Message: "url is required"}
+	}
+	rawWindow := query.Get("window")
+	if rawWindow == "" {
+		return nil, &ValidationError{Field: "window", Rule: RuleMissing, Message: "window is required"}
+	}
+	window, err := time.Parse(time.RFC3339, rawWindow)
+	if err != nil {
+		return nil, &ValidationError{
+			Field:   "window",
+			Rule:    RuleInvalidFormat,
+			Message: fmt.Sprintf("window must be an RFC 3339 time, got %q", rawWindow),
+		}
+	}
+	return &DeliveryQuery{Url: url, Window: window.UTC().Truncate(time.Minute)}, nil
+}
@@ -0,0 +1,126 @@
+package request
+
+import (
+	urlpolicy "Verve/internal/configs/urlPolicy"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	ContentTypeJSON = "json"
+	ContentTypeForm = "form"
+
+	FieldCount       = "count"
+	FieldWindowStart = "window_start"
+	FieldWindowEnd   = "window_end"
+	FieldNamespace   = "namespace"
+	FieldTimestamp   = "timestamp"
+	// FieldApproximate is true when the count includes ids accepted in degraded mode.
+	FieldApproximate = "approximate"
+)
+
+// CallbackFields lists the payload fields a template may include.
+var CallbackFields = []string{FieldCount, FieldWindowStart, FieldWindowEnd, FieldNamespace, FieldTimestamp, FieldApproximate}
+
+// reservedHeaders are set by the service on every callback and cannot be overridden.
+var reservedHeaders = []string{
+	"Content-Type",
+	"Content-Length",
+	"Host",
+	"X-Verve-Signature",
+	"X-Verve-Timestamp",
+	"X-Verve-Delivery-Id",
+	"X-Verve-Delivery-Attempt",
+	"X-Verve-Event",
+}
+
+type CallbackTemplateRequest struct {
+	Url         string            `json:"url"`
+	Method      string            `json:"method"`
+	ContentType string            `json:"content_type"`
+	Fields      []string          `json:"fields"`
+	Headers     map[string]string `json:"headers"`
+}
+
+func DecodeCallbackTemplate(w http.ResponseWriter, r *http.Request) (*CallbackTemplateRequest, error) {
+	var template CallbackTemplateRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&template); err != nil {
+		return nil, fmt.Errorf("invalid request body: %w", err)
+	}
+	return &template, nil
+}
+
+// Validate checks the template against the callback url policy and fills in the
+// defaults: a JSON POST of the count. Failures are returned as *ValidationError.
+func (c *CallbackTemplateRequest) Validate(ctx context.Context, urls *urlpolicy.Policy) error {
+	if c.Url == "" {
+		return &ValidationError{Field: "url", Rule: RuleMissing, Message: "url is required"}
+	}
+	if err := urls.ValidateURL(ctx, c.Url); err != nil {
+		return urlValidationError(err)
+	}
+
+	c.Method = strings.ToUpper(c.Method)
+	switch c.Method {
+	case "":
+		c.Method = http.MethodPost
+	case http.MethodPost, http.MethodPut:
+	default:
+		return &ValidationError{Field: "method", Rule: RuleInvalidFormat, Message: "method must be POST or PUT"}
+	}
+
+	c.ContentType = strings.ToLower(c.ContentType)
+	switch c.ContentType {
+	case "":
+		c.ContentType = ContentTypeJSON
+	case ContentTypeJSON, ContentTypeForm:
+	default:
+		return &ValidationError{Field: "content_type", Rule: RuleInvalidFormat, Message: "content_type must be json or form"}
+	}
+
+	if len(c.Fields) == 0 {
+		c.Fields = []string{FieldCount}
+	}
+	seen := make(map[string]bool, len(c.Fields))
+	fields := make([]string, 0, len(c.Fields))
+	for _, field := range c.Fields {
+		if !contains(CallbackFields, field) {
+			return &ValidationError{
+				Field:   "fields",
+				Rule:    RuleInvalidFormat,
+				Message: fmt.Sprintf("unknown field %q, expected one of %s", field, strings.Join(CallbackFields, ", ")),
+			}
+		}
+		if !seen[field] {
+			seen[field] = true
+			fields = append(fields, field)
+		}
+	}
+	c.Fields = fields
+
+	for name := range c.Headers {
+		if name == "" || strings.ContainsAny(name, " :\r\n") {
+			return &ValidationError{Field: "headers", Rule: RuleInvalidFormat, Message: fmt.Sprintf("invalid header name %q", name)}
+		}
+		for _, reserved := range reservedHeaders {
+			if strings.EqualFold(name, reserved) {
+				return &ValidationError{Field: "headers", Rule: RuleInvalidFormat, Message: fmt.Sprintf("header %q cannot be overridden", name)}
+			}
+		}
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
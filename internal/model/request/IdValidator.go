@@ -0,0 +1,125 @@
+package request
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type IdFormat string
+
+const (
+	// IdFormatInt64 accepts base 10 integers that fit in an int64, as required by the spec.
+	IdFormatInt64 IdFormat = "int64"
+	// IdFormatUUID accepts canonical 8-4-4-4-12 hex UUIDs.
+	IdFormatUUID IdFormat = "uuid"
+	// IdFormatFree accepts any non-empty string up to the configured max length.
+	IdFormatFree IdFormat = "free"
+)
+
+// ValidationRule names the rule a field failed, it is stable and safe to expose to clients.
+type ValidationRule string
+
+const (
+	RuleMissing       ValidationRule = "missing"
+	RuleNotInteger    ValidationRule = "not_integer"
+	RuleOutOfRange    ValidationRule = "out_of_range"
+	RuleTooLong       ValidationRule = "too_long"
+	RuleNotUUID       ValidationRule = "not_uuid"
+	RuleInvalidFormat ValidationRule = "invalid_format"
+)
+
+// ValidationError reports which rule a request field failed.
+type ValidationError struct {
+	Field   string
+	Rule    ValidationRule
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+// Is matches any ValidationError with the same field and rule, so that the
+// sentinel errors below can be used with errors.Is.
+func (e *ValidationError) Is(target error) bool {
+	t, ok := target.(*ValidationError)
+	if !ok {
+		return false
+	}
+	return e.Field == t.Field && e.Rule == t.Rule
+}
+
+// Code returns the "field.rule" identifier of the error.
+func (e *ValidationError) Code() string {
+	return fmt.Sprintf("%s.%s", e.Field, e.Rule)
+}
+
+var (
+	ErrIdMissing    = &ValidationError{Field: "id", Rule: RuleMissing, Message: "id parameter is required"}
+	ErrIdNotInteger = &ValidationError{Field: "id", Rule: RuleNotInteger, Message: "id must be an integer"}
+	ErrIdOutOfRange = &ValidationError{Field: "id", Rule: RuleOutOfRange, Message: "id is out of range"}
+	ErrIdTooLong    = &ValidationError{Field: "id", Rule: RuleTooLong, Message: "id is too long"}
+	ErrIdNotUUID    = &ValidationError{Field: "id", Rule: RuleNotUUID, Message: "id must be a UUID"}
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// IdValidator validates and normalizes ids according to the configured format.
+type IdValidator struct {
+	Format    IdFormat
+	MaxLength int
+}
+
+const defaultIdMaxLength = 64
+
+// NewIdValidator builds a validator for the given format; an empty format defaults to int64.
+func NewIdValidator(format IdFormat, maxLength int) (IdValidator, error) {
+	if format == "" {
+		format = IdFormatInt64
+	}
+	switch format {
+	case IdFormatInt64, IdFormatUUID, IdFormatFree:
+	default:
+		return IdValidator{}, fmt.Errorf("unknown id format %q", format)
+	}
+	if maxLength <= 0 {
+		maxLength = defaultIdMaxLength
+	}
+	return IdValidator{
+		Format:    format,
+		MaxLength: maxLength,
+	}, nil
+}
+
+// Normalize validates the id and returns its canonical form, so that "007" and "7"
+// deduplicate to the same integer id.
+func (v IdValidator) Normalize(id string) (string, error) {
+	if id == "" {
+		return "", ErrIdMissing
+	}
+	if len(id) > v.MaxLength {
+		return "", ErrIdTooLong
+	}
+
+	switch v.Format {
+	case IdFormatUUID:
+		if !uuidPattern.MatchString(id) {
+			return "", ErrIdNotUUID
+		}
+		return strings.ToLower(id), nil
+	case IdFormatFree:
+		return id, nil
+	default:
+		num, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			if errors.Is(err, strconv.ErrRange) {
+				return "", ErrIdOutOfRange
+			}
+			return "", ErrIdNotInteger
+		}
+		return strconv.FormatInt(num, 10), nil
+	}
+}
@@ -0,0 +1,53 @@
+package request
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestIdValidatorNormalize(t *testing.T) {
+	int64Validator, _ := NewIdValidator(IdFormatInt64, 0)
+	uuidValidator, _ := NewIdValidator(IdFormatUUID, 0)
+	freeValidator, _ := NewIdValidator(IdFormatFree, 8)
+
+	tests := []struct {
+		name      string
+		validator IdValidator
+		id        string
+		want      string
+		wantErr   error
+	}{
+		{"int64 valid", int64Validator, "123", "123", nil},
+		{"int64 leading zeros", int64Validator, "007", "7", nil},
+		{"int64 missing", int64Validator, "", "", ErrIdMissing},
+		{"int64 not integer", int64Validator, "abc", "", ErrIdNotInteger},
+		{"int64 overflow", int64Validator, "9223372036854775808", "", ErrIdOutOfRange},
+		{"int64 negative", int64Validator, "-1", "-1", nil},
+		{"int64 negative leading zeros", int64Validator, "-007", "-7", nil},
+		{"int64 underflow", int64Validator, "-9223372036854775809", "", ErrIdOutOfRange},
+		{"int64 too long", int64Validator, strings.Repeat("1", 65), "", ErrIdTooLong},
+		{"uuid valid", uuidValidator, "3F2504E0-4F89-11D3-9A0C-0305E82C3301", "3f2504e0-4f89-11d3-9a0c-0305e82c3301", nil},
+		{"uuid invalid", uuidValidator, "123", "", ErrIdNotUUID},
+		{"free valid", freeValidator, "prateek", "prateek", nil},
+		{"free too long", freeValidator, "prateek-verve", "", ErrIdTooLong},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.validator.Normalize(tt.id)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if got != tt.want {
+				t.Errorf("expected id %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestNewIdValidatorUnknownFormat(t *testing.T) {
+	if _, err := NewIdValidator("hex", 0); err == nil {
+		t.Fatal("expected error for unknown id format")
+	}
+}
@@ -1,26 +1,152 @@
 package request
 
 import (
+	urlpolicy "Verve/internal/configs/urlPolicy"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"regexp"
 )
 
+// MaxBatchSize is the maximum number of items accepted in a single POST body.
+const MaxBatchSize = 1000
+
+// maxBodyBytes bounds the size of a POST body before it is decoded.
+const maxBodyBytes = 1 << 20
+
+var namespacePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
 type VerveRequest struct {
-	Id  string `json:"id"`
-	Url string `json:"url"`
+	Id        string `json:"id"`
+	Url       string `json:"url"`
+	Namespace string `json:"namespace"`
+}
+
+// UnmarshalJSON accepts the id either as a JSON string or as a JSON number.
+func (v *VerveRequest) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Id        json.RawMessage `json:"id"`
+		Url       string          `json:"url"`
+		Namespace string          `json:"namespace"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	id, err := decodeId(raw.Id)
+	if err != nil {
+		return err
+	}
+
+	v.Id = id
+	v.Url = raw.Url
+	v.Namespace = raw.Namespace
+	return nil
 }
 
-func SanitizeUrlParams(r *http.Request) (*VerveRequest, error) {
+func decodeId(raw json.RawMessage) (string, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return "", nil
+	}
+	if raw[0] == '"' {
+		var id string
+		if err := json.Unmarshal(raw, &id); err != nil {
+			return "", err
+		}
+		return id, nil
+	}
+	var id json.Number
+	if err := json.Unmarshal(raw, &id); err != nil {
+		return "", fmt.Errorf("id must be a string or a number")
+	}
+	return id.String(), nil
+}
+
+// Validate checks the fields of the request and normalizes the id in place.
+// The url, when present, is checked against the callback url policy, which
+// resolves its host, once per host under a urlpolicy.WithResolveCache context.
+// Failures are returned as *ValidationError.
+func (v *VerveRequest) Validate(ctx context.Context, ids IdValidator, urls *urlpolicy.Policy) error {
+	id, err := ids.Normalize(v.Id)
+	if err != nil {
+		return err
+	}
+	if v.Namespace != "" && !namespacePattern.MatchString(v.Namespace) {
+		return &ValidationError{
+			Field:   "namespace",
+			Rule:    RuleInvalidFormat,
+			Message: fmt.Sprintf("namespace must match %s", namespacePattern.String()),
+		}
+	}
+	if v.Url != "" {
+		if err := urls.ValidateURL(ctx, v.Url); err != nil {
+			return urlValidationError(err)
+		}
+	}
+	v.Id = id
+	return nil
+}
+
+func urlValidationError(err error) *ValidationError {
+	var violation *urlpolicy.Violation
+	if errors.As(err, &violation) {
+		return &ValidationError{Field: "url", Rule: ValidationRule(violation.Rule), Message: violation.Message}
+	}
+	return &ValidationError{Field: "url", Rule: RuleInvalidFormat, Message: err.Error()}
+}
+
+func SanitizeUrlParams(r *http.Request, ids IdValidator, urls *urlpolicy.Policy) (*VerveRequest, error) {
 	query := r.URL.Query()
-	id := query.Get("id")
-	url := query.Get("url")
+	request := &VerveRequest{
+		Id:  query.Get("id"),
+		Url: query.Get("url"),
+	}
+
+	if err := request.Validate(r.Context(), ids, urls); err != nil {
+		return nil, err
+	}
 
-	if id == "" {
-		return nil, fmt.Errorf("id parameter is required")
+	return request, nil
+}
+
+// DecodeAcceptBody decodes a POST body holding either a single request object
+// or an array of them. Items are not validated here, so that the caller can
+// report a result for every item.
+func DecodeAcceptBody(w http.ResponseWriter, r *http.Request) ([]VerveRequest, error) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body: %w", err)
+	}
+
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return nil, fmt.Errorf("request body is empty")
+	}
+
+	var requests []VerveRequest
+	if body[0] == '[' {
+		if err := json.Unmarshal(body, &requests); err != nil {
+			return nil, fmt.Errorf("invalid request body: %w", err)
+		}
+	} else {
+		var single VerveRequest
+		if err := json.Unmarshal(body, &single); err != nil {
+			return nil, fmt.Errorf("invalid request body: %w", err)
+		}
+		requests = append(requests, single)
+	}
+
+	if len(requests) == 0 {
+		return nil, fmt.Errorf("request body contains no items")
+	}
+	if len(requests) > MaxBatchSize {
+		return nil, fmt.Errorf("request body contains %d items, maximum is %d", len(requests), MaxBatchSize)
 	}
 
-	return &VerveRequest{
-		Id:  id,
-		Url: url,
-	}, nil
+	return requests, nil
 }
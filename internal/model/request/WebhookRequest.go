@@ -0,0 +1,69 @@
+package request
+
+import (
+	urlpolicy "Verve/internal/configs/urlPolicy"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// EventUniqueCountRollup is sent with the finalized unique count of a namespace when a window closes.
+const EventUniqueCountRollup = "unique_count.rollup"
+
+// WebhookEvents lists the events a subscription can filter on.
+var WebhookEvents = []string{EventUniqueCountRollup}
+
+// minSecretLength is the shortest accepted signing secret.
+const minSecretLength = 16
+
+// WebhookRequest registers a subscription; the template fields describe how its callbacks are sent.
+type WebhookRequest struct {
+	CallbackTemplateRequest
+	Namespace string   `json:"namespace"`
+	Secret    string   `json:"secret"`
+	Events    []string `json:"events"`
+}
+
+func DecodeWebhook(w http.ResponseWriter, r *http.Request) (*WebhookRequest, error) {
+	var webhook WebhookRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&webhook); err != nil {
+		return nil, fmt.Errorf("invalid request body: %w", err)
+	}
+	return &webhook, nil
+}
+
+// Validate checks the subscription and fills in the template defaults. An empty
+// secret is allowed, the service then generates one.
+func (w *WebhookRequest) Validate(ctx context.Context, urls *urlpolicy.Policy) error {
+	if err := w.CallbackTemplateRequest.Validate(ctx, urls); err != nil {
+		return err
+	}
+	if w.Namespace != "" && !namespacePattern.MatchString(w.Namespace) {
+		return &ValidationError{
+			Field:   "namespace",
+			Rule:    RuleInvalidFormat,
+			Message: fmt.Sprintf("namespace must match %s", namespacePattern.String()),
+		}
+	}
+	if w.Secret != "" && len(w.Secret) < minSecretLength {
+		return &ValidationError{
+			Field:   "secret",
+			Rule:    RuleInvalidFormat,
+			Message: fmt.Sprintf("secret must be at least %d characters", minSecretLength),
+		}
+	}
+	for _, event := range w.Events {
+		if !contains(WebhookEvents, event) {
+			return &ValidationError{
+				Field:   "events",
+				Rule:    RuleInvalidFormat,
+				Message: fmt.Sprintf("unknown event %q, expected one of %s", event, strings.Join(WebhookEvents, ", ")),
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+package response
+
+const (
+	StatusOk     = "ok"
+	StatusFailed = "failed"
+)
+
+// AcceptResult is the outcome of a single item of a POST accept call.
+type AcceptResult struct {
+	Id     string `json:"id"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	Code   string `json:"code,omitempty"`
+}
+
+type AcceptResponse struct {
+	Results []AcceptResult `json:"results"`
+}
+
+// StatusResponse is the JSON form of the legacy plaintext ok body.
+type StatusResponse struct {
+	Status string `json:"status"`
+}
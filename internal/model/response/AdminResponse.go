@@ -0,0 +1,6 @@
+package response
+
+// LogLevelResponse reports the log level of an instance.
+type LogLevelResponse struct {
+	Level string `json:"level"`
+}
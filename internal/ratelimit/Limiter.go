@@ -0,0 +1,180 @@
+package ratelimit
+
+import (
+	"Verve/internal/database"
+	"context"
+	"log/slog"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Limit allows Rate requests per second on average and bursts of up to Burst requests.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Enabled reports whether the limit restricts anything; a zero limit lets everything through.
+func (l Limit) Enabled() bool {
+	return l.Rate > 0 && l.Burst > 0
+}
+
+// emission is the time one request adds to the bucket.
+func (l Limit) emission() time.Duration {
+	return time.Duration(float64(time.Second) / l.Rate)
+}
+
+// tolerance is how far ahead of now the bucket may run before requests are denied.
+func (l Limit) tolerance() time.Duration {
+	return l.emission() * time.Duration(l.Burst)
+}
+
+// Result is the decision of a limiter for one request.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// RetryAfter is how long a denied client has to wait for its next request.
+	RetryAfter time.Duration
+	// ResetAfter is how long until the bucket is full again.
+	ResetAfter time.Duration
+}
+
+// Limiter takes one request from the bucket of key. Both implementations use the
+// generic cell rate algorithm (GCRA): a bucket is a single theoretical arrival
+// time, so there is no refill to schedule.
+type Limiter interface {
+	Allow(ctx context.Context, key string, limit Limit) (Result, error)
+	// AllowN takes one request from the bucket of every key, in order, and returns
+	// one result per key; a key listed twice takes two requests.
+	AllowN(ctx context.Context, keys []string, limit Limit) ([]Result, error)
+}
+
+// gcra applies a request to the theoretical arrival time tat and returns the
+// decision along with the new tat, which is unchanged when the request is denied.
+func gcra(now, tat time.Time, limit Limit) (Result, time.Time) {
+	if tat.Before(now) {
+		tat = now
+	}
+	newTat := tat.Add(limit.emission())
+	allowAt := newTat.Add(-limit.tolerance())
+	if now.Before(allowAt) {
+		return Result{
+			Allowed:    false,
+			Limit:      limit.Burst,
+			RetryAfter: allowAt.Sub(now),
+			ResetAfter: tat.Sub(now),
+		}, tat
+	}
+	resetAfter := newTat.Sub(now)
+	return Result{
+		Allowed:    true,
+		Limit:      limit.Burst,
+		Remaining:  int((limit.tolerance() - resetAfter) / limit.emission()),
+		ResetAfter: resetAfter,
+	}, newTat
+}
+
+// sweepEvery is how often the local limiter forgets the buckets that are full again.
+const sweepEvery = time.Minute
+
+// LocalLimiter keeps the buckets in memory. Its limits apply per instance.
+type LocalLimiter struct {
+	now func() time.Time
+
+	mu        sync.Mutex
+	tats      map[string]time.Time
+	lastSweep time.Time
+}
+
+func NewLocalLimiter() *LocalLimiter {
+	return &LocalLimiter{
+		now:  time.Now,
+		tats: make(map[string]time.Time),
+	}
+}
+
+func (l *LocalLimiter) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	results, err := l.AllowN(ctx, []string{key}, limit)
+	if err != nil {
+		return Result{}, err
+	}
+	return results[0], nil
+}
+
+func (l *LocalLimiter) AllowN(ctx context.Context, keys []string, limit Limit) ([]Result, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Sub(l.lastSweep) >= sweepEvery {
+		for bucket, tat := range l.tats {
+			if tat.Before(now) {
+				delete(l.tats, bucket)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	results := make([]Result, len(keys))
+	for i, key := range keys {
+		var tat time.Time
+		results[i], tat = gcra(now, l.tats[key], limit)
+		l.tats[key] = tat
+	}
+	return results, nil
+}
+
+// FallbackLimiter uses the primary limiter, shared by every replica, and the
+// fallback limiter while Redis is unreachable.
+type FallbackLimiter struct {
+	primary  Limiter
+	fallback Limiter
+	logger   *slog.Logger
+	degraded atomic.Bool
+}
+
+func NewFallbackLimiter(primary, fallback Limiter, logger *slog.Logger) *FallbackLimiter {
+	return &FallbackLimiter{primary: primary, fallback: fallback, logger: logger}
+}
+
+func (l *FallbackLimiter) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	result, err := l.primary.Allow(ctx, key, limit)
+	if !l.useFallback(err) {
+		return result, err
+	}
+	return l.fallback.Allow(ctx, key, limit)
+}
+
+func (l *FallbackLimiter) AllowN(ctx context.Context, keys []string, limit Limit) ([]Result, error) {
+	results, err := l.primary.AllowN(ctx, keys, limit)
+	if !l.useFallback(err) {
+		return results, err
+	}
+	return l.fallback.AllowN(ctx, keys, limit)
+}
+
+// useFallback reports whether the primary limiter failed because Redis is
+// unreachable, and logs when the limiter switches between the two.
+func (l *FallbackLimiter) useFallback(err error) bool {
+	if err == nil {
+		if l.degraded.CompareAndSwap(true, false) {
+			l.logger.Info("Rate limiter is back to Redis")
+		}
+		return false
+	}
+	if !database.IsUnavailable(err) {
+		return false
+	}
+	if l.degraded.CompareAndSwap(false, true) {
+		l.logger.Warn("Redis is unreachable, rate limits apply per instance", "error", err)
+	}
+	return true
+}
+
+// seconds rounds a duration up to whole seconds, as used by the rate limit headers.
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,171 @@
+package ratelimit
+
+import (
+	"Verve/internal/auth"
+	e "Verve/internal/configs/errorResponse"
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestLocalLimiter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	limiter := NewLocalLimiter()
+	limiter.now = func() time.Time { return now }
+	limit := Limit{Rate: 1, Burst: 2}
+
+	for i, wantRemaining := range []int{1, 0} {
+		result, _ := limiter.Allow(context.Background(), "client", limit)
+		if !result.Allowed || result.Remaining != wantRemaining {
+			t.Fatalf("request %d = %+v, want allowed with %d remaining", i, result, wantRemaining)
+		}
+	}
+
+	result, _ := limiter.Allow(context.Background(), "client", limit)
+	if result.Allowed || result.RetryAfter != time.Second {
+		t.Fatalf("request over the burst = %+v, want denied for 1s", result)
+	}
+	if other, _ := limiter.Allow(context.Background(), "other", limit); !other.Allowed {
+		t.Fatalf("buckets are not per key")
+	}
+
+	now = now.Add(time.Second)
+	if result, _ := limiter.Allow(context.Background(), "client", limit); !result.Allowed {
+		t.Fatalf("request after the retry delay = %+v, want allowed", result)
+	}
+}
+
+func TestLocalLimiterAllowN(t *testing.T) {
+	now := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	limiter := NewLocalLimiter()
+	limiter.now = func() time.Time { return now }
+	limit := Limit{Rate: 1, Burst: 2}
+
+	results, err := limiter.AllowN(context.Background(), []string{"a", "b", "a", "a"}, limit)
+	if err != nil {
+		t.Fatalf("AllowN returned %v", err)
+	}
+	allowed := make([]bool, len(results))
+	for i, result := range results {
+		allowed[i] = result.Allowed
+	}
+	if want := []bool{true, true, true, false}; !slices.Equal(allowed, want) {
+		t.Fatalf("allowed = %v, want %v", allowed, want)
+	}
+	if result, _ := limiter.Allow(context.Background(), "b", limit); !result.Allowed || result.Remaining != 0 {
+		t.Fatalf("the batch must share the buckets of Allow, got %+v", result)
+	}
+}
+
+type failingLimiter struct{ err error }
+
+func (l failingLimiter) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	return Result{}, l.err
+}
+
+func (l failingLimiter) AllowN(ctx context.Context, keys []string, limit Limit) ([]Result, error) {
+	return nil, l.err
+}
+
+func TestFallbackLimiter(t *testing.T) {
+	limit := Limit{Rate: 1, Burst: 1}
+	unreachable := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	limiter := NewFallbackLimiter(failingLimiter{err: unreachable}, NewLocalLimiter(), slog.Default())
+
+	if result, err := limiter.Allow(context.Background(), "client", limit); err != nil || !result.Allowed {
+		t.Fatalf("first request = %+v, %v, want allowed by the local limiter", result, err)
+	}
+	if result, err := limiter.Allow(context.Background(), "client", limit); err != nil || result.Allowed {
+		t.Fatalf("second request = %+v, %v, want denied by the local limiter", result, err)
+	}
+
+	results, err := limiter.AllowN(context.Background(), []string{"client", "other"}, limit)
+	if err != nil || len(results) != 2 || results[0].Allowed || !results[1].Allowed {
+		t.Fatalf("batch = %+v, %v, want decided by the local limiter", results, err)
+	}
+
+	limiter = NewFallbackLimiter(failingLimiter{err: errors.New("NOSCRIPT")}, NewLocalLimiter(), slog.Default())
+	if _, err := limiter.Allow(context.Background(), "client", limit); err == nil {
+		t.Fatal("a rejected script must not fall back")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	policy := &Policy{Name: "accept", Limit: Limit{Rate: 0.5, Burst: 1}, Limiter: NewLocalLimiter(), Logger: slog.Default()}
+	handler := Middleware(policy, KeyBy(KeyAPIKey, 0))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	request := func(apiKey string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/api/verve/accept?id=1", nil)
+		if apiKey != "" {
+			r.Header.Set(auth.APIKeyHeader, apiKey)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := request("k1"); w.Code != http.StatusOK || w.Header().Get(RemainingHeader) != "0" {
+		t.Fatalf("first request = %d, remaining %q", w.Code, w.Header().Get(RemainingHeader))
+	}
+	w := request("k1")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("second request = %d, want 429", w.Code)
+	}
+	if got := w.Header().Get(RetryHeader); got != "2" {
+		t.Errorf("Retry-After = %q, want 2", got)
+	}
+	if got := w.Header().Get("Content-Type"); got != e.ProblemContentType {
+		t.Errorf("Content-Type = %q, want problem details", got)
+	}
+	if w := request("k2"); w.Code != http.StatusOK {
+		t.Fatalf("another key = %d, want 200", w.Code)
+	}
+}
+
+func TestPolicyFailsOpen(t *testing.T) {
+	policy := &Policy{Name: "accept", Limit: Limit{Rate: 1, Burst: 1}, Limiter: failingLimiter{err: errors.New("boom")}, Logger: slog.Default()}
+	if result, err := policy.Allow(context.Background(), "client"); err != nil || !result.Allowed {
+		t.Fatalf("Allow = %+v, %v, want allowed when the limiter fails", result, err)
+	}
+	if errs := policy.AllowN(context.Background(), []string{"a", "b"}); errs[0] != nil || errs[1] != nil {
+		t.Fatalf("AllowN = %v, want allowed when the limiter fails", errs)
+	}
+	var disabled *Policy
+	if _, err := disabled.Allow(context.Background(), "client"); err != nil {
+		t.Fatalf("a nil policy must allow everything, got %v", err)
+	}
+	if errs := disabled.AllowN(context.Background(), []string{"a"}); len(errs) != 1 || errs[0] != nil {
+		t.Fatalf("a nil policy must allow every key, got %v", errs)
+	}
+}
+
+func TestKeyBy(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/api/verve/accept?namespace=shop", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	// The client sent a fake first entry, the two proxies appended the next ones.
+	r.Header.Set("X-Forwarded-For", "198.51.100.1, 203.0.113.7, 10.0.0.2")
+
+	tests := []struct {
+		kind           string
+		trustedProxies int
+		want           string
+	}{
+		{KeyIP, 0, "ip:10.0.0.1"},
+		{KeyIP, 1, "ip:10.0.0.2"},
+		{KeyIP, 2, "ip:203.0.113.7"},
+		{KeyIP, 5, "ip:198.51.100.1"},
+		{KeyNamespace, 0, "ns:shop"},
+		{KeyAPIKey, 0, "ip:10.0.0.1"},
+	}
+	for _, tt := range tests {
+		if got := KeyBy(tt.kind, tt.trustedProxies)(r); got != tt.want {
+			t.Errorf("KeyBy(%s, %d) = %q, want %q", tt.kind, tt.trustedProxies, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package ratelimit
+
+import (
+	"Verve/internal/auth"
+	e "Verve/internal/configs/errorResponse"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Rate limit headers, following the IETF RateLimit header fields draft.
+const (
+	LimitHeader     = "RateLimit-Limit"
+	RemainingHeader = "RateLimit-Remaining"
+	ResetHeader     = "RateLimit-Reset"
+	RetryHeader     = "Retry-After"
+)
+
+// Policy applies one limit to the keys of one kind, such as the clients of a
+// route or the ids of the accept endpoint. A nil policy allows everything.
+type Policy struct {
+	// Name scopes the buckets of the policy, the same key has one bucket per policy.
+	Name    string
+	Limit   Limit
+	Limiter Limiter
+	Logger  *slog.Logger
+}
+
+// Allow takes one request from the bucket of key. Limiter failures are logged and
+// the request is allowed: an unavailable limiter must not take the service down.
+// A denied request returns an error wrapping e.ErrRateLimited.
+func (p *Policy) Allow(ctx context.Context, key string) (Result, error) {
+	if p == nil || !p.Limit.Enabled() {
+		return Result{Allowed: true}, nil
+	}
+	result, err := p.Limiter.Allow(ctx, p.Name+":"+key, p.Limit)
+	if err != nil {
+		p.Logger.Error("Rate limiter failed, allowing request", "policy", p.Name, "error", err)
+		return Result{Allowed: true}, nil
+	}
+	if !result.Allowed {
+		return result, fmt.Errorf("%w, retry in %d seconds", e.ErrRateLimited, max(seconds(result.RetryAfter), 1))
+	}
+	return result, nil
+}
+
+// AllowN takes one request from the bucket of every key with a single limiter
+// call and returns one error per key, nil when its request is allowed. Like
+// Allow, a limiter failure allows every request.
+func (p *Policy) AllowN(ctx context.Context, keys []string) []error {
+	errs := make([]error, len(keys))
+	if p == nil || !p.Limit.Enabled() {
+		return errs
+	}
+	scoped := make([]string, len(keys))
+	for i, key := range keys {
+		scoped[i] = p.Name + ":" + key
+	}
+	results, err := p.Limiter.AllowN(ctx, scoped, p.Limit)
+	if err != nil {
+		p.Logger.Error("Rate limiter failed, allowing requests", "policy", p.Name, "error", err)
+		return errs
+	}
+	for i, result := range results {
+		if !result.Allowed {
+			errs[i] = fmt.Errorf("%w, retry in %d seconds", e.ErrRateLimited, max(seconds(result.RetryAfter), 1))
+		}
+	}
+	return errs
+}
+
+// SetHeaders reports the state of the bucket, and when to retry if the request was denied.
+func SetHeaders(w http.ResponseWriter, result Result) {
+	if result.Limit == 0 {
+		return
+	}
+	w.Header().Set(LimitHeader, strconv.Itoa(result.Limit))
+	w.Header().Set(RemainingHeader, strconv.Itoa(result.Remaining))
+	w.Header().Set(ResetHeader, strconv.Itoa(seconds(result.ResetAfter)))
+	if !result.Allowed {
+		w.Header().Set(RetryHeader, strconv.Itoa(max(seconds(result.RetryAfter), 1)))
+	}
+}
+
+// KeyFunc returns the bucket key of the client of a request.
+type KeyFunc func(r *http.Request) string
+
+// Client keys.
+const (
+	KeyIP        = "ip"
+	KeyAPIKey    = "api_key"
+	KeyNamespace = "namespace"
+)
+
+// KeyBy returns the key function of kind. Authenticated clients are identified
+// by their key and its namespace, others by the API key header and the namespace
+// query parameter; clients without either fall back to their ip. With
+// trustedProxies proxies in front of the service, the ip is read from the
+// X-Forwarded-For header they append to; zero ignores the header.
+func KeyBy(kind string, trustedProxies int) KeyFunc {
+	byIP := func(r *http.Request) string { return "ip:" + clientIP(r, trustedProxies) }
+	switch kind {
+	case KeyAPIKey:
+		return func(r *http.Request) string {
+			if apiKey, ok := auth.FromContext(r.Context()); ok {
+				return "key:" + apiKey.Id
+			}
+			if key := auth.KeyFromRequest(r); key != "" {
+				// The key is a secret, only its hash is stored.
+				sum := sha256.Sum256([]byte(key))
+				return "key:" + hex.EncodeToString(sum[:8])
+			}
+			return byIP(r)
+		}
+	case KeyNamespace:
+		return func(r *http.Request) string {
+			if apiKey, ok := auth.FromContext(r.Context()); ok && apiKey.Namespace != "" {
+				return "ns:" + apiKey.Namespace
+			}
+			if namespace := r.URL.Query().Get("namespace"); namespace != "" {
+				return "ns:" + namespace
+			}
+			return byIP(r)
+		}
+	default:
+		return byIP
+	}
+}
+
+// clientIP returns the address the first of the trusted proxies received the
+// request from. Each proxy appends to X-Forwarded-For, so only the rightmost
+// trustedProxies entries can be trusted; the ones on their left are set by the
+// client. With fewer entries, the leftmost is used.
+func clientIP(r *http.Request, trustedProxies int) string {
+	if trustedProxies > 0 {
+		var hops []string
+		for _, header := range r.Header.Values("X-Forwarded-For") {
+			for _, hop := range strings.Split(header, ",") {
+				if hop = strings.TrimSpace(hop); hop != "" {
+					hops = append(hops, hop)
+				}
+			}
+		}
+		if len(hops) > 0 {
+			return hops[max(len(hops)-trustedProxies, 0)]
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Middleware limits the requests of every client with the policy, answering 429
+// problem details once the bucket of the client is empty.
+func Middleware(policy *Policy, key KeyFunc) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			result, err := policy.Allow(r.Context(), key(r))
+			SetHeaders(w, result)
+			if err != nil {
+				e.SendProblem(w, r, e.NewProblem(http.StatusTooManyRequests, e.CodeRateLimited, err.Error()))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Quota applies the quota of the authenticated API key, if it has one, across
+// every route of the key.
+func Quota(limiter Limiter, logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			apiKey, ok := auth.FromContext(r.Context())
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			policy := &Policy{
+				Name:    "quota",
+				Limit:   Limit{Rate: apiKey.Quota.Rate, Burst: apiKey.Quota.Burst},
+				Limiter: limiter,
+				Logger:  logger,
+			}
+			result, err := policy.Allow(r.Context(), apiKey.Id)
+			if err != nil {
+				SetHeaders(w, result)
+				e.SendProblem(w, r, e.NewProblem(http.StatusTooManyRequests, e.CodeRateLimited, "api key quota exceeded: "+err.Error()))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package ratelimit
+
+import (
+	"Verve/internal/database"
+	"context"
+	"fmt"
+	"time"
+)
+
+// KEY_PREFIX prefixes the Redis keys of the rate limit buckets.
+const KEY_PREFIX = "ratelimit"
+
+// gcraScript applies the GCRA to the theoretical arrival times stored in KEYS,
+// one request per key in order, in microseconds of the Redis clock so that
+// replicas with skewed clocks agree. ARGV[1] is the emission interval and ARGV[2]
+// the burst tolerance, both in microseconds. It returns allowed, remaining, retry
+// after and reset after for every key, one after the other.
+const gcraScript = `
+local emission = tonumber(ARGV[1])
+local tolerance = tonumber(ARGV[2])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000000 + tonumber(time[2])
+local reply = {}
+for _, key in ipairs(KEYS) do
+	local tat = tonumber(redis.call('GET', key))
+	if not tat or tat < now then
+		tat = now
+	end
+	local new_tat = tat + emission
+	local allow_at = new_tat - tolerance
+	if now < allow_at then
+		table.insert(reply, 0)
+		table.insert(reply, 0)
+		table.insert(reply, allow_at - now)
+		table.insert(reply, tat - now)
+	else
+		local ttl = math.ceil((new_tat - now) / 1000)
+		redis.call('SET', key, string.format('%.0f', new_tat), 'PX', string.format('%.0f', ttl))
+		table.insert(reply, 1)
+		table.insert(reply, math.floor((tolerance - (new_tat - now)) / emission))
+		table.insert(reply, 0)
+		table.insert(reply, new_tat - now)
+	end
+end
+return reply
+`
+
+// RedisLimiter keeps the buckets in Redis, its limits apply across every replica.
+type RedisLimiter struct {
+	db database.Service
+}
+
+func NewRedisLimiter(db database.Service) *RedisLimiter {
+	return &RedisLimiter{db: db}
+}
+
+func (l *RedisLimiter) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	results, err := l.AllowN(ctx, []string{key}, limit)
+	if err != nil {
+		return Result{}, err
+	}
+	return results[0], nil
+}
+
+// AllowN decides every key with a single script call.
+func (l *RedisLimiter) AllowN(ctx context.Context, keys []string, limit Limit) ([]Result, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	bucketKeys := make([]string, len(keys))
+	for i, key := range keys {
+		bucketKeys[i] = KEY_PREFIX + ":" + key
+	}
+	reply, err := l.db.Eval(ctx, gcraScript, bucketKeys,
+		limit.emission().Microseconds(), limit.tolerance().Microseconds())
+	if err != nil {
+		return nil, err
+	}
+	values, ok := reply.([]interface{})
+	if !ok || len(values) != 4*len(keys) {
+		return nil, fmt.Errorf("unexpected rate limit reply %v", reply)
+	}
+	numbers := make([]int64, len(values))
+	for i, value := range values {
+		if numbers[i], ok = value.(int64); !ok {
+			return nil, fmt.Errorf("unexpected rate limit reply %v", reply)
+		}
+	}
+	results := make([]Result, len(keys))
+	for i := range results {
+		decision := numbers[4*i : 4*i+4]
+		results[i] = Result{
+			Allowed:    decision[0] == 1,
+			Limit:      limit.Burst,
+			Remaining:  int(decision[1]),
+			RetryAfter: time.Duration(decision[2]) * time.Microsecond,
+			ResetAfter: time.Duration(decision[3]) * time.Microsecond,
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"Verve/internal/database"
+	"Verve/internal/model/entity"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// API_KEY_KEY prefixes the metadata of an API key, keyed by the hash of the key.
+const API_KEY_KEY = "apikey"
+
+// API_KEY_ID_KEY prefixes the hash of the API key with a given id, to revoke it.
+const API_KEY_ID_KEY = "apikey_id"
+
+var ErrAPIKeyNotFound = errors.New("api key not found")
+
+type APIKeyRepository interface {
+	Save(ctx context.Context, hash string, apiKey entity.APIKey) error
+	GetByHash(ctx context.Context, hash string) (*entity.APIKey, error)
+	Delete(ctx context.Context, id string) error
+}
+
+type implAPIKeyRepository struct {
+	db database.Service
+}
+
+func NewImplAPIKeyRepository(database database.Service) *implAPIKeyRepository {
+	return &implAPIKeyRepository{
+		db: database,
+	}
+}
+
+func (repo *implAPIKeyRepository) Save(ctx context.Context, hash string, apiKey entity.APIKey) error {
+	apiKey.Key = ""
+	data, err := json.Marshal(apiKey)
+	if err != nil {
+		return fmt.Errorf("failed to encode api key: %w", err)
+	}
+	if err := repo.db.Set(ctx, apiKeyKey(hash), data, 0); err != nil {
+		return err
+	}
+	return repo.db.Set(ctx, apiKeyIdKey(apiKey.Id), hash, 0)
+}
+
+func (repo *implAPIKeyRepository) GetByHash(ctx context.Context, hash string) (*entity.APIKey, error) {
+	data, err := repo.db.Get(ctx, apiKeyKey(hash))
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var apiKey entity.APIKey
+	if err := json.Unmarshal([]byte(data), &apiKey); err != nil {
+		return nil, fmt.Errorf("failed to decode api key: %w", err)
+	}
+	return &apiKey, nil
+}
+
+// Delete revokes the key with the id; the metadata goes first so that a failure
+// in between leaves the key revoked.
+func (repo *implAPIKeyRepository) Delete(ctx context.Context, id string) error {
+	hash, err := repo.db.Get(ctx, apiKeyIdKey(id))
+	if errors.Is(err, database.ErrNotFound) {
+		return ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if err := repo.db.Del(ctx, apiKeyKey(hash)); err != nil {
+		return err
+	}
+	return repo.db.Del(ctx, apiKeyIdKey(id))
+}
+
+func apiKeyKey(hash string) string {
+	return fmt.Sprintf("%s:%s", API_KEY_KEY, hash)
+}
+
+func apiKeyIdKey(id string) string {
+	return fmt.Sprintf("%s:%s", API_KEY_ID_KEY, id)
+}
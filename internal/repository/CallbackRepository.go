@@ -0,0 +1,183 @@
+package repository
+
+import (
+	"Verve/internal/database"
+	"Verve/internal/model/entity"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DELIVERY_KEY prefixes the record of a callback delivery.
+const DELIVERY_KEY = "callback:delivery"
+
+// DELIVERY_QUEUE_KEY is the sorted set of delivery ids scored by their next attempt time.
+const DELIVERY_QUEUE_KEY = "callback:queue"
+
+// DELIVERY_INDEX_KEY prefixes the set of delivery ids sent to a url for a window.
+const DELIVERY_INDEX_KEY = "callback:window"
+
+// TEMPLATE_KEY prefixes the callback template of a target url, per namespace.
+const TEMPLATE_KEY = "callback:template"
+
+// deliveryTTL keeps delivery records around for partners to inspect.
+const deliveryTTL = 7 * 24 * time.Hour
+
+// claimScript claims up to ARGV[2] deliveries of the queue KEYS[1] due at ARGV[1]
+// by pushing them back to the lease deadline ARGV[3], in one atomic step: a
+// claimed delivery is always either due or leased, never out of the queue.
+const claimScript = `
+local ids = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+for _, id in ipairs(ids) do
+	redis.call('ZADD', KEYS[1], ARGV[3], id)
+end
+return ids
+`
+
+var (
+	ErrDeliveryNotFound = errors.New("callback delivery not found")
+	ErrTemplateNotFound = errors.New("callback template not found")
+)
+
+type CallbackRepository interface {
+	SaveDelivery(ctx context.Context, delivery entity.CallbackDelivery) error
+	GetDelivery(ctx context.Context, id string) (*entity.CallbackDelivery, error)
+	IndexDelivery(ctx context.Context, delivery entity.CallbackDelivery) error
+	FindDeliveries(ctx context.Context, window time.Time, url string) ([]string, error)
+	Schedule(ctx context.Context, id string, at time.Time) error
+	ClaimDue(ctx context.Context, now time.Time, limit int64, lease time.Duration) ([]string, error)
+	Complete(ctx context.Context, id string) error
+	SaveTemplate(ctx context.Context, template entity.CallbackTemplate) error
+	GetTemplate(ctx context.Context, namespace, url string) (*entity.CallbackTemplate, error)
+	DeleteTemplate(ctx context.Context, namespace, url string) error
+}
+
+type implCallbackRepository struct {
+	db database.Service
+}
+
+func NewImplCallbackRepository(database database.Service) *implCallbackRepository {
+	return &implCallbackRepository{
+		db: database,
+	}
+}
+
+func (repo *implCallbackRepository) SaveDelivery(ctx context.Context, delivery entity.CallbackDelivery) error {
+	data, err := json.Marshal(delivery)
+	if err != nil {
+		return fmt.Errorf("failed to encode delivery: %w", err)
+	}
+	return repo.db.Set(ctx, deliveryKey(delivery.Id), data, deliveryTTL)
+}
+
+func (repo *implCallbackRepository) GetDelivery(ctx context.Context, id string) (*entity.CallbackDelivery, error) {
+	data, err := repo.db.Get(ctx, deliveryKey(id))
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, ErrDeliveryNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var delivery entity.CallbackDelivery
+	if err := json.Unmarshal([]byte(data), &delivery); err != nil {
+		return nil, fmt.Errorf("failed to decode delivery: %w", err)
+	}
+	return &delivery, nil
+}
+
+// IndexDelivery records the delivery under its url and window, for as long as
+// the delivery record is kept. Deliveries without a window are not indexed.
+func (repo *implCallbackRepository) IndexDelivery(ctx context.Context, delivery entity.CallbackDelivery) error {
+	if delivery.WindowStart.IsZero() {
+		return nil
+	}
+	return repo.db.SAddWithTTL(ctx, deliveryIndexKey(delivery.WindowStart, delivery.Url), deliveryTTL, delivery.Id)
+}
+
+// FindDeliveries returns the ids of the deliveries sent to url for the window.
+func (repo *implCallbackRepository) FindDeliveries(ctx context.Context, window time.Time, url string) ([]string, error) {
+	return repo.db.SMembers(ctx, deliveryIndexKey(window, url))
+}
+
+// Schedule queues the delivery for an attempt at the given time.
+func (repo *implCallbackRepository) Schedule(ctx context.Context, id string, at time.Time) error {
+	return repo.db.ZAdd(ctx, DELIVERY_QUEUE_KEY, float64(at.UnixMilli()), id)
+}
+
+// ClaimDue returns up to limit deliveries due at now. Each claimed delivery is
+// pushed back by the lease in the same atomic script, so that it is retried by
+// any replica if the claimer dies before calling Schedule or Complete, and no
+// other replica claims it in the meantime.
+func (repo *implCallbackRepository) ClaimDue(ctx context.Context, now time.Time, limit int64, lease time.Duration) ([]string, error) {
+	reply, err := repo.db.Eval(ctx, claimScript, []string{DELIVERY_QUEUE_KEY},
+		now.UnixMilli(), limit, now.Add(lease).UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	values, ok := reply.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected claim reply %v", reply)
+	}
+	claimed := make([]string, 0, len(values))
+	for _, value := range values {
+		id, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("unexpected claim reply %v", reply)
+		}
+		claimed = append(claimed, id)
+	}
+	return claimed, nil
+}
+
+// Complete removes the delivery from the queue, its record is kept.
+func (repo *implCallbackRepository) Complete(ctx context.Context, id string) error {
+	_, err := repo.db.ZRem(ctx, DELIVERY_QUEUE_KEY, id)
+	return err
+}
+
+func (repo *implCallbackRepository) SaveTemplate(ctx context.Context, template entity.CallbackTemplate) error {
+	data, err := json.Marshal(template)
+	if err != nil {
+		return fmt.Errorf("failed to encode template: %w", err)
+	}
+	return repo.db.Set(ctx, templateKey(template.Namespace, template.Url), data, 0)
+}
+
+func (repo *implCallbackRepository) GetTemplate(ctx context.Context, namespace, url string) (*entity.CallbackTemplate, error) {
+	data, err := repo.db.Get(ctx, templateKey(namespace, url))
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, ErrTemplateNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var template entity.CallbackTemplate
+	if err := json.Unmarshal([]byte(data), &template); err != nil {
+		return nil, fmt.Errorf("failed to decode template: %w", err)
+	}
+	return &template, nil
+}
+
+func (repo *implCallbackRepository) DeleteTemplate(ctx context.Context, namespace, url string) error {
+	return repo.db.Del(ctx, templateKey(namespace, url))
+}
+
+// templateKey returns the key of the template of url in the namespace; the default
+// namespace keeps the original callback:template:<url> key. Namespaces hold no
+// colon, so the two forms cannot collide.
+func templateKey(namespace, url string) string {
+	if namespace == "" {
+		return fmt.Sprintf("%s:%s", TEMPLATE_KEY, url)
+	}
+	return fmt.Sprintf("%s:%s:%s", TEMPLATE_KEY, namespace, url)
+}
+
+func deliveryIndexKey(window time.Time, url string) string {
+	return fmt.Sprintf("%s:%d:%s", DELIVERY_INDEX_KEY, window.Unix(), url)
+}
+
+func deliveryKey(id string) string {
+	return fmt.Sprintf("%s:%s", DELIVERY_KEY, id)
+}
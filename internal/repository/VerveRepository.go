@@ -4,14 +4,48 @@ import (
 	"Verve/internal/database"
 	"Verve/internal/model/entity"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
 )
 
+// SAVE_ID_KEY prefixes the sets of ids a window received, one per namespace.
 const SAVE_ID_KEY = "id"
 
+// NAMESPACES_KEY prefixes the set of namespaces that received ids in a window.
+const NAMESPACES_KEY = "namespaces"
+
+// CALLBACKS_KEY prefixes the set of callback urls registered for a window.
+const CALLBACKS_KEY = "callbacks"
+
+// CALLBACK_ORIGIN_KEY prefixes the request that registered a callback url for a window.
+const CALLBACK_ORIGIN_KEY = "callback_origin"
+
+// WINDOW_COUNT_KEY prefixes the finalized unique counts of a window, keyed by namespace.
+const WINDOW_COUNT_KEY = "window_count"
+
+// APPROXIMATE_KEY prefixes the flag of a window whose counts include ids reconciled
+// from a degraded mode bucket.
+const APPROXIMATE_KEY = "approximate"
+
+// windowTTL keeps window scoped keys around long enough for every replica to flush them.
+const windowTTL = 10 * time.Minute
+
 type VerveRepository interface {
-	Save(ctx context.Context, entity entity.VerveEntity) error
-	GetUniqueCount(ctx context.Context) (int64, error)
-	Delete(ctx context.Context) error
+	Save(ctx context.Context, window time.Time, entity entity.VerveEntity) error
+	SaveAll(ctx context.Context, window time.Time, entities []entity.VerveEntity) error
+	GetUniqueCount(ctx context.Context, window time.Time) (int64, error)
+	GetUniqueCounts(ctx context.Context, window time.Time) (map[string]int64, error)
+	RegisterCallbacks(ctx context.Context, window time.Time, urls ...string) error
+	PopCallbacks(ctx context.Context, window time.Time, count int64) ([]string, error)
+	FinalizeCounts(ctx context.Context, window time.Time, counts map[string]int64) (map[string]int64, bool, error)
+	MarkApproximate(ctx context.Context, window time.Time) error
+	IsApproximate(ctx context.Context, window time.Time) (bool, error)
+	CountCallbacks(ctx context.Context, window time.Time) (int64, error)
+	SaveCallbackOrigins(ctx context.Context, window time.Time, origins map[string]entity.CallbackOrigin) error
+	CallbackOrigins(ctx context.Context, window time.Time, urls []string) (map[string]entity.CallbackOrigin, error)
+	DeleteNamespace(ctx context.Context, window time.Time, namespace string) error
 }
 
 type implVerveRepository struct {
@@ -49,19 +83,180 @@ func NewImplVerveRepository(database database.Service) *implVerveRepository {
 // which is a probabilistic data structure used to count unique elements in a set. This will count the id base on
 // fixed window size that is 1-59 sec.
 
-func (repo *implVerveRepository) Save(ctx context.Context, entity entity.VerveEntity) error {
+func (repo *implVerveRepository) Save(ctx context.Context, window time.Time, verveEntity entity.VerveEntity) error {
+	return repo.SaveAll(ctx, window, []entity.VerveEntity{verveEntity})
+}
+
+// SaveAll stores the ids of all entities in the sets of the window in one
+// pipelined call, grouping them by namespace. The sets expire once every replica
+// had the time to flush the window.
+func (repo *implVerveRepository) SaveAll(ctx context.Context, window time.Time, entities []entity.VerveEntity) error {
+	batch := make(map[string][]interface{})
+	for _, verveEntity := range entities {
+		key := idKey(window, verveEntity.Namespace)
+		batch[key] = append(batch[key], verveEntity.Id)
+		if verveEntity.Namespace != "" {
+			namespacesKey := windowKey(NAMESPACES_KEY, window)
+			batch[namespacesKey] = append(batch[namespacesKey], verveEntity.Namespace)
+		}
+	}
+	return repo.db.SAddBatch(ctx, batch, windowTTL)
+}
+
+// GetUniqueCount returns the unique count of the window across every namespace;
+// an id sent in two namespaces counts twice.
+func (repo *implVerveRepository) GetUniqueCount(ctx context.Context, window time.Time) (int64, error) {
+	counts, err := repo.GetUniqueCounts(ctx, window)
+	if err != nil {
+		return 0, err
+	}
+	return entity.TotalCount(counts), nil
+}
 
-	err := repo.db.SAdd(ctx, SAVE_ID_KEY, entity.Id)
+// GetUniqueCounts returns the unique count of every namespace of the window,
+// the default namespace is keyed by the empty string.
+func (repo *implVerveRepository) GetUniqueCounts(ctx context.Context, window time.Time) (map[string]int64, error) {
+	namespaces, err := repo.db.SMembers(ctx, windowKey(NAMESPACES_KEY, window))
 	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int64, len(namespaces)+1)
+	for _, namespace := range append([]string{""}, namespaces...) {
+		count, err := repo.db.SCard(ctx, idKey(window, namespace))
+		if err != nil {
+			return nil, err
+		}
+		counts[namespace] = count
+	}
+	return counts, nil
+}
+
+// DeleteNamespace clears the ids of one namespace from the window.
+func (repo *implVerveRepository) DeleteNamespace(ctx context.Context, window time.Time, namespace string) error {
+	if err := repo.db.Del(ctx, idKey(window, namespace)); err != nil {
 		return err
 	}
-	return nil
+	if namespace == "" {
+		return nil
+	}
+	return repo.db.SRem(ctx, windowKey(NAMESPACES_KEY, window), namespace)
+}
+
+// idKey returns the set key holding the ids a namespace received in the window.
+func idKey(window time.Time, namespace string) string {
+	if namespace == "" {
+		return windowKey(SAVE_ID_KEY, window)
+	}
+	return fmt.Sprintf("%s:%s", windowKey(SAVE_ID_KEY, window), namespace)
+}
+
+// RegisterCallbacks records the urls to notify when the window closes, a url is stored once per window.
+func (repo *implVerveRepository) RegisterCallbacks(ctx context.Context, window time.Time, urls ...string) error {
+	if len(urls) == 0 {
+		return nil
+	}
+	members := make([]interface{}, 0, len(urls))
+	for _, url := range urls {
+		members = append(members, url)
+	}
+	return repo.db.SAddWithTTL(ctx, windowKey(CALLBACKS_KEY, window), windowTTL, members...)
+}
+
+// PopCallbacks removes and returns up to count urls registered for the window.
+// Every url is handed to a single replica.
+func (repo *implVerveRepository) PopCallbacks(ctx context.Context, window time.Time, count int64) ([]string, error) {
+	return repo.db.SPopN(ctx, windowKey(CALLBACKS_KEY, window), count)
+}
+
+// SaveCallbackOrigins records the request that registered each url for the
+// window in one round trip, the first request to register a url is kept.
+func (repo *implVerveRepository) SaveCallbackOrigins(ctx context.Context, window time.Time, origins map[string]entity.CallbackOrigin) error {
+	values := make(map[string]interface{}, len(origins))
+	for url, origin := range origins {
+		data, err := json.Marshal(origin)
+		if err != nil {
+			return fmt.Errorf("failed to encode callback origin: %w", err)
+		}
+		values[callbackOriginKey(window, url)] = data
+	}
+	return repo.db.SetNXBatch(ctx, values, windowTTL)
+}
+
+// CallbackOrigins returns the origins recorded for the urls of the window in one
+// round trip, urls without one are left out.
+func (repo *implVerveRepository) CallbackOrigins(ctx context.Context, window time.Time, urls []string) (map[string]entity.CallbackOrigin, error) {
+	keys := make([]string, 0, len(urls))
+	for _, url := range urls {
+		keys = append(keys, callbackOriginKey(window, url))
+	}
+	values, err := repo.db.MGet(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+	origins := make(map[string]entity.CallbackOrigin, len(values))
+	for _, url := range urls {
+		data, ok := values[callbackOriginKey(window, url)]
+		if !ok {
+			continue
+		}
+		var origin entity.CallbackOrigin
+		if err := json.Unmarshal([]byte(data), &origin); err != nil {
+			return nil, fmt.Errorf("invalid callback origin %q: %w", data, err)
+		}
+		origins[url] = origin
+	}
+	return origins, nil
+}
+
+func callbackOriginKey(window time.Time, url string) string {
+	return fmt.Sprintf("%s:%s", windowKey(CALLBACK_ORIGIN_KEY, window), url)
+}
+
+// CountCallbacks returns the number of urls still registered for the window.
+func (repo *implVerveRepository) CountCallbacks(ctx context.Context, window time.Time) (int64, error) {
+	return repo.db.SCard(ctx, windowKey(CALLBACKS_KEY, window))
 }
 
-func (repo *implVerveRepository) GetUniqueCount(ctx context.Context) (int64, error) {
-	return repo.db.SCard(ctx, SAVE_ID_KEY)
+// FinalizeCounts stores the counts of the window unless another replica already did,
+// and returns the stored counts along with whether this call stored them.
+func (repo *implVerveRepository) FinalizeCounts(ctx context.Context, window time.Time, counts map[string]int64) (map[string]int64, bool, error) {
+	key := windowKey(WINDOW_COUNT_KEY, window)
+	data, err := json.Marshal(counts)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to encode counts: %w", err)
+	}
+	owner, err := repo.db.SetNX(ctx, key, data, windowTTL)
+	if err != nil {
+		return nil, false, err
+	}
+	if owner {
+		return counts, true, nil
+	}
+	stored, err := repo.db.Get(ctx, key)
+	if err != nil {
+		return nil, false, err
+	}
+	finalCounts := make(map[string]int64)
+	if err := json.Unmarshal([]byte(stored), &finalCounts); err != nil {
+		return nil, false, fmt.Errorf("invalid finalized counts %q: %w", stored, err)
+	}
+	return finalCounts, false, nil
+}
+
+// MarkApproximate flags the counts of the window as approximate.
+func (repo *implVerveRepository) MarkApproximate(ctx context.Context, window time.Time) error {
+	return repo.db.Set(ctx, windowKey(APPROXIMATE_KEY, window), "1", windowTTL)
+}
+
+// IsApproximate reports whether the counts of the window were flagged as approximate.
+func (repo *implVerveRepository) IsApproximate(ctx context.Context, window time.Time) (bool, error) {
+	_, err := repo.db.Get(ctx, windowKey(APPROXIMATE_KEY, window))
+	if errors.Is(err, database.ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
 }
 
-func (repo *implVerveRepository) Delete(ctx context.Context) error {
-	return repo.db.Del(ctx, SAVE_ID_KEY)
+func windowKey(prefix string, window time.Time) string {
+	return fmt.Sprintf("%s:%d", prefix, window.Unix())
 }
@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"Verve/internal/database"
+	"Verve/internal/model/entity"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// WEBHOOK_KEY prefixes the record of a webhook subscription.
+const WEBHOOK_KEY = "webhook"
+
+// WEBHOOK_NAMESPACE_KEY prefixes the set of subscription ids of a namespace.
+const WEBHOOK_NAMESPACE_KEY = "webhooks"
+
+// WEBHOOK_NAMESPACES_KEY is the set of namespaces holding at least one subscription.
+const WEBHOOK_NAMESPACES_KEY = "webhook_namespaces"
+
+var ErrWebhookNotFound = errors.New("webhook subscription not found")
+
+type WebhookRepository interface {
+	Save(ctx context.Context, subscription entity.WebhookSubscription) error
+	Get(ctx context.Context, id string) (*entity.WebhookSubscription, error)
+	ListByNamespace(ctx context.Context, namespace string) ([]entity.WebhookSubscription, error)
+	ListNamespaces(ctx context.Context) ([]string, error)
+	Delete(ctx context.Context, id string) error
+}
+
+type implWebhookRepository struct {
+	db database.Service
+}
+
+func NewImplWebhookRepository(database database.Service) *implWebhookRepository {
+	return &implWebhookRepository{
+		db: database,
+	}
+}
+
+func (repo *implWebhookRepository) Save(ctx context.Context, subscription entity.WebhookSubscription) error {
+	data, err := json.Marshal(subscription)
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook: %w", err)
+	}
+	if err := repo.db.Set(ctx, webhookKey(subscription.Id), data, 0); err != nil {
+		return err
+	}
+	if err := repo.db.SAdd(ctx, webhookNamespaceKey(subscription.Namespace), subscription.Id); err != nil {
+		return err
+	}
+	return repo.db.SAdd(ctx, WEBHOOK_NAMESPACES_KEY, subscription.Namespace)
+}
+
+func (repo *implWebhookRepository) Get(ctx context.Context, id string) (*entity.WebhookSubscription, error) {
+	data, err := repo.db.Get(ctx, webhookKey(id))
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, ErrWebhookNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var subscription entity.WebhookSubscription
+	if err := json.Unmarshal([]byte(data), &subscription); err != nil {
+		return nil, fmt.Errorf("failed to decode webhook: %w", err)
+	}
+	return &subscription, nil
+}
+
+// ListByNamespace returns the subscriptions of a namespace, the default namespace is the empty string.
+func (repo *implWebhookRepository) ListByNamespace(ctx context.Context, namespace string) ([]entity.WebhookSubscription, error) {
+	ids, err := repo.db.SMembers(ctx, webhookNamespaceKey(namespace))
+	if err != nil {
+		return nil, err
+	}
+	subscriptions := make([]entity.WebhookSubscription, 0, len(ids))
+	for _, id := range ids {
+		subscription, err := repo.Get(ctx, id)
+		if errors.Is(err, ErrWebhookNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		subscriptions = append(subscriptions, *subscription)
+	}
+	return subscriptions, nil
+}
+
+// ListNamespaces returns the namespaces holding at least one subscription.
+func (repo *implWebhookRepository) ListNamespaces(ctx context.Context) ([]string, error) {
+	return repo.db.SMembers(ctx, WEBHOOK_NAMESPACES_KEY)
+}
+
+func (repo *implWebhookRepository) Delete(ctx context.Context, id string) error {
+	subscription, err := repo.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := repo.db.SRem(ctx, webhookNamespaceKey(subscription.Namespace), id); err != nil {
+		return err
+	}
+	if err := repo.db.Del(ctx, webhookKey(id)); err != nil {
+		return err
+	}
+	remaining, err := repo.db.SCard(ctx, webhookNamespaceKey(subscription.Namespace))
+	if err != nil || remaining > 0 {
+		return err
+	}
+	return repo.db.SRem(ctx, WEBHOOK_NAMESPACES_KEY, subscription.Namespace)
+}
+
+func webhookKey(id string) string {
+	return fmt.Sprintf("%s:%s", WEBHOOK_KEY, id)
+}
+
+func webhookNamespaceKey(namespace string) string {
+	return fmt.Sprintf("%s:%s", WEBHOOK_NAMESPACE_KEY, namespace)
+}
@@ -0,0 +1,40 @@
+package requestid
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name     string
+		incoming string
+		keep     bool
+	}{
+		{"keeps a valid incoming id", "3f2c-req.42", true},
+		{"generates an id when none is sent", "", false},
+		{"replaces an invalid incoming id", "bad id\nwith newline", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen string
+			handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen = FromContext(r.Context())
+			}))
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.incoming != "" {
+				r.Header.Set(Header, tt.incoming)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if seen == "" || w.Header().Get(Header) != seen {
+				t.Fatalf("context id %q, response header %q", seen, w.Header().Get(Header))
+			}
+			if tt.keep != (seen == tt.incoming) {
+				t.Errorf("id = %q, incoming %q, want kept = %v", seen, tt.incoming, tt.keep)
+			}
+		})
+	}
+}
@@ -1,33 +1,96 @@
 package server
 
 import (
-	"Verve/internal/controller"
+	"Verve/internal/auth"
+	"Verve/internal/configs/logger"
+	"Verve/internal/health"
+	"Verve/internal/metrics"
+	"Verve/internal/model/request"
+	"Verve/internal/ratelimit"
+	"Verve/internal/requestid"
+	"Verve/internal/tracing"
 	"encoding/json"
 	"log"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
 )
 
 func (s *Server) RegisterRoutes() http.Handler {
 	r := chi.NewRouter()
-	r.Use(middleware.Logger)
+	r.Use(requestid.Middleware)
+	r.Use(logger.RequestLogger(s.logger, s.requestSampleRate))
+	r.Use(metrics.Middleware)
+	r.Use(tracing.Middleware)
 
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"https://*", "http://*"},
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "PATCH"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", auth.APIKeyHeader, requestid.Header},
+		ExposedHeaders:   []string{requestid.Header, ratelimit.LimitHeader, ratelimit.RemainingHeader, ratelimit.ResetHeader, ratelimit.RetryHeader},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
 
-	r.Get("/api/verve/accept", controller.GetApi)
+	// Api keys are checked before the rate limits, so that the limits and quotas
+	// apply to the authenticated key.
+	r.Group(func(r chi.Router) {
+		r.Use(s.auth.Middleware)
+		r.Use(ratelimit.Quota(s.rateLimiter, s.logger))
+
+		// The accept endpoint has its own, higher, client limit; probes and metrics are not limited.
+		r.Group(func(r chi.Router) {
+			r.Use(ratelimit.Middleware(s.acceptPolicy, s.clientKey))
+			r.Use(s.auth.RequireScope(request.ScopeAccept))
+			r.Get("/api/verve/accept", s.controller.GetApi)
+			r.Post("/api/verve/accept", s.controller.PostApi)
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(ratelimit.Middleware(s.defaultPolicy, s.clientKey))
+			r.Use(s.auth.RequireScope(request.ScopeCallbacks))
+			r.Get("/api/verve/callbacks", s.controller.ListCallbacks)
+			r.Get("/api/verve/callbacks/{id}", s.controller.GetCallback)
+			r.Put("/api/verve/callbacks/templates", s.controller.PutCallbackTemplate)
+			r.Get("/api/verve/callbacks/templates", s.controller.GetCallbackTemplate)
+			r.Delete("/api/verve/callbacks/templates", s.controller.DeleteCallbackTemplate)
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(ratelimit.Middleware(s.defaultPolicy, s.clientKey))
+			r.Use(s.auth.RequireScope(request.ScopeWebhooks))
+			r.Post("/api/verve/webhooks", s.controller.CreateWebhook)
+			r.Get("/api/verve/webhooks", s.controller.ListWebhooks)
+			r.Get("/api/verve/webhooks/{id}", s.controller.GetWebhook)
+			r.Delete("/api/verve/webhooks/{id}", s.controller.DeleteWebhook)
+		})
+	})
+
+	// The admin routes always require a key with the admin scope.
+	r.Route("/admin", func(r chi.Router) {
+		r.Use(s.adminAuth.Middleware)
+		r.Use(s.adminAuth.RequireScope(request.ScopeAdmin))
+		r.Use(ratelimit.Middleware(s.defaultPolicy, s.clientKey))
+		r.Post("/keys", s.admin.CreateAPIKey)
+		r.Delete("/keys/{id}", s.admin.RevokeAPIKey)
+
+		r.Get("/window", s.admin.GetWindow)
+		r.Post("/window/flush", s.admin.FlushWindow)
+		r.Delete("/namespaces/{namespace}", s.admin.ResetNamespace)
+		r.Post("/publisher/pause", s.admin.PausePublisher)
+		r.Post("/publisher/resume", s.admin.ResumePublisher)
+		r.Get("/log-level", s.admin.GetLogLevel)
+		r.Put("/log-level", s.admin.PutLogLevel)
+	})
 
 	r.Get("/", s.HelloWorldHandler)
 
 	r.Get("/health", s.healthHandler)
+	r.Get("/livez", s.livezHandler)
+	r.Get("/readyz", s.readyzHandler)
+
+	r.Handle("/metrics", s.metrics)
 
 	return r
 }
@@ -44,7 +107,27 @@ func (s *Server) HelloWorldHandler(w http.ResponseWriter, r *http.Request) {
 	_, _ = w.Write(jsonResp)
 }
 
+// healthHandler reports the cached dependency checks like readyzHandler, so that
+// frequent probes do not run PING and INFO against Redis on every hit.
 func (s *Server) healthHandler(w http.ResponseWriter, r *http.Request) {
-	jsonResp, _ := json.Marshal(s.db.Health())
+	s.readyzHandler(w, r)
+}
+
+// livezHandler reports that the process is alive. It checks no dependency, so a
+// Redis or Kafka outage never gets the instance restarted.
+func (s *Server) livezHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write([]byte(`{"status":"up"}`))
+}
+
+// readyzHandler reports the cached dependency checks. A degraded instance stays
+// ready, a down one answers 503 so that it is taken out of rotation.
+func (s *Server) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	report := s.health.Report(r.Context())
+	jsonResp, _ := json.Marshal(report)
+	w.Header().Set("Content-Type", "application/json")
+	if report.Status == health.StatusDown {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
 	_, _ = w.Write(jsonResp)
 }
@@ -1,10 +1,14 @@
 package server
 
 import (
+	"Verve/internal/health"
+	"context"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 func TestHandler(t *testing.T) {
@@ -29,3 +33,46 @@ func TestHandler(t *testing.T) {
 		t.Errorf("expected response body to be %v; got %v", expected, string(body))
 	}
 }
+
+func TestReadyzHandler(t *testing.T) {
+	tests := []struct {
+		name   string
+		check  health.Check
+		status int
+	}{
+		{"degraded stays ready", health.Check{Name: "kafka", Run: func(ctx context.Context) error { return errors.New("down") }}, http.StatusOK},
+		{"critical failure is not ready", health.Check{Name: "redis", Critical: true, Run: func(ctx context.Context) error { return errors.New("down") }}, http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{health: health.NewChecker(time.Second, time.Second, tt.check)}
+			w := httptest.NewRecorder()
+			s.readyzHandler(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+		})
+	}
+}
+
+func TestHealthHandlerIsCached(t *testing.T) {
+	runs := 0
+	s := &Server{health: health.NewChecker(time.Minute, time.Second, health.Check{
+		Name:     "redis",
+		Critical: true,
+		Run: func(ctx context.Context) error {
+			runs++
+			return nil
+		},
+	})}
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		s.healthHandler(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+		}
+	}
+	if runs != 1 {
+		t.Errorf("redis checked %d times, want 1", runs)
+	}
+}
@@ -2,30 +2,70 @@ package server
 
 import (
 	"fmt"
+	"log/slog"
 	"net/http"
-	"os"
-	"strconv"
 	"time"
 
-	_ "github.com/joho/godotenv/autoload"
-
+	"Verve/internal/auth"
 	appcontext "Verve/internal/configs/appContext"
-	"Verve/internal/database"
+	"Verve/internal/controller"
+	"Verve/internal/health"
+	"Verve/internal/metrics"
+	"Verve/internal/ratelimit"
 )
 
 type Server struct {
-	port int
-	db   database.Service
+	port       int
+	health     *health.Checker
+	controller *controller.VerveController
+	admin      *controller.AdminController
+	metrics    http.Handler
+
+	// auth authenticates the api routes, adminAuth the admin routes.
+	auth        *auth.Authenticator
+	adminAuth   *auth.Authenticator
+	rateLimiter ratelimit.Limiter
+	logger      *slog.Logger
+	// requestSampleRate is the fraction of successful requests logged.
+	requestSampleRate float64
+
+	// clientKey identifies the client of the default and accept policies.
+	clientKey     ratelimit.KeyFunc
+	defaultPolicy *ratelimit.Policy
+	acceptPolicy  *ratelimit.Policy
 }
 
-func NewServer() *http.Server {
-	port, _ := strconv.Atoi(os.Getenv("PORT"))
-	NewServer := &Server{
-		port: port,
-		db:   database.New(),
+// newPolicy returns the rate limit policy of the limit, or nil when rate limiting is disabled.
+func newPolicy(app *appcontext.AppContext, name string, rate float64, burst int) *ratelimit.Policy {
+	if !app.Config.RateLimit.Enabled {
+		return nil
 	}
+	return &ratelimit.Policy{
+		Name:    name,
+		Limit:   ratelimit.Limit{Rate: rate, Burst: burst},
+		Limiter: app.RateLimiter,
+		Logger:  app.Logger,
+	}
+}
 
-	appcontext.LoadAppContext(NewServer.db)
+// NewServer builds the http server on top of an already built dependency graph.
+func NewServer(app *appcontext.AppContext) *http.Server {
+	limits := app.Config.RateLimit
+	NewServer := &Server{
+		port:              app.Config.Server.Port,
+		health:            app.Health,
+		controller:        controller.NewVerveController(app.VerveService, app.CallbackService, app.WebhookService, newPolicy(app, "id", limits.IdRate, limits.IdBurst), app.IdValidator, app.UrlPolicy),
+		admin:             controller.NewAdminController(app.APIKeyService, app.AdminService),
+		metrics:           metrics.Handler(app.Metrics),
+		auth:              app.Auth,
+		adminAuth:         app.AdminAuth,
+		rateLimiter:       app.RateLimiter,
+		logger:            app.Logger,
+		requestSampleRate: app.Config.Log.RequestSampleRate,
+		clientKey:         ratelimit.KeyBy(limits.Key, limits.ForwardedHops()),
+		defaultPolicy:     newPolicy(app, "default", limits.Rate, limits.Burst),
+		acceptPolicy:      newPolicy(app, "accept", limits.AcceptRate, limits.AcceptBurst),
+	}
 
 	// Declare Server config
 	server := &http.Server{
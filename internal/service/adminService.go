@@ -0,0 +1,130 @@
+package service
+
+import (
+	"Verve/internal/event"
+	"Verve/internal/repository"
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// WindowState is the state of the current one minute window, as seen by an operator.
+type WindowState struct {
+	WindowStart time.Time `json:"window_start"`
+	WindowEnd   time.Time `json:"window_end"`
+	// Counts holds the unique count of every namespace, the default namespace is keyed by the empty string.
+	Counts      map[string]int64 `json:"counts"`
+	Approximate bool             `json:"approximate"`
+	// Callbacks is the number of urls waiting for the window to close.
+	Callbacks int64                `json:"callbacks"`
+	Publisher event.PublisherState `json:"publisher"`
+	// Degraded is the degraded mode state, nil when degraded mode is disabled.
+	Degraded *BucketState `json:"degraded,omitempty"`
+}
+
+// AdminService backs the operational endpoints of an instance.
+type AdminService interface {
+	Window(ctx context.Context) (WindowState, error)
+	FlushCurrentWindow(ctx context.Context) (WindowState, error)
+	ResetNamespace(ctx context.Context, namespace string) error
+	PausePublisher() event.PublisherState
+	ResumePublisher(ctx context.Context) (event.PublisherState, error)
+	LogLevel() slog.Level
+	SetLogLevel(level slog.Level)
+}
+
+type implAdminService struct {
+	verve     VerveService
+	verveRepo repository.VerveRepository
+	publisher *event.PausableEvent
+	bucket    *LocalBucket
+	level     *slog.LevelVar
+	Logger    *slog.Logger
+}
+
+// NewImplAdminService creates the admin service; bucket is nil when degraded mode is disabled.
+func NewImplAdminService(verve VerveService, repository repository.VerveRepository, publisher *event.PausableEvent, bucket *LocalBucket, level *slog.LevelVar, logger *slog.Logger) *implAdminService {
+	return &implAdminService{
+		verve:     verve,
+		verveRepo: repository,
+		publisher: publisher,
+		bucket:    bucket,
+		level:     level,
+		Logger:    logger,
+	}
+}
+
+func (as *implAdminService) Window(ctx context.Context) (WindowState, error) {
+	window := WindowStart(time.Now())
+	state := WindowState{
+		WindowStart: window,
+		WindowEnd:   window.Add(time.Minute),
+		Publisher:   as.publisher.State(),
+	}
+	if as.bucket != nil {
+		bucketState := as.bucket.State()
+		state.Degraded = &bucketState
+	}
+
+	var err error
+	if state.Counts, err = as.verveRepo.GetUniqueCounts(ctx, window); err != nil {
+		return state, fmt.Errorf("failed to get unique counts: %w", err)
+	}
+	if state.Approximate, err = as.verveRepo.IsApproximate(ctx, window); err != nil {
+		return state, fmt.Errorf("failed to read approximate flag: %w", err)
+	}
+	if state.Callbacks, err = as.verveRepo.CountCallbacks(ctx, window); err != nil {
+		return state, fmt.Errorf("failed to count callbacks: %w", err)
+	}
+	return state, nil
+}
+
+// FlushCurrentWindow finalizes the current window before it closes and returns
+// the state it was flushed with. The window is finalized once: ids accepted
+// during the rest of the minute are still stored in it but leave its count as is.
+func (as *implAdminService) FlushCurrentWindow(ctx context.Context) (WindowState, error) {
+	state, err := as.Window(ctx)
+	if err != nil {
+		return state, err
+	}
+	if err := as.verve.FlushWindow(ctx, state.WindowStart); err != nil {
+		return state, err
+	}
+	as.Logger.Warn("Flushed the current window on operator request", "window", state.WindowStart.Format(time.RFC3339))
+	return state, nil
+}
+
+// ResetNamespace drops the ids a namespace received in the current window.
+func (as *implAdminService) ResetNamespace(ctx context.Context, namespace string) error {
+	if err := as.verveRepo.DeleteNamespace(ctx, WindowStart(time.Now()), namespace); err != nil {
+		return fmt.Errorf("failed to reset namespace: %w", err)
+	}
+	as.Logger.Warn("Reset namespace counts on operator request", "namespace", namespace)
+	return nil
+}
+
+func (as *implAdminService) PausePublisher() event.PublisherState {
+	state := as.publisher.Pause()
+	as.Logger.Warn("Paused the publisher on operator request", "held", state.Held)
+	return state
+}
+
+func (as *implAdminService) ResumePublisher(ctx context.Context) (event.PublisherState, error) {
+	state, err := as.publisher.Resume(ctx)
+	if err != nil {
+		return state, err
+	}
+	as.Logger.Info("Resumed the publisher on operator request")
+	return state, nil
+}
+
+func (as *implAdminService) LogLevel() slog.Level {
+	return as.level.Level()
+}
+
+func (as *implAdminService) SetLogLevel(level slog.Level) {
+	previous := as.level.Level()
+	as.level.Set(level)
+	as.Logger.Warn("Changed the log level on operator request", "from", previous.String(), "to", level.String())
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"Verve/internal/model/entity"
+	"Verve/internal/model/request"
+	"Verve/internal/repository"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// apiKeyPrefix makes the keys easy to recognize, e.g. by secret scanners.
+const apiKeyPrefix = "vk_"
+
+// apiKeyBytes is the entropy of a generated key.
+const apiKeyBytes = 32
+
+type APIKeyService interface {
+	Create(ctx context.Context, apiKey request.APIKeyRequest) (*entity.APIKey, error)
+	Authenticate(ctx context.Context, key string) (*entity.APIKey, error)
+	Revoke(ctx context.Context, id string) error
+}
+
+type implAPIKeyService struct {
+	apiKeyRepo repository.APIKeyRepository
+	Logger     *slog.Logger
+}
+
+func NewImplAPIKeyService(repository repository.APIKeyRepository, logger *slog.Logger) *implAPIKeyService {
+	return &implAPIKeyService{
+		apiKeyRepo: repository,
+		Logger:     logger,
+	}
+}
+
+// HashAPIKey returns the hex SHA-256 hash under which a key is stored. Keys are
+// random and long, so a plain hash is enough, unlike passwords.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Create generates and stores a key; the returned key is the only place its
+// plaintext is ever shown.
+func (ks *implAPIKeyService) Create(ctx context.Context, apiKey request.APIKeyRequest) (*entity.APIKey, error) {
+	id, err := newId()
+	if err != nil {
+		return nil, err
+	}
+	secret, err := randomHex(apiKeyBytes)
+	if err != nil {
+		return nil, err
+	}
+	key := apiKeyPrefix + secret
+
+	created := entity.GetAPIKeyFromRequest(id, apiKey, time.Now().UTC())
+	if err := ks.apiKeyRepo.Save(ctx, HashAPIKey(key), created); err != nil {
+		return nil, fmt.Errorf("failed to save api key: %w", err)
+	}
+	ks.Logger.Info("Created api key", "key_id", id, "namespace", created.Namespace, "scopes", created.Scopes)
+	created.Key = key
+	return &created, nil
+}
+
+// Authenticate returns the metadata of a key, or repository.ErrAPIKeyNotFound.
+func (ks *implAPIKeyService) Authenticate(ctx context.Context, key string) (*entity.APIKey, error) {
+	return ks.apiKeyRepo.GetByHash(ctx, HashAPIKey(key))
+}
+
+func (ks *implAPIKeyService) Revoke(ctx context.Context, id string) error {
+	if err := ks.apiKeyRepo.Delete(ctx, id); err != nil {
+		return err
+	}
+	ks.Logger.Info("Revoked api key", "key_id", id)
+	return nil
+}
@@ -0,0 +1,420 @@
+package service
+
+import (
+	restclient "Verve/internal/configs/restClient"
+	urlpolicy "Verve/internal/configs/urlPolicy"
+	"Verve/internal/metrics"
+	"Verve/internal/model/entity"
+	"Verve/internal/repository"
+	"Verve/internal/requestid"
+	"Verve/internal/tracing"
+	"Verve/internal/worker"
+	"Verve/pkg/signature"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// DeliveryIdHeader identifies the delivery so partners can look it up.
+	DeliveryIdHeader = "X-Verve-Delivery-Id"
+	// DeliveryAttemptHeader is the 1-based attempt number of the delivery.
+	DeliveryAttemptHeader = "X-Verve-Delivery-Attempt"
+	// DeliveryEventHeader names the event of a webhook delivery.
+	DeliveryEventHeader = "X-Verve-Event"
+
+	// callbackTimeout bounds every attempt of a callback post.
+	callbackTimeout = 10 * time.Second
+
+	deliveryMaxAttempts = 10
+	deliveryPollBatch   = 100
+	deliveryPollEvery   = time.Second
+	// deliveryLease is how long a claimed delivery stays hidden from other replicas.
+	deliveryLease = 2 * time.Minute
+)
+
+// deliveryBackoff is the delay before the next attempt, indexed by the number of
+// failed attempts so far. Retries spread over roughly sixteen hours.
+var deliveryBackoff = []time.Duration{
+	30 * time.Second,
+	time.Minute,
+	5 * time.Minute,
+	15 * time.Minute,
+	30 * time.Minute,
+	time.Hour,
+	2 * time.Hour,
+	4 * time.Hour,
+	8 * time.Hour,
+}
+
+type CallbackService interface {
+	Enqueue(ctx context.Context, url string, payload entity.CallbackPayload) (string, error)
+	EnqueueWebhook(ctx context.Context, subscription entity.WebhookSubscription, event string, payload entity.CallbackPayload) (string, error)
+	GetDelivery(ctx context.Context, id string) (*entity.CallbackDelivery, error)
+	FindDeliveries(ctx context.Context, url string, window time.Time) ([]entity.CallbackDelivery, error)
+	Admit() error
+	SaveTemplate(ctx context.Context, template entity.CallbackTemplate) error
+	GetTemplate(ctx context.Context, namespace, url string) (*entity.CallbackTemplate, error)
+	DeleteTemplate(ctx context.Context, namespace, url string) error
+	ProcessDue(ctx context.Context) error
+	RunDeliveryLoop(ctx context.Context)
+}
+
+type implCallbackService struct {
+	callbackRepo repository.CallbackRepository
+	webhookRepo  repository.WebhookRepository
+	restClient   restclient.RestClient
+	Logger       *slog.Logger
+	pool         worker.Pool
+	signer       *signature.Signer
+}
+
+// NewImplCallbackService creates the callback delivery service. Webhook deliveries are signed
+// with the secret of their subscription, other callbacks with signer, or unsigned when it is nil.
+func NewImplCallbackService(repository repository.CallbackRepository, webhooks repository.WebhookRepository, client restclient.RestClient, logger *slog.Logger, pool worker.Pool, signer *signature.Signer) *implCallbackService {
+	return &implCallbackService{
+		callbackRepo: repository,
+		webhookRepo:  webhooks,
+		restClient:   client,
+		Logger:       logger,
+		pool:         pool,
+		signer:       signer,
+	}
+}
+
+// Enqueue renders the payload with the template registered for url in the namespace
+// of the payload, persists the delivery and schedules its first attempt right away.
+// The templates of other namespaces never apply.
+func (cs *implCallbackService) Enqueue(ctx context.Context, url string, payload entity.CallbackPayload) (string, error) {
+	template, err := cs.callbackRepo.GetTemplate(ctx, payload.Namespace, url)
+	if errors.Is(err, repository.ErrTemplateNotFound) {
+		defaultTemplate := entity.DefaultCallbackTemplate(url)
+		template = &defaultTemplate
+	} else if err != nil {
+		return "", fmt.Errorf("failed to load callback template: %w", err)
+	}
+	return cs.enqueue(ctx, *template, payload, "", "")
+}
+
+// EnqueueWebhook enqueues a delivery of the event to a subscription, rendered with its template.
+func (cs *implCallbackService) EnqueueWebhook(ctx context.Context, subscription entity.WebhookSubscription, event string, payload entity.CallbackPayload) (string, error) {
+	return cs.enqueue(ctx, subscription.Template, payload, subscription.Id, event)
+}
+
+func (cs *implCallbackService) enqueue(ctx context.Context, template entity.CallbackTemplate, payload entity.CallbackPayload, subscriptionId, event string) (string, error) {
+	body, contentType, err := template.Render(payload)
+	if err != nil {
+		return "", fmt.Errorf("failed to render callback body: %w", err)
+	}
+
+	id, err := newId()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now().UTC()
+	delivery := entity.CallbackDelivery{
+		Id:             id,
+		SubscriptionId: subscriptionId,
+		Event:          event,
+		Url:            template.Url,
+		Method:         template.Method,
+		ContentType:    contentType,
+		Headers:        template.Headers,
+		Body:           string(body),
+		Status:         entity.DeliveryPending,
+		MaxAttempts:    deliveryMaxAttempts,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+		NextAttemptAt:  now,
+		Namespace:      payload.Namespace,
+		WindowStart:    payload.WindowStart,
+		TraceParent:    traceParent(ctx),
+		RequestId:      requestid.FromContext(ctx),
+	}
+	if err := cs.callbackRepo.SaveDelivery(ctx, delivery); err != nil {
+		return "", fmt.Errorf("failed to save delivery: %w", err)
+	}
+	if err := cs.callbackRepo.IndexDelivery(ctx, delivery); err != nil {
+		// The delivery is still attempted, only the lookup by url misses it.
+		cs.Logger.WarnContext(ctx, "Failed to index delivery", "delivery_id", id, "error", err)
+	}
+	if err := cs.callbackRepo.Schedule(ctx, id, now); err != nil {
+		return "", fmt.Errorf("failed to schedule delivery: %w", err)
+	}
+	return id, nil
+}
+
+// Admit returns worker.ErrQueueFull while the attempts queue is full under the
+// reject overflow policy, new callbacks are then refused rather than piled up.
+func (cs *implCallbackService) Admit() error {
+	return cs.pool.Admit()
+}
+
+func (cs *implCallbackService) GetDelivery(ctx context.Context, id string) (*entity.CallbackDelivery, error) {
+	return cs.callbackRepo.GetDelivery(ctx, id)
+}
+
+// FindDeliveries returns the deliveries sent to url for the window, oldest first.
+// Deliveries whose record expired are left out.
+func (cs *implCallbackService) FindDeliveries(ctx context.Context, url string, window time.Time) ([]entity.CallbackDelivery, error) {
+	ids, err := cs.callbackRepo.FindDeliveries(ctx, window, url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find deliveries: %w", err)
+	}
+	deliveries := make([]entity.CallbackDelivery, 0, len(ids))
+	for _, id := range ids {
+		delivery, err := cs.callbackRepo.GetDelivery(ctx, id)
+		if errors.Is(err, repository.ErrDeliveryNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, *delivery)
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		return deliveries[i].CreatedAt.Before(deliveries[j].CreatedAt)
+	})
+	return deliveries, nil
+}
+
+// SaveTemplate registers how the callbacks of template.Namespace to template.Url are
+// sent, it applies to deliveries enqueued afterwards.
+func (cs *implCallbackService) SaveTemplate(ctx context.Context, template entity.CallbackTemplate) error {
+	return cs.callbackRepo.SaveTemplate(ctx, template)
+}
+
+func (cs *implCallbackService) GetTemplate(ctx context.Context, namespace, url string) (*entity.CallbackTemplate, error) {
+	return cs.callbackRepo.GetTemplate(ctx, namespace, url)
+}
+
+func (cs *implCallbackService) DeleteTemplate(ctx context.Context, namespace, url string) error {
+	return cs.callbackRepo.DeleteTemplate(ctx, namespace, url)
+}
+
+// ProcessDue claims the deliveries that are due and attempts them on the worker pool.
+func (cs *implCallbackService) ProcessDue(ctx context.Context) error {
+	ids, err := cs.callbackRepo.ClaimDue(ctx, time.Now(), deliveryPollBatch, deliveryLease)
+	if err != nil {
+		return fmt.Errorf("failed to claim due deliveries: %w", err)
+	}
+	for _, id := range ids {
+		id := id
+		err := cs.pool.Submit(func(ctx context.Context) {
+			cs.attempt(ctx, id)
+		})
+		if err != nil {
+			// The lease brings the delivery back once it expires.
+			cs.Logger.Error("Failed to queue delivery attempt", "delivery_id", id, "error", err)
+		}
+	}
+	return nil
+}
+
+// RunDeliveryLoop polls the delivery queue until ctx is done.
+func (cs *implCallbackService) RunDeliveryLoop(ctx context.Context) {
+	ticker := time.NewTicker(deliveryPollEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := cs.ProcessDue(ctx); err != nil {
+				cs.Logger.Error("Failed to process callback deliveries", "error", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (cs *implCallbackService) attempt(ctx context.Context, id string) {
+	delivery, err := cs.callbackRepo.GetDelivery(ctx, id)
+	if errors.Is(err, repository.ErrDeliveryNotFound) {
+		cs.complete(ctx, id)
+		return
+	}
+	if err != nil {
+		cs.Logger.Error("Failed to load delivery", "delivery_id", id, "error", err)
+		return
+	}
+	if delivery.Status != entity.DeliveryPending {
+		cs.complete(ctx, id)
+		return
+	}
+
+	delivery.Attempts++
+	if delivery.RequestId != "" {
+		ctx = requestid.WithID(ctx, delivery.RequestId)
+	}
+	ctx, span := startAttemptSpan(ctx, delivery)
+	defer span.End()
+	body := []byte(delivery.Body)
+	headers := make(map[string]string, len(delivery.Headers)+4)
+	for key, value := range delivery.Headers {
+		headers[key] = value
+	}
+	if delivery.ContentType != "" {
+		headers["Content-Type"] = delivery.ContentType
+	}
+	headers[DeliveryIdHeader] = delivery.Id
+	headers[DeliveryAttemptHeader] = strconv.Itoa(delivery.Attempts)
+	if delivery.Event != "" {
+		headers[DeliveryEventHeader] = delivery.Event
+	}
+	if delivery.RequestId != "" {
+		headers[requestid.Header] = delivery.RequestId
+	}
+
+	signer := cs.signer
+	if delivery.SubscriptionId != "" {
+		subscription, err := cs.webhookRepo.Get(ctx, delivery.SubscriptionId)
+		if errors.Is(err, repository.ErrWebhookNotFound) {
+			metrics.CallbackAttempts.WithLabelValues(metrics.OutcomeFailed).Inc()
+			delivery.Status = entity.DeliveryFailed
+			delivery.LastError = "webhook subscription was deleted"
+			delivery.UpdatedAt = time.Now().UTC()
+			cs.save(ctx, *delivery)
+			cs.complete(ctx, id)
+			return
+		}
+		if err != nil {
+			cs.Logger.ErrorContext(ctx, "Failed to load webhook subscription", "delivery_id", id, "error", err)
+			return
+		}
+		signer, err = signature.NewSigner(signature.Key{Id: subscription.Id, Secret: subscription.Secret})
+		if err != nil {
+			cs.Logger.ErrorContext(ctx, "Failed to create webhook signer", "delivery_id", id, "error", err)
+			return
+		}
+	}
+	if signer != nil {
+		for key, value := range signer.Sign(body, time.Now()) {
+			headers[key] = value
+		}
+	}
+
+	method := delivery.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+	resp, err := cs.restClient.Do(ctx, method, delivery.Url, body,
+		restclient.WithHeaders(headers),
+		restclient.WithRetry(restclient.DefaultRetryPolicy()),
+		restclient.WithTimeout(callbackTimeout))
+
+	now := time.Now().UTC()
+	delivery.UpdatedAt = now
+	if resp != nil {
+		delivery.LastStatusCode = resp.StatusCode
+	}
+
+	if err == nil {
+		metrics.CallbackAttempts.WithLabelValues(metrics.OutcomeDelivered).Inc()
+		delivery.Status = entity.DeliveryDelivered
+		delivery.LastError = ""
+		delivery.NextAttemptAt = time.Time{}
+		cs.save(ctx, *delivery)
+		cs.complete(ctx, id)
+		return
+	}
+
+	delivery.LastError = err.Error()
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+	if delivery.Attempts >= delivery.MaxAttempts || isPermanentFailure(err) {
+		metrics.CallbackAttempts.WithLabelValues(metrics.OutcomeFailed).Inc()
+		delivery.Status = entity.DeliveryFailed
+		delivery.NextAttemptAt = time.Time{}
+		cs.Logger.ErrorContext(ctx, "Callback delivery failed permanently", "delivery_id", id, "url", delivery.Url, "attempts", delivery.Attempts, "error", err)
+		cs.save(ctx, *delivery)
+		cs.complete(ctx, id)
+		return
+	}
+
+	metrics.CallbackAttempts.WithLabelValues(metrics.OutcomeRetried).Inc()
+	delivery.NextAttemptAt = now.Add(deliveryBackoff[min(delivery.Attempts-1, len(deliveryBackoff)-1)])
+	cs.Logger.WarnContext(ctx, "Callback delivery attempt failed", "delivery_id", id, "url", delivery.Url, "attempts", delivery.Attempts, "next_attempt_at", delivery.NextAttemptAt, "error", err)
+	cs.save(ctx, *delivery)
+	if err := cs.callbackRepo.Schedule(ctx, id, delivery.NextAttemptAt); err != nil {
+		cs.Logger.ErrorContext(ctx, "Failed to reschedule delivery", "delivery_id", id, "error", err)
+	}
+}
+
+// traceParent returns the W3C traceparent of the span in ctx, or an empty string.
+func traceParent(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	return carrier.Get("traceparent")
+}
+
+// startAttemptSpan starts the span of a delivery attempt. Attempts run long after
+// the enqueuing request, so they start their own trace linked to it.
+func startAttemptSpan(ctx context.Context, delivery *entity.CallbackDelivery) (context.Context, trace.Span) {
+	options := []trace.SpanStartOption{
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(
+			attribute.String("callback.delivery_id", delivery.Id),
+			attribute.Int("callback.attempt", delivery.Attempts),
+		),
+	}
+	if delivery.TraceParent != "" {
+		carrier := propagation.MapCarrier{"traceparent": delivery.TraceParent}
+		linked := otel.GetTextMapPropagator().Extract(context.Background(), carrier)
+		if link := trace.LinkFromContext(linked); link.SpanContext.IsValid() {
+			options = append(options, trace.WithLinks(link))
+		}
+	}
+	return tracing.Tracer().Start(ctx, "callback deliver", options...)
+}
+
+func (cs *implCallbackService) save(ctx context.Context, delivery entity.CallbackDelivery) {
+	if err := cs.callbackRepo.SaveDelivery(ctx, delivery); err != nil {
+		cs.Logger.ErrorContext(ctx, "Failed to save delivery", "delivery_id", delivery.Id, "error", err)
+	}
+}
+
+func (cs *implCallbackService) complete(ctx context.Context, id string) {
+	if err := cs.callbackRepo.Complete(ctx, id); err != nil {
+		cs.Logger.ErrorContext(ctx, "Failed to remove delivery from queue", "delivery_id", id, "error", err)
+	}
+}
+
+// isPermanentFailure reports whether retrying later cannot help: the url policy
+// refused the url, or the receiver rejected the callback with a client error
+// other than a timeout or a rate limit.
+func isPermanentFailure(err error) bool {
+	var violation *urlpolicy.Violation
+	if errors.As(err, &violation) {
+		return true
+	}
+	var statusErr *restclient.StatusError
+	if !errors.As(err, &statusErr) || statusErr.Class() != restclient.ClassClientError {
+		return false
+	}
+	return statusErr.StatusCode != http.StatusRequestTimeout && statusErr.StatusCode != http.StatusTooManyRequests
+}
+
+func newId() (string, error) {
+	return randomHex(16)
+}
+
+func randomHex(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate random id: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,189 @@
+package service
+
+import (
+	"Verve/internal/model/entity"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrBucketFull is returned when the degraded mode bucket cannot take more ids.
+var ErrBucketFull = errors.New("degraded mode bucket is full")
+
+// LocalBucket keeps the ids and callback urls accepted while Redis is unreachable,
+// until they are reconciled into Redis. They are kept per window, so that every
+// window gets its own ids back, and ids are deduplicated per window and namespace,
+// so the bucket only grows with unique ids.
+type LocalBucket struct {
+	maxIds int
+
+	mu      sync.Mutex
+	windows map[int64]*bucketWindow
+	count   int
+	since   time.Time
+}
+
+type bucketWindow struct {
+	window time.Time
+	ids    map[string]map[string]struct{}
+	urls   map[string]struct{}
+}
+
+// BucketWindow is the content of the bucket for one window.
+type BucketWindow struct {
+	Window   time.Time
+	Entities []entity.VerveEntity
+	Urls     []string
+}
+
+// BucketState describes the degraded mode of the instance.
+type BucketState struct {
+	Degraded bool      `json:"degraded"`
+	Ids      int       `json:"ids"`
+	Urls     int       `json:"urls"`
+	MaxIds   int       `json:"max_ids"`
+	Since    time.Time `json:"since"`
+}
+
+func NewLocalBucket(maxIds int) *LocalBucket {
+	return &LocalBucket{
+		maxIds:  maxIds,
+		windows: make(map[int64]*bucketWindow),
+	}
+}
+
+// windowLocked returns the content of the window, creating it when missing.
+func (b *LocalBucket) windowLocked(window time.Time) *bucketWindow {
+	content, ok := b.windows[window.Unix()]
+	if !ok {
+		content = &bucketWindow{
+			window: window,
+			ids:    make(map[string]map[string]struct{}),
+			urls:   make(map[string]struct{}),
+		}
+		b.windows[window.Unix()] = content
+	}
+	return content
+}
+
+// addLocked stores the entities and urls in the window and returns the number of
+// new unique ids.
+func (b *LocalBucket) addLocked(window time.Time, entities []entity.VerveEntity, urls []string) int {
+	content := b.windowLocked(window)
+	added := 0
+	for _, verveEntity := range entities {
+		if content.ids[verveEntity.Namespace] == nil {
+			content.ids[verveEntity.Namespace] = make(map[string]struct{})
+		}
+		if _, ok := content.ids[verveEntity.Namespace][verveEntity.Id]; !ok {
+			content.ids[verveEntity.Namespace][verveEntity.Id] = struct{}{}
+			added++
+		}
+	}
+	for _, url := range urls {
+		content.urls[url] = struct{}{}
+	}
+	return added
+}
+
+// Add stores the entities and urls accepted in the window, all or none:
+// ErrBucketFull is returned when the new unique ids do not fit.
+func (b *LocalBucket) Add(window time.Time, entities []entity.VerveEntity, urls []string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	added := 0
+	content := b.windows[window.Unix()]
+	seen := make(map[entity.VerveEntity]struct{}, len(entities))
+	for _, verveEntity := range entities {
+		if content != nil {
+			if _, ok := content.ids[verveEntity.Namespace][verveEntity.Id]; ok {
+				continue
+			}
+		}
+		if _, ok := seen[verveEntity]; ok {
+			continue
+		}
+		seen[verveEntity] = struct{}{}
+		added++
+	}
+	if b.count+added > b.maxIds {
+		return ErrBucketFull
+	}
+	if len(entities) == 0 && len(urls) == 0 {
+		return nil
+	}
+
+	b.count += b.addLocked(window, entities, urls)
+	if b.since.IsZero() {
+		b.since = time.Now()
+	}
+	return nil
+}
+
+// Drain empties the bucket and returns its content, oldest window first.
+func (b *LocalBucket) Drain() []BucketWindow {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	windows := make([]BucketWindow, 0, len(b.windows))
+	for _, content := range b.windows {
+		drained := BucketWindow{Window: content.window}
+		for namespace, ids := range content.ids {
+			for id := range ids {
+				drained.Entities = append(drained.Entities, entity.VerveEntity{Id: id, Namespace: namespace})
+			}
+		}
+		for url := range content.urls {
+			drained.Urls = append(drained.Urls, url)
+		}
+		windows = append(windows, drained)
+	}
+	sort.Slice(windows, func(i, j int) bool {
+		return windows[i].Window.Before(windows[j].Window)
+	})
+
+	b.windows = make(map[int64]*bucketWindow)
+	b.count = 0
+	b.since = time.Time{}
+	return windows
+}
+
+// Restore puts back the content of a failed reconciliation, ignoring the capacity:
+// the ids were already accepted.
+func (b *LocalBucket) Restore(windows []BucketWindow, since time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, content := range windows {
+		b.count += b.addLocked(content.Window, content.Entities, content.Urls)
+	}
+	if b.since.IsZero() || since.Before(b.since) {
+		b.since = since
+	}
+}
+
+// State returns the current degraded mode state.
+func (b *LocalBucket) State() BucketState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	urls := 0
+	for _, content := range b.windows {
+		urls += len(content.urls)
+	}
+	return BucketState{
+		Degraded: !b.since.IsZero(),
+		Ids:      b.count,
+		Urls:     urls,
+		MaxIds:   b.maxIds,
+		Since:    b.since,
+	}
+}
+
+// Full reports whether the bucket holds its maximum number of ids.
+func (b *LocalBucket) Full() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.count >= b.maxIds
+}
@@ -1,64 +1,376 @@
 package service
 
 import (
-	restclient "Verve/internal/configs/restClient"
+	"Verve/internal/configs/logger"
+	"Verve/internal/database"
 	"Verve/internal/event"
 	"Verve/internal/model/entity"
 	"Verve/internal/model/request"
 	"Verve/internal/repository"
+	"Verve/internal/requestid"
+	"Verve/internal/tracing"
 	"context"
 	"fmt"
 	"log/slog"
 	"strconv"
 	"time"
+
+	"go.opentelemetry.io/otel/codes"
 )
 
 type VerveService interface {
 	SaveAndPost(ctx context.Context, verveRequest request.VerveRequest) error
+	SaveAllAndPost(ctx context.Context, verveRequests []request.VerveRequest) error
 	LogUniqueCountEveryMinute(ctx context.Context)
 	SendUniqueCountEveryMinute(ctx context.Context)
+	FlushWindow(ctx context.Context, window time.Time) error
+	Reconcile(ctx context.Context) error
+	RunReconcileLoop(ctx context.Context)
 }
 
 type implVerveService struct {
-	verveRepo  repository.VerveRepository
-	restClient restclient.RestClient
-	Logger     *slog.Logger
-	Event      event.Event
+	verveRepo repository.VerveRepository
+	callbacks CallbackService
+	webhooks  WebhookService
+	Logger    *slog.Logger
+	Event     event.Event
+	bucket    *LocalBucket
 }
 
-func NewImplVerveService(repository repository.VerveRepository, client restclient.RestClient, logger *slog.Logger, event event.Event) *implVerveService {
+// NewImplVerveService creates the unique count service. With a non nil bucket the
+// service runs in degraded mode while Redis is unreachable: accepted ids are kept
+// in the bucket and reconciled into Redis once it recovers.
+func NewImplVerveService(repository repository.VerveRepository, callbacks CallbackService, webhooks WebhookService, logger *slog.Logger, event event.Event, bucket *LocalBucket) *implVerveService {
 	return &implVerveService{
-		verveRepo:  repository,
-		restClient: client,
-		Logger:     logger,
-		Event:      event,
+		verveRepo: repository,
+		callbacks: callbacks,
+		webhooks:  webhooks,
+		Logger:    logger,
+		Event:     event,
+		bucket:    bucket,
 	}
 }
 
+// callbackPopBatch is the number of urls popped from a window per round trip.
+const callbackPopBatch = 100
+
+// reconcileEvery is how often the degraded mode bucket is reconciled into Redis.
+const reconcileEvery = 5 * time.Second
+
+// ApproximateEventHeader is set on the unique_count event of a window whose count
+// includes ids accepted in degraded mode.
+const ApproximateEventHeader = "X-Verve-Approximate"
+
+// WindowStart returns the start of the one minute window containing t.
+func WindowStart(t time.Time) time.Time {
+	return t.Truncate(time.Minute)
+}
+
+// SaveAndPost stores the id in the current window and registers the url, if any,
+// to receive the unique count once the window closes. A request with a url is
+// refused, before its id is stored, while the callback queue rejects new work.
 func (vs *implVerveService) SaveAndPost(ctx context.Context, verveRequest request.VerveRequest) error {
-	entity := entity.GetEntityFromRequest(verveRequest)
-	err := vs.verveRepo.Save(ctx, entity)
+	verveEntity := entity.GetEntityFromRequest(verveRequest)
+	urls := make([]string, 0, 1)
+	if verveRequest.Url != "" {
+		urls = append(urls, verveRequest.Url)
+	}
+	if err := vs.admitCallbacks(urls); err != nil {
+		return err
+	}
+	window := WindowStart(time.Now())
+	err := vs.verveRepo.Save(ctx, window, verveEntity)
 	if err != nil {
+		return vs.buffer(err, window, []entity.VerveEntity{verveEntity}, urls)
+	}
+	if len(urls) > 0 {
+		if err := vs.verveRepo.RegisterCallbacks(ctx, window, urls...); err != nil {
+			return vs.buffer(err, window, nil, urls)
+		}
+		vs.saveOrigins(ctx, window, []request.VerveRequest{verveRequest})
+	}
+	return nil
+}
+
+// SaveAllAndPost stores a batch of requests in the current window with a single
+// repository call and registers every distinct url in the batch for the window.
+func (vs *implVerveService) SaveAllAndPost(ctx context.Context, verveRequests []request.VerveRequest) error {
+	entities := entity.GetEntitiesFromRequests(verveRequests)
+	seen := make(map[string]struct{})
+	urls := make([]string, 0)
+	for _, verveRequest := range verveRequests {
+		if verveRequest.Url == "" {
+			continue
+		}
+		if _, ok := seen[verveRequest.Url]; ok {
+			continue
+		}
+		seen[verveRequest.Url] = struct{}{}
+		urls = append(urls, verveRequest.Url)
+	}
+	if err := vs.admitCallbacks(urls); err != nil {
 		return err
 	}
-	if verveRequest.Url != "" {
-		go vs.postToUrl(context.Background(), verveRequest.Url)
+	window := WindowStart(time.Now())
+	if err := vs.verveRepo.SaveAll(ctx, window, entities); err != nil {
+		return vs.buffer(err, window, entities, urls)
+	}
+	if err := vs.verveRepo.RegisterCallbacks(ctx, window, urls...); err != nil {
+		return vs.buffer(err, window, nil, urls)
 	}
+	vs.saveOrigins(ctx, window, verveRequests)
 	return nil
 }
 
-func (vs *implVerveService) postToUrl(ctx context.Context, url string) {
-	count, err := vs.verveRepo.GetUniqueCount(ctx)
+// admitCallbacks returns an error wrapping worker.ErrQueueFull when urls would
+// be registered while the callback queue rejects new work.
+func (vs *implVerveService) admitCallbacks(urls []string) error {
+	if len(urls) == 0 {
+		return nil
+	}
+	if err := vs.callbacks.Admit(); err != nil {
+		return fmt.Errorf("callbacks not accepted: %w", err)
+	}
+	return nil
+}
+
+// saveOrigins records the request id and the namespace that registered the urls
+// of the requests, so that their callbacks carry the id and are scoped to the
+// namespace; the first request of a url is kept. It is best effort: the urls are
+// already registered.
+func (vs *implVerveService) saveOrigins(ctx context.Context, window time.Time, verveRequests []request.VerveRequest) {
+	requestId := requestid.FromContext(ctx)
+	origins := make(map[string]entity.CallbackOrigin)
+	for _, verveRequest := range verveRequests {
+		if verveRequest.Url == "" {
+			continue
+		}
+		if _, ok := origins[verveRequest.Url]; !ok {
+			origins[verveRequest.Url] = entity.CallbackOrigin{RequestId: requestId, Namespace: verveRequest.Namespace}
+		}
+	}
+	// An empty origin is the default, it is not worth a round trip.
+	for url, origin := range origins {
+		if origin == (entity.CallbackOrigin{}) {
+			delete(origins, url)
+		}
+	}
+	if len(origins) == 0 {
+		return
+	}
+	if err := vs.verveRepo.SaveCallbackOrigins(ctx, window, origins); err != nil {
+		vs.Logger.WarnContext(ctx, "Failed to record the request of callbacks", "error", err)
+	}
+}
+
+// buffer keeps the entities and urls of the window in the degraded mode bucket when
+// err means Redis is unreachable, and returns err otherwise or when the bucket is full.
+func (vs *implVerveService) buffer(err error, window time.Time, entities []entity.VerveEntity, urls []string) error {
+	if vs.bucket == nil || !database.IsUnavailable(err) {
+		return err
+	}
+	degraded := vs.bucket.State().Degraded
+	if bucketErr := vs.bucket.Add(window, entities, urls); bucketErr != nil {
+		return fmt.Errorf("%w: %w", bucketErr, err)
+	}
+	if !degraded {
+		vs.Logger.Warn("Redis is unreachable, accepting ids in degraded mode", "error", err)
+	}
+	return nil
+}
+
+// Reconcile moves the content of the degraded mode bucket back into the window it
+// was accepted in, oldest first, and flags the window as approximate: its count
+// mixes in ids accepted during the outage. The ids join the sets of their window;
+// a closed window is then flushed with the ids it received before and during the
+// outage, unless another replica already flushed it, in which case only its
+// callbacks are sent. The windows not reconciled are put back in the bucket when
+// Redis is still unreachable.
+func (vs *implVerveService) Reconcile(ctx context.Context) error {
+	if vs.bucket == nil {
+		return nil
+	}
+	state := vs.bucket.State()
+	if !state.Degraded {
+		return nil
+	}
+
+	windows := vs.bucket.Drain()
+	current := WindowStart(time.Now())
+	for i, content := range windows {
+		if err := vs.reconcile(ctx, current, content); err != nil {
+			vs.bucket.Restore(windows[i:], state.Since)
+			return err
+		}
+		vs.Logger.Info("Reconciled degraded mode bucket",
+			"ids", len(content.Entities),
+			"urls", len(content.Urls),
+			"degraded_since", state.Since.Format(time.RFC3339),
+			"window", content.Window.Format(time.RFC3339))
+	}
+	return nil
+}
+
+func (vs *implVerveService) reconcile(ctx context.Context, current time.Time, content BucketWindow) error {
+	window := content.Window
+	if !window.Before(current) {
+		window = current
+	}
+	if err := vs.verveRepo.MarkApproximate(ctx, window); err != nil {
+		return fmt.Errorf("failed to mark window approximate: %w", err)
+	}
+	if len(content.Entities) > 0 {
+		if err := vs.verveRepo.SaveAll(ctx, window, content.Entities); err != nil {
+			return fmt.Errorf("failed to save buffered ids: %w", err)
+		}
+	}
+	if err := vs.verveRepo.RegisterCallbacks(ctx, window, content.Urls...); err != nil {
+		return fmt.Errorf("failed to register buffered callbacks: %w", err)
+	}
+	if window.Equal(current) {
+		return nil
+	}
+	if err := vs.FlushWindow(ctx, window); err != nil {
+		return fmt.Errorf("failed to flush buffered window: %w", err)
+	}
+	return nil
+}
+
+// RunReconcileLoop reconciles the degraded mode bucket until ctx is done.
+func (vs *implVerveService) RunReconcileLoop(ctx context.Context) {
+	ticker := time.NewTicker(reconcileEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := vs.Reconcile(ctx); err != nil {
+				vs.Logger.Debug("Degraded mode bucket not reconciled yet", "error", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// FlushWindow finalizes the unique counts of a closed window from the ids stored
+// for it and sends them once. Only the replica that finalizes the counts publishes
+// the total across namespaces and fans the per namespace roll-up out to webhooks;
+// urls are shared between replicas and receive the count of the namespace that
+// registered them, or the total when it was registered without one. The ids of
+// the window expire on their own.
+func (vs *implVerveService) FlushWindow(ctx context.Context, window time.Time) error {
+	counts, err := vs.verveRepo.GetUniqueCounts(ctx, window)
+	if err != nil {
+		return fmt.Errorf("failed to get unique counts: %w", err)
+	}
+	return vs.flush(ctx, window, counts)
+}
+
+// flush finalizes the counts of the window and sends them.
+func (vs *implVerveService) flush(ctx context.Context, window time.Time, counts map[string]int64) error {
+	finalCounts, owner, err := vs.verveRepo.FinalizeCounts(ctx, window, counts)
 	if err != nil {
-		vs.Logger.Error("Failed to get count", "error", err.Error())
+		return fmt.Errorf("failed to finalize unique counts: %w", err)
 	}
-	jsonData := map[string]int64{"count": count}
-	_, err = vs.restClient.Post(url, jsonData)
+
+	approximate, err := vs.verveRepo.IsApproximate(ctx, window)
+	if err != nil {
+		vs.Logger.Error("Failed to read approximate flag", "error", err)
+	}
+
+	// The event, webhooks and callbacks of a window do not belong to the request
+	// that flushed it, such as POST /admin/window/flush: they are sent without its
+	// request id. Callbacks still carry the id of the request that registered them.
+	windowCtx := ctx
+	if requestid.FromContext(ctx) != "" {
+		windowCtx = requestid.WithID(ctx, "")
+	}
+
+	if owner {
+		publishCtx := windowCtx
+		if approximate {
+			publishCtx = event.WithHeader(windowCtx, ApproximateEventHeader, "true")
+		}
+		if err := vs.Event.Publish(publishCtx, "unique_count", strconv.FormatInt(entity.TotalCount(finalCounts), 10)); err != nil {
+			vs.Logger.Error("Failed to publish unique count", "error", err)
+		}
+		vs.fanoutWebhooks(windowCtx, window, finalCounts, approximate)
+	}
+
+	return vs.dispatchCallbacks(windowCtx, window, finalCounts, approximate)
+}
+
+// fanoutWebhooks sends the roll-up of every namespace with subscriptions to them,
+// with a count of 0 when the namespace received no id in the window. When the
+// namespaces cannot be listed, the counted namespaces are still sent.
+func (vs *implVerveService) fanoutWebhooks(ctx context.Context, window time.Time, counts map[string]int64, approximate bool) {
+	namespaces, err := vs.webhooks.Namespaces(ctx)
 	if err != nil {
-		vs.Logger.Error("Failed to send post request to url", url, err)
+		vs.Logger.Error("Failed to list the namespaces with webhooks", "error", err)
+		namespaces = make([]string, 0, len(counts))
+		for namespace := range counts {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	for _, namespace := range namespaces {
+		payload := windowPayload(window, counts[namespace], approximate)
+		payload.Namespace = namespace
+		if err := vs.webhooks.Fanout(ctx, request.EventUniqueCountRollup, namespace, payload); err != nil {
+			vs.Logger.Error("Failed to fan out webhooks", "namespace", namespace, "error", err)
+		}
+	}
+}
+
+// windowPayload builds the callback payload of a count for the window.
+func windowPayload(window time.Time, count int64, approximate bool) entity.CallbackPayload {
+	return entity.CallbackPayload{
+		Count:       count,
+		WindowStart: window,
+		WindowEnd:   window.Add(time.Minute),
+		Timestamp:   time.Now(),
+		Approximate: approximate,
+	}
+}
+
+// dispatchCallbacks enqueues one durable delivery per url registered for the
+// window, carrying the count of the namespace of the request that registered it
+// or the total of the window.
+func (vs *implVerveService) dispatchCallbacks(ctx context.Context, window time.Time, counts map[string]int64, approximate bool) error {
+	for {
+		urls, err := vs.verveRepo.PopCallbacks(ctx, window, callbackPopBatch)
+		if err != nil {
+			return fmt.Errorf("failed to pop callbacks: %w", err)
+		}
+		if len(urls) == 0 {
+			return nil
+		}
+		origins, err := vs.verveRepo.CallbackOrigins(ctx, window, urls)
+		if err != nil {
+			vs.Logger.Warn("Failed to load the requests of callbacks", "error", err)
+		}
+		for _, url := range urls {
+			// The callback carries the id of the request that registered its url.
+			origin := origins[url]
+			callbackCtx := ctx
+			if origin.RequestId != "" {
+				callbackCtx = requestid.WithID(ctx, origin.RequestId)
+			}
+			payload := windowPayload(window, entity.TotalCount(counts), approximate)
+			if origin.Namespace != "" {
+				payload.Count = counts[origin.Namespace]
+				payload.Namespace = origin.Namespace
+			}
+			id, err := vs.callbacks.Enqueue(callbackCtx, url, payload)
+			if err != nil {
+				vs.Logger.ErrorContext(callbackCtx, "Failed to enqueue callback", "url", url, "error", err)
+				continue
+			}
+			vs.Logger.DebugContext(callbackCtx, "Enqueued callback", "url", url, "delivery_id", id)
+		}
 	}
 }
 
+// LogUniqueCountEveryMinute logs the unique count of the last closed window every minute.
 func (vs *implVerveService) LogUniqueCountEveryMinute(ctx context.Context) {
 	ticker := time.NewTicker(1 * time.Minute)
 	done := make(chan bool)
@@ -66,16 +378,20 @@ func (vs *implVerveService) LogUniqueCountEveryMinute(ctx context.Context) {
 	go func() {
 		for {
 			select {
-			case <-ticker.C:
-				count, err := vs.verveRepo.GetUniqueCount(ctx)
+			case now := <-ticker.C:
+				window := WindowStart(now).Add(-time.Minute)
+				count, err := vs.verveRepo.GetUniqueCount(ctx, window)
 				if err != nil {
 					vs.Logger.Error("Failed to get unique count", "error", err)
 					continue
 				}
 
+				// The counts stream is routed to the count file when one is set.
 				vs.Logger.Info("Unique count in the last minute",
+					logger.Stream(logger.StreamCounts),
 					"count", count,
-					"timestamp", time.Now().Format(time.RFC3339))
+					"window", window.Format(time.RFC3339),
+					"timestamp", now.Format(time.RFC3339))
 
 			case <-ctx.Done():
 				ticker.Stop()
@@ -88,8 +404,10 @@ func (vs *implVerveService) LogUniqueCountEveryMinute(ctx context.Context) {
 	<-done
 }
 
+// SendUniqueCountEveryMinute flushes every window as soon as it closes, on wall
+// clock minute boundaries so that all replicas agree on the window.
 func (vs *implVerveService) SendUniqueCountEveryMinute(ctx context.Context) {
-	ticker := time.NewTicker(1 * time.Minute)
+	timer := time.NewTimer(time.Until(WindowStart(time.Now()).Add(time.Minute)))
 	done := make(chan bool)
 
 	go func() {
@@ -100,23 +418,20 @@ func (vs *implVerveService) SendUniqueCountEveryMinute(ctx context.Context) {
 		}()
 		for {
 			select {
-			case <-ticker.C:
-				count, err := vs.verveRepo.GetUniqueCount(ctx)
-				if err != nil {
-					vs.Logger.Error("Failed to get unique count", "error", err)
-					continue
-				}
-				err = vs.verveRepo.Delete(ctx)
-				if err != nil {
-					vs.Logger.Error("Failed to delete unique count", "error", err)
-					errs := fmt.Errorf("failed to delete unique count %w", err)
-					panic(errs)
+			case now := <-timer.C:
+				current := WindowStart(now)
+				// A flush that has started completes even when the loop is being stopped.
+				flushCtx, span := tracing.Tracer().Start(context.WithoutCancel(ctx), "flush window")
+				if err := vs.FlushWindow(flushCtx, current.Add(-time.Minute)); err != nil {
+					span.RecordError(err)
+					span.SetStatus(codes.Error, err.Error())
+					vs.Logger.Error("Failed to flush window", "error", err)
 				}
-
-				vs.Event.Publish(ctx, "unique_count", strconv.FormatInt(count, 10))
+				span.End()
+				timer.Reset(time.Until(current.Add(time.Minute)))
 
 			case <-ctx.Done():
-				ticker.Stop()
+				timer.Stop()
 				done <- true
 				return
 			}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"Verve/internal/model/entity"
+	"Verve/internal/model/request"
+	"Verve/internal/repository"
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// generatedSecretBytes is the size of the secret generated when none is given.
+const generatedSecretBytes = 32
+
+type WebhookService interface {
+	Create(ctx context.Context, webhook request.WebhookRequest) (*entity.WebhookSubscription, error)
+	Get(ctx context.Context, id string) (*entity.WebhookSubscription, error)
+	List(ctx context.Context, namespace string) ([]entity.WebhookSubscription, error)
+	Delete(ctx context.Context, id string) error
+	Fanout(ctx context.Context, event string, namespace string, payload entity.CallbackPayload) error
+	// Namespaces returns the namespaces holding at least one subscription.
+	Namespaces(ctx context.Context) ([]string, error)
+}
+
+type implWebhookService struct {
+	webhookRepo repository.WebhookRepository
+	callbacks   CallbackService
+	Logger      *slog.Logger
+}
+
+func NewImplWebhookService(repository repository.WebhookRepository, callbacks CallbackService, logger *slog.Logger) *implWebhookService {
+	return &implWebhookService{
+		webhookRepo: repository,
+		callbacks:   callbacks,
+		Logger:      logger,
+	}
+}
+
+// Create stores a validated subscription. When no secret is given one is generated;
+// the returned subscription is the only place the secret is ever shown.
+func (ws *implWebhookService) Create(ctx context.Context, webhook request.WebhookRequest) (*entity.WebhookSubscription, error) {
+	id, err := newId()
+	if err != nil {
+		return nil, err
+	}
+	if webhook.Secret == "" {
+		webhook.Secret, err = randomHex(generatedSecretBytes)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	subscription := entity.GetSubscriptionFromRequest(id, webhook, time.Now().UTC())
+	if err := ws.webhookRepo.Save(ctx, subscription); err != nil {
+		return nil, fmt.Errorf("failed to save webhook: %w", err)
+	}
+	return &subscription, nil
+}
+
+func (ws *implWebhookService) Get(ctx context.Context, id string) (*entity.WebhookSubscription, error) {
+	subscription, err := ws.webhookRepo.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	redacted := subscription.Redacted()
+	return &redacted, nil
+}
+
+func (ws *implWebhookService) List(ctx context.Context, namespace string) ([]entity.WebhookSubscription, error) {
+	subscriptions, err := ws.webhookRepo.ListByNamespace(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+	for i := range subscriptions {
+		subscriptions[i] = subscriptions[i].Redacted()
+	}
+	return subscriptions, nil
+}
+
+func (ws *implWebhookService) Delete(ctx context.Context, id string) error {
+	return ws.webhookRepo.Delete(ctx, id)
+}
+
+func (ws *implWebhookService) Namespaces(ctx context.Context) ([]string, error) {
+	return ws.webhookRepo.ListNamespaces(ctx)
+}
+
+// Fanout enqueues one delivery of the event per subscription of the namespace that wants it.
+func (ws *implWebhookService) Fanout(ctx context.Context, event string, namespace string, payload entity.CallbackPayload) error {
+	subscriptions, err := ws.webhookRepo.ListByNamespace(ctx, namespace)
+	if err != nil {
+		return fmt.Errorf("failed to list webhooks: %w", err)
+	}
+	for _, subscription := range subscriptions {
+		if !subscription.Matches(event) {
+			continue
+		}
+		id, err := ws.callbacks.EnqueueWebhook(ctx, subscription, event, payload)
+		if err != nil {
+			ws.Logger.Error("Failed to enqueue webhook", "webhook_id", subscription.Id, "error", err)
+			continue
+		}
+		ws.Logger.Debug("Enqueued webhook", "webhook_id", subscription.Id, "delivery_id", id)
+	}
+	return nil
+}
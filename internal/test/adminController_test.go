@@ -0,0 +1,182 @@
+package test
+
+import (
+	e "Verve/internal/configs/errorResponse"
+	"Verve/internal/controller"
+	"Verve/internal/event"
+	"Verve/internal/model/entity"
+	"Verve/internal/model/request"
+	"Verve/internal/repository"
+	"Verve/internal/service"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// Mock APIKeyService
+type MockAPIKeyService struct {
+	mock.Mock
+}
+
+func (m *MockAPIKeyService) Create(ctx context.Context, apiKey request.APIKeyRequest) (*entity.APIKey, error) {
+	args := m.Called(ctx, apiKey)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*entity.APIKey), args.Error(1)
+}
+
+func (m *MockAPIKeyService) Authenticate(ctx context.Context, key string) (*entity.APIKey, error) {
+	args := m.Called(ctx, key)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*entity.APIKey), args.Error(1)
+}
+
+func (m *MockAPIKeyService) Revoke(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+// Mock AdminService
+type MockAdminService struct {
+	mock.Mock
+}
+
+func (m *MockAdminService) Window(ctx context.Context) (service.WindowState, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(service.WindowState), args.Error(1)
+}
+
+func (m *MockAdminService) FlushCurrentWindow(ctx context.Context) (service.WindowState, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(service.WindowState), args.Error(1)
+}
+
+func (m *MockAdminService) ResetNamespace(ctx context.Context, namespace string) error {
+	args := m.Called(ctx, namespace)
+	return args.Error(0)
+}
+
+func (m *MockAdminService) PausePublisher() event.PublisherState {
+	args := m.Called()
+	return args.Get(0).(event.PublisherState)
+}
+
+func (m *MockAdminService) ResumePublisher(ctx context.Context) (event.PublisherState, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(event.PublisherState), args.Error(1)
+}
+
+func (m *MockAdminService) LogLevel() slog.Level {
+	args := m.Called()
+	return args.Get(0).(slog.Level)
+}
+
+func (m *MockAdminService) SetLogLevel(level slog.Level) {
+	m.Called(level)
+}
+
+func TestCreateAPIKey(t *testing.T) {
+	t.Run("returns the key once with default scopes", func(t *testing.T) {
+		mockKeys := new(MockAPIKeyService)
+		c := controller.NewAdminController(mockKeys, new(MockAdminService))
+
+		created := &entity.APIKey{Id: "k1", Namespace: "shop", Scopes: []string{request.ScopeAccept}, Key: "vk_secret"}
+		mockKeys.On("Create", mock.Anything, mock.MatchedBy(func(k request.APIKeyRequest) bool {
+			return k.Namespace == "shop" && len(k.Scopes) == 1 && k.Scopes[0] == request.ScopeAccept
+		})).Return(created, nil).Once()
+
+		w := httptest.NewRecorder()
+		c.CreateAPIKey(w, httptest.NewRequest(http.MethodPost, "/admin/keys", strings.NewReader(`{"name":"shop","namespace":"shop"}`)))
+
+		var apiKey entity.APIKey
+		assert.NoError(t, json.NewDecoder(w.Body).Decode(&apiKey))
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, "vk_secret", apiKey.Key)
+		mockKeys.AssertExpectations(t)
+	})
+
+	t.Run("rejects unknown scopes", func(t *testing.T) {
+		c := controller.NewAdminController(new(MockAPIKeyService), new(MockAdminService))
+
+		w := httptest.NewRecorder()
+		c.CreateAPIKey(w, httptest.NewRequest(http.MethodPost, "/admin/keys", strings.NewReader(`{"scopes":["everything"]}`)))
+
+		var problem e.Problem
+		assert.NoError(t, json.NewDecoder(w.Body).Decode(&problem))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, e.CodeValidation, problem.Code)
+	})
+}
+
+func TestRevokeAPIKeyNotFound(t *testing.T) {
+	mockKeys := new(MockAPIKeyService)
+	c := controller.NewAdminController(mockKeys, new(MockAdminService))
+
+	mockKeys.On("Revoke", mock.Anything, "k1").Return(repository.ErrAPIKeyNotFound).Once()
+
+	router := chi.NewRouter()
+	router.Delete("/admin/keys/{id}", c.RevokeAPIKey)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/admin/keys/k1", nil))
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	mockKeys.AssertExpectations(t)
+}
+
+func TestPutLogLevel(t *testing.T) {
+	t.Run("changes the level", func(t *testing.T) {
+		mockAdmin := new(MockAdminService)
+		c := controller.NewAdminController(new(MockAPIKeyService), mockAdmin)
+
+		mockAdmin.On("SetLogLevel", slog.LevelDebug).Once()
+		mockAdmin.On("LogLevel").Return(slog.LevelDebug)
+
+		w := httptest.NewRecorder()
+		c.PutLogLevel(w, httptest.NewRequest(http.MethodPut, "/admin/log-level", strings.NewReader(`{"level":"debug"}`)))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"level":"DEBUG"}`, w.Body.String())
+		mockAdmin.AssertExpectations(t)
+	})
+
+	t.Run("rejects unknown levels", func(t *testing.T) {
+		c := controller.NewAdminController(new(MockAPIKeyService), new(MockAdminService))
+
+		w := httptest.NewRecorder()
+		c.PutLogLevel(w, httptest.NewRequest(http.MethodPut, "/admin/log-level", strings.NewReader(`{"level":"verbose"}`)))
+
+		var problem e.Problem
+		assert.NoError(t, json.NewDecoder(w.Body).Decode(&problem))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, "level.invalid_format", problem.Details[0].Code)
+	})
+}
+
+func TestResetNamespace(t *testing.T) {
+	mockAdmin := new(MockAdminService)
+	c := controller.NewAdminController(new(MockAPIKeyService), mockAdmin)
+	router := chi.NewRouter()
+	router.Delete("/admin/namespaces/{namespace}", c.ResetNamespace)
+
+	mockAdmin.On("ResetNamespace", mock.Anything, "shop").Return(nil).Once()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/admin/namespaces/shop", nil))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/admin/namespaces/sh%20op", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	mockAdmin.AssertExpectations(t)
+}
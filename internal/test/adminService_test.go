@@ -0,0 +1,117 @@
+package test
+
+import (
+	"Verve/internal/event"
+	"Verve/internal/service"
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestPausablePublisher(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("holds messages while paused and publishes them in order on resume", func(t *testing.T) {
+		mockEvent := new(MockEvent)
+		publisher := event.NewPausableEvent(mockEvent, 10)
+
+		publisher.Pause()
+		assert.NoError(t, publisher.Publish(ctx, "unique_count", "1"))
+		assert.NoError(t, publisher.Publish(ctx, "unique_count", "2"))
+		assert.Equal(t, 2, publisher.State().Held)
+		mockEvent.AssertNotCalled(t, "Publish", mock.Anything, mock.Anything, mock.Anything)
+
+		first := mockEvent.On("Publish", mock.Anything, "unique_count", "1").Return(nil).Once()
+		mockEvent.On("Publish", mock.Anything, "unique_count", "2").Return(nil).Once().NotBefore(first)
+		state, err := publisher.Resume(ctx)
+		assert.NoError(t, err)
+		assert.False(t, state.Paused)
+		assert.Equal(t, 0, state.Held)
+		mockEvent.AssertExpectations(t)
+	})
+
+	t.Run("stays paused when a held message fails", func(t *testing.T) {
+		mockEvent := new(MockEvent)
+		publisher := event.NewPausableEvent(mockEvent, 10)
+
+		publisher.Pause()
+		assert.NoError(t, publisher.Publish(ctx, "unique_count", "1"))
+		mockEvent.On("Publish", mock.Anything, "unique_count", "1").Return(errors.New("broker down")).Once()
+
+		state, err := publisher.Resume(ctx)
+		assert.Error(t, err)
+		assert.True(t, state.Paused)
+		assert.Equal(t, 1, state.Held)
+	})
+
+	t.Run("publishes the held messages before closing", func(t *testing.T) {
+		mockEvent := new(MockEvent)
+		publisher := event.NewPausableEvent(mockEvent, 10)
+
+		publisher.Pause()
+		assert.NoError(t, publisher.Publish(ctx, "unique_count", "1"))
+		publish := mockEvent.On("Publish", mock.Anything, "unique_count", "1").Return(nil).Once()
+		mockEvent.On("Close").Return(nil).Once().NotBefore(publish)
+
+		assert.NoError(t, publisher.Shutdown(ctx))
+		mockEvent.AssertExpectations(t)
+	})
+
+	t.Run("fails the shutdown when held messages are lost", func(t *testing.T) {
+		mockEvent := new(MockEvent)
+		publisher := event.NewPausableEvent(mockEvent, 10)
+
+		publisher.Pause()
+		assert.NoError(t, publisher.Publish(ctx, "unique_count", "1"))
+		assert.NoError(t, publisher.Publish(ctx, "unique_count", "2"))
+		mockEvent.On("Publish", mock.Anything, "unique_count", "1").Return(errors.New("broker down")).Once()
+		mockEvent.On("Close").Return(nil).Once()
+
+		err := publisher.Close()
+		assert.ErrorIs(t, err, event.ErrHeldMessagesLost)
+		assert.ErrorContains(t, err, "2 messages")
+		mockEvent.AssertExpectations(t)
+	})
+
+	t.Run("rejects messages once full", func(t *testing.T) {
+		publisher := event.NewPausableEvent(new(MockEvent), 1)
+
+		publisher.Pause()
+		assert.NoError(t, publisher.Publish(ctx, "unique_count", "1"))
+		assert.ErrorIs(t, publisher.Publish(ctx, "unique_count", "2"), event.ErrPublisherPaused)
+	})
+}
+
+func TestAdminServiceWindow(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockVerveRepository)
+	bucket := service.NewLocalBucket(10)
+	adminService := service.NewImplAdminService(new(MockVerveService), mockRepo, event.NewPausableEvent(new(MockEvent), 10), bucket, new(slog.LevelVar), slog.Default())
+
+	window := service.WindowStart(time.Now())
+	mockRepo.On("GetUniqueCounts", ctx, currentWindow).Return(map[string]int64{"": 3, "shop": 1}, nil)
+	mockRepo.On("IsApproximate", ctx, mock.AnythingOfType("time.Time")).Return(false, nil)
+	mockRepo.On("CountCallbacks", ctx, mock.AnythingOfType("time.Time")).Return(int64(2), nil)
+
+	state, err := adminService.Window(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, window, state.WindowStart)
+	assert.Equal(t, int64(1), state.Counts["shop"])
+	assert.Equal(t, int64(2), state.Callbacks)
+	assert.NotNil(t, state.Degraded)
+	assert.False(t, state.Publisher.Paused)
+}
+
+func TestAdminServiceSetLogLevel(t *testing.T) {
+	level := new(slog.LevelVar)
+	adminService := service.NewImplAdminService(new(MockVerveService), new(MockVerveRepository), event.NewPausableEvent(new(MockEvent), 10), nil, level, slog.Default())
+
+	adminService.SetLogLevel(slog.LevelDebug)
+	assert.Equal(t, slog.LevelDebug, level.Level())
+	assert.Equal(t, slog.LevelDebug, adminService.LogLevel())
+}
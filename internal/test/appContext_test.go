@@ -0,0 +1,45 @@
+package test
+
+import (
+	appcontext "Verve/internal/configs/appContext"
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestAppContextTasks(t *testing.T) {
+	untilDone := func(args mock.Arguments) {
+		<-args.Get(0).(context.Context).Done()
+	}
+	newApp := func() (*appcontext.AppContext, *MockVerveService, *MockCallbackService) {
+		mockVerve := new(MockVerveService)
+		mockCallbacks := new(MockCallbackService)
+		mockVerve.On("LogUniqueCountEveryMinute", mock.Anything).Run(untilDone).Once()
+		mockVerve.On("SendUniqueCountEveryMinute", mock.Anything).Run(untilDone).Once()
+		mockVerve.On("FlushWindow", mock.Anything, mock.AnythingOfType("time.Time")).Return(nil).Once()
+		mockCallbacks.On("RunDeliveryLoop", mock.Anything).Run(untilDone).Once()
+		return &appcontext.AppContext{
+			Logger:          slog.Default(),
+			VerveService:    mockVerve,
+			CallbackService: mockCallbacks,
+		}, mockVerve, mockCallbacks
+	}
+
+	// Two instances run side by side and stop independently, flushing the last window.
+	first, firstVerve, firstCallbacks := newApp()
+	second, _, _ := newApp()
+	assert.NoError(t, first.StartTasks(context.Background()))
+	assert.NoError(t, second.StartTasks(context.Background()))
+	assert.Error(t, first.StartTasks(context.Background()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, first.StopTasks(ctx))
+	firstVerve.AssertExpectations(t)
+	firstCallbacks.AssertExpectations(t)
+	assert.NoError(t, second.StopTasks(ctx))
+}
@@ -0,0 +1,367 @@
+package test
+
+import (
+	restclient "Verve/internal/configs/restClient"
+	urlpolicy "Verve/internal/configs/urlPolicy"
+	"Verve/internal/model/entity"
+	"Verve/internal/model/request"
+	"Verve/internal/repository"
+	"Verve/internal/requestid"
+	"Verve/internal/service"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// Mock CallbackRepository
+type MockCallbackRepository struct {
+	mock.Mock
+}
+
+func (m *MockCallbackRepository) SaveDelivery(ctx context.Context, delivery entity.CallbackDelivery) error {
+	args := m.Called(ctx, delivery)
+	return args.Error(0)
+}
+
+func (m *MockCallbackRepository) GetDelivery(ctx context.Context, id string) (*entity.CallbackDelivery, error) {
+	args := m.Called(ctx, id)
+	delivery, _ := args.Get(0).(*entity.CallbackDelivery)
+	return delivery, args.Error(1)
+}
+
+func (m *MockCallbackRepository) IndexDelivery(ctx context.Context, delivery entity.CallbackDelivery) error {
+	args := m.Called(ctx, delivery)
+	return args.Error(0)
+}
+
+func (m *MockCallbackRepository) FindDeliveries(ctx context.Context, window time.Time, url string) ([]string, error) {
+	args := m.Called(ctx, window, url)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockCallbackRepository) Schedule(ctx context.Context, id string, at time.Time) error {
+	args := m.Called(ctx, id, at)
+	return args.Error(0)
+}
+
+func (m *MockCallbackRepository) ClaimDue(ctx context.Context, now time.Time, limit int64, lease time.Duration) ([]string, error) {
+	args := m.Called(ctx, now, limit, lease)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockCallbackRepository) Complete(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockCallbackRepository) SaveTemplate(ctx context.Context, template entity.CallbackTemplate) error {
+	args := m.Called(ctx, template)
+	return args.Error(0)
+}
+
+func (m *MockCallbackRepository) GetTemplate(ctx context.Context, namespace, url string) (*entity.CallbackTemplate, error) {
+	args := m.Called(ctx, namespace, url)
+	template, _ := args.Get(0).(*entity.CallbackTemplate)
+	return template, args.Error(1)
+}
+
+func (m *MockCallbackRepository) DeleteTemplate(ctx context.Context, namespace, url string) error {
+	args := m.Called(ctx, namespace, url)
+	return args.Error(0)
+}
+
+func TestEnqueue(t *testing.T) {
+	window := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	payload := entity.CallbackPayload{
+		Count:       7,
+		WindowStart: window,
+		WindowEnd:   window.Add(time.Minute),
+		Namespace:   "tenant",
+		Timestamp:   window.Add(time.Minute),
+	}
+
+	t.Run("uses the default json count body without a template", func(t *testing.T) {
+		mockRepo := new(MockCallbackRepository)
+		logger := slog.Default()
+		callbacks := service.NewImplCallbackService(mockRepo, new(MockWebhookRepository), new(MockRestClient), logger, newTestPool(t, logger), nil)
+		ctx := context.Background()
+
+		mockRepo.On("GetTemplate", ctx, "tenant", "http://a.com").Return(nil, repository.ErrTemplateNotFound).Once()
+		mockRepo.On("SaveDelivery", ctx, mock.MatchedBy(func(d entity.CallbackDelivery) bool {
+			return d.Url == "http://a.com" && d.Method == http.MethodPost && d.ContentType == "application/json" &&
+				d.Body == `{"count":7}` && d.Status == entity.DeliveryPending && d.Attempts == 0
+		})).Return(nil).Once()
+		mockRepo.On("IndexDelivery", ctx, mock.MatchedBy(func(d entity.CallbackDelivery) bool {
+			return d.Url == "http://a.com" && d.WindowStart.Equal(window) && d.Namespace == "tenant"
+		})).Return(nil).Once()
+		mockRepo.On("Schedule", ctx, mock.AnythingOfType("string"), mock.AnythingOfType("time.Time")).Return(nil).Once()
+
+		id, err := callbacks.Enqueue(ctx, "http://a.com", payload)
+		assert.NoError(t, err)
+		assert.Len(t, id, 32)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("records the request that spawned the delivery", func(t *testing.T) {
+		mockRepo := new(MockCallbackRepository)
+		logger := slog.Default()
+		callbacks := service.NewImplCallbackService(mockRepo, new(MockWebhookRepository), new(MockRestClient), logger, newTestPool(t, logger), nil)
+		ctx := requestid.WithID(context.Background(), "req-1")
+
+		mockRepo.On("GetTemplate", ctx, "tenant", "http://a.com").Return(nil, repository.ErrTemplateNotFound).Once()
+		mockRepo.On("SaveDelivery", ctx, mock.MatchedBy(func(d entity.CallbackDelivery) bool {
+			return d.RequestId == "req-1"
+		})).Return(nil).Once()
+		mockRepo.On("IndexDelivery", ctx, mock.Anything).Return(nil).Once()
+		mockRepo.On("Schedule", ctx, mock.AnythingOfType("string"), mock.AnythingOfType("time.Time")).Return(nil).Once()
+
+		_, err := callbacks.Enqueue(ctx, "http://a.com", payload)
+		assert.NoError(t, err)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("renders the registered template", func(t *testing.T) {
+		mockRepo := new(MockCallbackRepository)
+		logger := slog.Default()
+		callbacks := service.NewImplCallbackService(mockRepo, new(MockWebhookRepository), new(MockRestClient), logger, newTestPool(t, logger), nil)
+		ctx := context.Background()
+
+		mockRepo.On("GetTemplate", ctx, "tenant", "http://a.com").Return(&entity.CallbackTemplate{
+			Url:         "http://a.com",
+			Method:      http.MethodPut,
+			ContentType: request.ContentTypeForm,
+			Fields:      []string{request.FieldCount, request.FieldNamespace, request.FieldWindowStart},
+			Headers:     map[string]string{"X-Partner": "p1"},
+		}, nil).Once()
+		mockRepo.On("SaveDelivery", ctx, mock.MatchedBy(func(d entity.CallbackDelivery) bool {
+			return d.Method == http.MethodPut && d.ContentType == "application/x-www-form-urlencoded" &&
+				d.Body == "count=7&namespace=tenant&window_start=2024-01-01T10%3A00%3A00Z" &&
+				d.Headers["X-Partner"] == "p1"
+		})).Return(nil).Once()
+		mockRepo.On("IndexDelivery", ctx, mock.Anything).Return(nil).Once()
+		mockRepo.On("Schedule", ctx, mock.AnythingOfType("string"), mock.AnythingOfType("time.Time")).Return(nil).Once()
+
+		_, err := callbacks.Enqueue(ctx, "http://a.com", payload)
+		assert.NoError(t, err)
+		mockRepo.AssertExpectations(t)
+	})
+}
+
+func TestEnqueueIgnoresTheTemplatesOfOtherNamespaces(t *testing.T) {
+	window := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	mockRepo := new(MockCallbackRepository)
+	logger := slog.Default()
+	callbacks := service.NewImplCallbackService(mockRepo, new(MockWebhookRepository), new(MockRestClient), logger, newTestPool(t, logger), nil)
+	ctx := context.Background()
+
+	// The blog namespace registered a template on the url of the shop namespace.
+	mockRepo.On("GetTemplate", ctx, "blog", "http://shop.com").Return(&entity.CallbackTemplate{
+		Url:       "http://shop.com",
+		Method:    http.MethodPut,
+		Headers:   map[string]string{"X-Injected": "1"},
+		Namespace: "blog",
+	}, nil).Maybe()
+	mockRepo.On("GetTemplate", ctx, "shop", "http://shop.com").Return(nil, repository.ErrTemplateNotFound).Once()
+	mockRepo.On("SaveDelivery", ctx, mock.MatchedBy(func(d entity.CallbackDelivery) bool {
+		return d.Method == http.MethodPost && d.Body == `{"count":3}` && len(d.Headers) == 0
+	})).Return(nil).Once()
+	mockRepo.On("IndexDelivery", ctx, mock.Anything).Return(nil).Once()
+	mockRepo.On("Schedule", ctx, mock.AnythingOfType("string"), mock.AnythingOfType("time.Time")).Return(nil).Once()
+
+	_, err := callbacks.Enqueue(ctx, "http://shop.com", entity.CallbackPayload{Count: 3, WindowStart: window, Namespace: "shop"})
+	assert.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestFindDeliveries(t *testing.T) {
+	window := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	mockRepo := new(MockCallbackRepository)
+	logger := slog.Default()
+	callbacks := service.NewImplCallbackService(mockRepo, new(MockWebhookRepository), new(MockRestClient), logger, newTestPool(t, logger), nil)
+	ctx := context.Background()
+
+	mockRepo.On("FindDeliveries", ctx, window, "http://a.com").Return([]string{"d2", "expired", "d1"}, nil).Once()
+	mockRepo.On("GetDelivery", ctx, "d1").Return(&entity.CallbackDelivery{Id: "d1", CreatedAt: window.Add(time.Minute)}, nil).Once()
+	mockRepo.On("GetDelivery", ctx, "d2").Return(&entity.CallbackDelivery{Id: "d2", CreatedAt: window.Add(2 * time.Minute)}, nil).Once()
+	mockRepo.On("GetDelivery", ctx, "expired").Return(nil, repository.ErrDeliveryNotFound).Once()
+
+	deliveries, err := callbacks.FindDeliveries(ctx, "http://a.com", window)
+	assert.NoError(t, err)
+	if assert.Len(t, deliveries, 2) {
+		assert.Equal(t, "d1", deliveries[0].Id)
+		assert.Equal(t, "d2", deliveries[1].Id)
+	}
+	mockRepo.AssertExpectations(t)
+}
+
+func TestProcessDue(t *testing.T) {
+	pending := func() *entity.CallbackDelivery {
+		return &entity.CallbackDelivery{
+			Id:          "d1",
+			Url:         "http://a.com",
+			Body:        `{"count":7}`,
+			Status:      entity.DeliveryPending,
+			Attempts:    0,
+			MaxAttempts: 10,
+		}
+	}
+
+	t.Run("successful attempt marks the delivery delivered", func(t *testing.T) {
+		mockRepo := new(MockCallbackRepository)
+		mockRestClient := new(MockRestClient)
+		logger := slog.Default()
+		pool := newTestPool(t, logger)
+		callbacks := service.NewImplCallbackService(mockRepo, new(MockWebhookRepository), mockRestClient, logger, pool, nil)
+
+		mockRepo.On("ClaimDue", mock.Anything, mock.Anything, int64(100), mock.Anything).Return([]string{"d1"}, nil).Once()
+		mockRepo.On("GetDelivery", mock.Anything, "d1").Return(pending(), nil).Once()
+		mockRestClient.On("Do", mock.Anything, http.MethodPost, "http://a.com", []byte(`{"count":7}`)).
+			Return(&restclient.Response{StatusCode: http.StatusOK}, nil).Once()
+		mockRepo.On("SaveDelivery", mock.Anything, mock.MatchedBy(func(d entity.CallbackDelivery) bool {
+			return d.Status == entity.DeliveryDelivered && d.Attempts == 1 && d.LastStatusCode == http.StatusOK
+		})).Return(nil).Once()
+		mockRepo.On("Complete", mock.Anything, "d1").Return(nil).Once()
+
+		assert.NoError(t, callbacks.ProcessDue(context.Background()))
+		assert.NoError(t, pool.Shutdown(context.Background()))
+		mockRepo.AssertExpectations(t)
+		mockRestClient.AssertExpectations(t)
+	})
+
+	t.Run("failed attempt is rescheduled with the last error", func(t *testing.T) {
+		mockRepo := new(MockCallbackRepository)
+		mockRestClient := new(MockRestClient)
+		logger := slog.Default()
+		pool := newTestPool(t, logger)
+		callbacks := service.NewImplCallbackService(mockRepo, new(MockWebhookRepository), mockRestClient, logger, pool, nil)
+
+		statusErr := &restclient.StatusError{Method: http.MethodPost, URL: "http://a.com", StatusCode: http.StatusServiceUnavailable, Attempts: 4}
+		mockRepo.On("ClaimDue", mock.Anything, mock.Anything, int64(100), mock.Anything).Return([]string{"d1"}, nil).Once()
+		mockRepo.On("GetDelivery", mock.Anything, "d1").Return(pending(), nil).Once()
+		mockRestClient.On("Do", mock.Anything, http.MethodPost, "http://a.com", []byte(`{"count":7}`)).
+			Return(&restclient.Response{StatusCode: http.StatusServiceUnavailable}, statusErr).Once()
+		mockRepo.On("SaveDelivery", mock.Anything, mock.MatchedBy(func(d entity.CallbackDelivery) bool {
+			return d.Status == entity.DeliveryPending && d.Attempts == 1 &&
+				d.LastError == statusErr.Error() && d.LastStatusCode == http.StatusServiceUnavailable
+		})).Return(nil).Once()
+		mockRepo.On("Schedule", mock.Anything, "d1", mock.MatchedBy(func(at time.Time) bool {
+			return at.After(time.Now().Add(20 * time.Second))
+		})).Return(nil).Once()
+
+		assert.NoError(t, callbacks.ProcessDue(context.Background()))
+		assert.NoError(t, pool.Shutdown(context.Background()))
+		mockRepo.AssertExpectations(t)
+		mockRestClient.AssertExpectations(t)
+	})
+
+	t.Run("client error fails the delivery permanently", func(t *testing.T) {
+		mockRepo := new(MockCallbackRepository)
+		mockRestClient := new(MockRestClient)
+		logger := slog.Default()
+		pool := newTestPool(t, logger)
+		callbacks := service.NewImplCallbackService(mockRepo, new(MockWebhookRepository), mockRestClient, logger, pool, nil)
+
+		mockRepo.On("ClaimDue", mock.Anything, mock.Anything, int64(100), mock.Anything).Return([]string{"d1"}, nil).Once()
+		mockRepo.On("GetDelivery", mock.Anything, "d1").Return(pending(), nil).Once()
+		mockRestClient.On("Do", mock.Anything, http.MethodPost, "http://a.com", []byte(`{"count":7}`)).
+			Return(&restclient.Response{StatusCode: http.StatusGone}, &restclient.StatusError{StatusCode: http.StatusGone, Attempts: 1}).Once()
+		mockRepo.On("SaveDelivery", mock.Anything, mock.MatchedBy(func(d entity.CallbackDelivery) bool {
+			return d.Status == entity.DeliveryFailed && d.Attempts == 1
+		})).Return(nil).Once()
+		mockRepo.On("Complete", mock.Anything, "d1").Return(nil).Once()
+
+		assert.NoError(t, callbacks.ProcessDue(context.Background()))
+		assert.NoError(t, pool.Shutdown(context.Background()))
+		mockRepo.AssertExpectations(t)
+		mockRestClient.AssertExpectations(t)
+	})
+
+	t.Run("url policy violation fails the delivery permanently", func(t *testing.T) {
+		mockRepo := new(MockCallbackRepository)
+		mockRestClient := new(MockRestClient)
+		logger := slog.Default()
+		pool := newTestPool(t, logger)
+		callbacks := service.NewImplCallbackService(mockRepo, new(MockWebhookRepository), mockRestClient, logger, pool, nil)
+
+		dialErr := &url.Error{Op: "Post", URL: "http://a.com", Err: urlpolicy.ErrBlockedAddress}
+		mockRepo.On("ClaimDue", mock.Anything, mock.Anything, int64(100), mock.Anything).Return([]string{"d1"}, nil).Once()
+		mockRepo.On("GetDelivery", mock.Anything, "d1").Return(pending(), nil).Once()
+		mockRestClient.On("Do", mock.Anything, http.MethodPost, "http://a.com", []byte(`{"count":7}`)).
+			Return(nil, dialErr).Once()
+		mockRepo.On("SaveDelivery", mock.Anything, mock.MatchedBy(func(d entity.CallbackDelivery) bool {
+			return d.Status == entity.DeliveryFailed && d.Attempts == 1 && d.LastError == dialErr.Error()
+		})).Return(nil).Once()
+		mockRepo.On("Complete", mock.Anything, "d1").Return(nil).Once()
+
+		assert.NoError(t, callbacks.ProcessDue(context.Background()))
+		assert.NoError(t, pool.Shutdown(context.Background()))
+		mockRepo.AssertExpectations(t)
+		mockRestClient.AssertExpectations(t)
+	})
+
+	t.Run("webhook deliveries are signed with the subscription secret", func(t *testing.T) {
+		mockRepo := new(MockCallbackRepository)
+		mockWebhooks := new(MockWebhookRepository)
+		mockRestClient := new(MockRestClient)
+		logger := slog.Default()
+		pool := newTestPool(t, logger)
+		callbacks := service.NewImplCallbackService(mockRepo, mockWebhooks, mockRestClient, logger, pool, nil)
+
+		delivery := pending()
+		delivery.SubscriptionId = "w1"
+		delivery.Event = request.EventUniqueCountRollup
+		mockRepo.On("ClaimDue", mock.Anything, mock.Anything, int64(100), mock.Anything).Return([]string{"d1"}, nil).Once()
+		mockRepo.On("GetDelivery", mock.Anything, "d1").Return(delivery, nil).Once()
+		mockWebhooks.On("Get", mock.Anything, "w1").Return(&entity.WebhookSubscription{Id: "w1", Secret: "0123456789abcdef"}, nil).Once()
+		mockRestClient.On("Do", mock.Anything, http.MethodPost, "http://a.com", []byte(`{"count":7}`)).
+			Return(&restclient.Response{StatusCode: http.StatusOK}, nil).Once()
+		mockRepo.On("SaveDelivery", mock.Anything, mock.Anything).Return(nil).Once()
+		mockRepo.On("Complete", mock.Anything, "d1").Return(nil).Once()
+
+		assert.NoError(t, callbacks.ProcessDue(context.Background()))
+		assert.NoError(t, pool.Shutdown(context.Background()))
+		mockWebhooks.AssertExpectations(t)
+		mockRestClient.AssertExpectations(t)
+	})
+
+	t.Run("deliveries of a deleted subscription fail without sending", func(t *testing.T) {
+		mockRepo := new(MockCallbackRepository)
+		mockWebhooks := new(MockWebhookRepository)
+		mockRestClient := new(MockRestClient)
+		logger := slog.Default()
+		pool := newTestPool(t, logger)
+		callbacks := service.NewImplCallbackService(mockRepo, mockWebhooks, mockRestClient, logger, pool, nil)
+
+		delivery := pending()
+		delivery.SubscriptionId = "w1"
+		mockRepo.On("ClaimDue", mock.Anything, mock.Anything, int64(100), mock.Anything).Return([]string{"d1"}, nil).Once()
+		mockRepo.On("GetDelivery", mock.Anything, "d1").Return(delivery, nil).Once()
+		mockWebhooks.On("Get", mock.Anything, "w1").Return(nil, repository.ErrWebhookNotFound).Once()
+		mockRepo.On("SaveDelivery", mock.Anything, mock.MatchedBy(func(d entity.CallbackDelivery) bool {
+			return d.Status == entity.DeliveryFailed
+		})).Return(nil).Once()
+		mockRepo.On("Complete", mock.Anything, "d1").Return(nil).Once()
+
+		assert.NoError(t, callbacks.ProcessDue(context.Background()))
+		assert.NoError(t, pool.Shutdown(context.Background()))
+		mockRepo.AssertExpectations(t)
+		mockRestClient.AssertNotCalled(t, "Do", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("claim errors are returned", func(t *testing.T) {
+		mockRepo := new(MockCallbackRepository)
+		logger := slog.Default()
+		callbacks := service.NewImplCallbackService(mockRepo, new(MockWebhookRepository), new(MockRestClient), logger, newTestPool(t, logger), nil)
+
+		mockRepo.On("ClaimDue", mock.Anything, mock.Anything, int64(100), mock.Anything).Return([]string{}, errors.New("redis down")).Once()
+
+		assert.Error(t, callbacks.ProcessDue(context.Background()))
+	})
+}
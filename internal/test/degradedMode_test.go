@@ -0,0 +1,188 @@
+package test
+
+import (
+	"Verve/internal/database"
+	"Verve/internal/model/entity"
+	"Verve/internal/model/request"
+	"Verve/internal/service"
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// errRedisDown is what the Redis client returns when the server cannot be reached.
+var errRedisDown = &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+
+func newDegradedService(bucket *service.LocalBucket) (service.VerveService, *MockVerveRepository) {
+	mockRepo := new(MockVerveRepository)
+	mockCallbacks := new(MockCallbackService)
+	mockCallbacks.On("Admit").Return(nil)
+	verveService := service.NewImplVerveService(mockRepo, mockCallbacks, new(MockWebhookService), slog.Default(), new(MockEvent), bucket)
+	return verveService, mockRepo
+}
+
+func TestDegradedModeAccepts(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("buffers ids and urls while redis is unreachable", func(t *testing.T) {
+		bucket := service.NewLocalBucket(10)
+		verveService, mockRepo := newDegradedService(bucket)
+		mockRepo.On("SaveAll", ctx, currentWindow, mock.Anything).Return(errRedisDown)
+
+		err := verveService.SaveAllAndPost(ctx, []request.VerveRequest{
+			{Id: "1", Url: "http://a.com"},
+			{Id: "1", Url: "http://a.com"},
+			{Id: "2", Namespace: "shop"},
+		})
+		assert.NoError(t, err)
+
+		state := bucket.State()
+		assert.True(t, state.Degraded)
+		assert.Equal(t, 2, state.Ids)
+		assert.Equal(t, 1, state.Urls)
+	})
+
+	t.Run("rejects ids once the bucket is full", func(t *testing.T) {
+		bucket := service.NewLocalBucket(1)
+		verveService, mockRepo := newDegradedService(bucket)
+		mockRepo.On("Save", ctx, currentWindow, mock.Anything).Return(errRedisDown)
+
+		assert.NoError(t, verveService.SaveAndPost(ctx, request.VerveRequest{Id: "1"}))
+		err := verveService.SaveAndPost(ctx, request.VerveRequest{Id: "2"})
+		assert.ErrorIs(t, err, service.ErrBucketFull)
+		assert.True(t, database.IsUnavailable(err))
+	})
+
+	t.Run("returns the error when degraded mode is disabled", func(t *testing.T) {
+		verveService, mockRepo := newDegradedService(nil)
+		mockRepo.On("Save", ctx, currentWindow, mock.Anything).Return(errRedisDown)
+
+		assert.ErrorIs(t, verveService.SaveAndPost(ctx, request.VerveRequest{Id: "1"}), errRedisDown)
+	})
+
+	t.Run("does not buffer rejected commands", func(t *testing.T) {
+		bucket := service.NewLocalBucket(10)
+		verveService, mockRepo := newDegradedService(bucket)
+		mockRepo.On("Save", ctx, currentWindow, mock.Anything).Return(errors.New("WRONGTYPE"))
+
+		assert.Error(t, verveService.SaveAndPost(ctx, request.VerveRequest{Id: "1"}))
+		assert.False(t, bucket.State().Degraded)
+	})
+}
+
+func TestReconcile(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("moves the bucket into the current window and flags it approximate", func(t *testing.T) {
+		bucket := service.NewLocalBucket(10)
+		assert.NoError(t, bucket.Add(service.WindowStart(time.Now()), []entity.VerveEntity{{Id: "1"}}, []string{"http://a.com"}))
+		verveService, mockRepo := newDegradedService(bucket)
+		mockRepo.On("MarkApproximate", ctx, currentWindow).Return(nil).Once()
+		mockRepo.On("SaveAll", ctx, currentWindow, []entity.VerveEntity{{Id: "1"}}).Return(nil).Once()
+		mockRepo.On("RegisterCallbacks", ctx, currentWindow, []string{"http://a.com"}).Return(nil).Once()
+
+		assert.NoError(t, verveService.Reconcile(ctx))
+		assert.False(t, bucket.State().Degraded)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("keeps the bucket while redis is unreachable", func(t *testing.T) {
+		bucket := service.NewLocalBucket(10)
+		assert.NoError(t, bucket.Add(service.WindowStart(time.Now()), []entity.VerveEntity{{Id: "1"}}, nil))
+		since := bucket.State().Since
+		verveService, mockRepo := newDegradedService(bucket)
+		mockRepo.On("MarkApproximate", ctx, currentWindow).Return(errRedisDown).Once()
+
+		assert.Error(t, verveService.Reconcile(ctx))
+		state := bucket.State()
+		assert.True(t, state.Degraded)
+		assert.Equal(t, 1, state.Ids)
+		assert.Equal(t, since, state.Since)
+	})
+
+	t.Run("is a no-op outside degraded mode", func(t *testing.T) {
+		verveService, mockRepo := newDegradedService(service.NewLocalBucket(10))
+
+		assert.NoError(t, verveService.Reconcile(ctx))
+		mockRepo.AssertNotCalled(t, "MarkApproximate", mock.Anything, mock.Anything)
+	})
+}
+
+func TestReconcileAcrossWindows(t *testing.T) {
+	ctx := context.Background()
+	closed := service.WindowStart(time.Now()).Add(-2 * time.Minute)
+
+	// The outage started in the middle of the closed window: the ids 1 and 3 reached
+	// Redis before it, the id 1 and the id 2 of the shop namespace were buffered
+	// during it.
+	closedEntities := []entity.VerveEntity{{Id: "1"}, {Id: "2", Namespace: "shop"}}
+	bucket := service.NewLocalBucket(10)
+	assert.NoError(t, bucket.Add(closed, closedEntities, []string{"http://a.com"}))
+	assert.NoError(t, bucket.Add(service.WindowStart(time.Now()), []entity.VerveEntity{{Id: "1"}}, []string{"http://b.com"}))
+	assert.Equal(t, 3, bucket.State().Ids, "an id is counted once per window")
+
+	mockRepo := new(MockVerveRepository)
+	mockCallbacks := new(MockCallbackService)
+	mockWebhooks := new(MockWebhookService)
+	mockEvent := new(MockEvent)
+	verveService := service.NewImplVerveService(mockRepo, mockCallbacks, mockWebhooks, slog.Default(), mockEvent, bucket)
+
+	// The buffered ids join the sets of the closed window, which is flushed with
+	// the ids it got before and during the outage.
+	closedCounts := map[string]int64{"": 2, "shop": 1}
+	mockRepo.On("MarkApproximate", ctx, closed).Return(nil).Once()
+	mockRepo.On("SaveAll", ctx, closed, mock.MatchedBy(func(es []entity.VerveEntity) bool {
+		// The bucket keeps the ids of a window in a set, in no particular order.
+		return assert.ElementsMatch(new(testing.T), closedEntities, es)
+	})).Return(nil).Once()
+	mockRepo.On("RegisterCallbacks", ctx, closed, []string{"http://a.com"}).Return(nil).Once()
+	mockRepo.On("GetUniqueCounts", ctx, closed).Return(closedCounts, nil).Once()
+	mockRepo.On("FinalizeCounts", ctx, closed, closedCounts).Return(closedCounts, true, nil).Once()
+	mockRepo.On("IsApproximate", ctx, closed).Return(true, nil).Once()
+	mockEvent.On("Publish", mock.Anything, "unique_count", "3").Return(nil).Once()
+	mockWebhooks.On("Namespaces", ctx).Return([]string{"", "shop"}, nil).Once()
+	mockWebhooks.On("Fanout", ctx, request.EventUniqueCountRollup, mock.Anything, mock.Anything).Return(nil).Twice()
+	mockRepo.On("PopCallbacks", ctx, closed, int64(100)).Return([]string{"http://a.com"}, nil).Once()
+	mockRepo.On("PopCallbacks", ctx, closed, int64(100)).Return([]string{}, nil).Once()
+	mockRepo.On("CallbackOrigins", ctx, closed, []string{"http://a.com"}).Return(map[string]entity.CallbackOrigin{}, nil)
+	mockCallbacks.On("Enqueue", ctx, "http://a.com", mock.MatchedBy(func(p entity.CallbackPayload) bool {
+		return p.Count == 3 && p.Approximate && p.WindowStart.Equal(closed)
+	})).Return("d1", nil).Once()
+	// The ids of the current window join its sets.
+	mockRepo.On("MarkApproximate", ctx, currentWindow).Return(nil).Once()
+	mockRepo.On("SaveAll", ctx, currentWindow, []entity.VerveEntity{{Id: "1"}}).Return(nil).Once()
+	mockRepo.On("RegisterCallbacks", ctx, currentWindow, []string{"http://b.com"}).Return(nil).Once()
+
+	assert.NoError(t, verveService.Reconcile(ctx))
+	assert.False(t, bucket.State().Degraded)
+	mockRepo.AssertExpectations(t)
+	mockEvent.AssertExpectations(t)
+	mockCallbacks.AssertExpectations(t)
+}
+
+func TestFlushWindowApproximate(t *testing.T) {
+	window := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+	mockRepo := new(MockVerveRepository)
+	mockCallbacks := new(MockCallbackService)
+	verveService := service.NewImplVerveService(mockRepo, mockCallbacks, new(MockWebhookService), slog.Default(), new(MockEvent), nil)
+
+	mockRepo.On("GetUniqueCounts", ctx, window).Return(map[string]int64{}, nil)
+	mockRepo.On("FinalizeCounts", ctx, window, map[string]int64{}).Return(map[string]int64{"": 7}, false, nil)
+	mockRepo.On("IsApproximate", ctx, window).Return(true, nil)
+	mockRepo.On("PopCallbacks", ctx, window, int64(100)).Return([]string{"http://a.com"}, nil).Once()
+	mockRepo.On("PopCallbacks", ctx, window, int64(100)).Return([]string{}, nil).Once()
+	mockRepo.On("CallbackOrigins", ctx, window, []string{"http://a.com"}).Return(map[string]entity.CallbackOrigin{}, nil)
+	mockCallbacks.On("Enqueue", ctx, "http://a.com", mock.MatchedBy(func(p entity.CallbackPayload) bool {
+		return p.Count == 7 && p.Approximate
+	})).Return("d1", nil).Once()
+
+	assert.NoError(t, verveService.FlushWindow(ctx, window))
+	mockCallbacks.AssertExpectations(t)
+}
@@ -0,0 +1,483 @@
+package test
+
+import (
+	"Verve/internal/auth"
+	e "Verve/internal/configs/errorResponse"
+	urlpolicy "Verve/internal/configs/urlPolicy"
+	"Verve/internal/controller"
+	"Verve/internal/model/entity"
+	"Verve/internal/model/request"
+	"Verve/internal/model/response"
+	"Verve/internal/ratelimit"
+	"Verve/internal/repository"
+	"Verve/internal/service"
+	"Verve/internal/worker"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// Mock VerveService
+type MockVerveService struct {
+	mock.Mock
+}
+
+func (m *MockVerveService) SaveAndPost(ctx context.Context, verveRequest request.VerveRequest) error {
+	args := m.Called(ctx, verveRequest)
+	return args.Error(0)
+}
+
+func (m *MockVerveService) SaveAllAndPost(ctx context.Context, verveRequests []request.VerveRequest) error {
+	args := m.Called(ctx, verveRequests)
+	return args.Error(0)
+}
+
+func (m *MockVerveService) LogUniqueCountEveryMinute(ctx context.Context) {
+	m.Called(ctx)
+}
+
+func (m *MockVerveService) SendUniqueCountEveryMinute(ctx context.Context) {
+	m.Called(ctx)
+}
+
+func (m *MockVerveService) FlushWindow(ctx context.Context, window time.Time) error {
+	args := m.Called(ctx, window)
+	return args.Error(0)
+}
+
+func (m *MockVerveService) Reconcile(ctx context.Context) error {
+	args := m.Called(ctx)
+	return args.Error(0)
+}
+
+func (m *MockVerveService) RunReconcileLoop(ctx context.Context) {
+	m.Called(ctx)
+}
+
+// newTestController builds the controller with the int64 id format and the
+// built-in callback url policy.
+func newTestController(verveService service.VerveService, callbackService service.CallbackService, webhookService service.WebhookService, idPolicy *ratelimit.Policy) *controller.VerveController {
+	ids, _ := request.NewIdValidator(request.IdFormatInt64, 0)
+	return controller.NewVerveController(verveService, callbackService, webhookService, idPolicy, ids, urlpolicy.New(nil, nil, nil, nil, false))
+}
+
+func TestGetApi(t *testing.T) {
+	t.Run("answers plaintext ok", func(t *testing.T) {
+		mockVerve := new(MockVerveService)
+		c := newTestController(mockVerve, new(MockCallbackService), new(MockWebhookService), nil)
+
+		mockVerve.On("SaveAndPost", mock.Anything, request.VerveRequest{Id: "1"}).Return(nil).Once()
+
+		w := httptest.NewRecorder()
+		c.GetApi(w, httptest.NewRequest(http.MethodGet, "/api/verve/accept?id=1", nil))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "ok", w.Body.String())
+		mockVerve.AssertExpectations(t)
+	})
+
+	t.Run("keeps the plaintext failed body with the code in a header", func(t *testing.T) {
+		c := newTestController(new(MockVerveService), new(MockCallbackService), new(MockWebhookService), nil)
+
+		w := httptest.NewRecorder()
+		c.GetApi(w, httptest.NewRequest(http.MethodGet, "/api/verve/accept?id=abc", nil))
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, "failed", w.Body.String())
+		assert.Equal(t, "id.not_integer", w.Header().Get(e.ErrorCodeHeader))
+	})
+
+	t.Run("answers problem details when json is accepted", func(t *testing.T) {
+		mockVerve := new(MockVerveService)
+		c := newTestController(mockVerve, new(MockCallbackService), new(MockWebhookService), nil)
+
+		mockVerve.On("SaveAndPost", mock.Anything, mock.Anything).Return(errors.New("boom")).Once()
+
+		r := httptest.NewRequest(http.MethodGet, "/api/verve/accept?id=1", nil)
+		r.Header.Set("Accept", "application/json")
+		w := httptest.NewRecorder()
+		c.GetApi(w, r)
+
+		var problem e.Problem
+		assert.NoError(t, json.NewDecoder(w.Body).Decode(&problem))
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.Equal(t, e.ProblemContentType, w.Header().Get("Content-Type"))
+		assert.Equal(t, e.CodeInternal, problem.Code)
+		assert.Equal(t, "failed to save id", problem.Detail)
+	})
+
+	t.Run("answers 503 failed while the callback queue is full", func(t *testing.T) {
+		mockVerve := new(MockVerveService)
+		c := newTestController(mockVerve, new(MockCallbackService), new(MockWebhookService), nil)
+
+		mockVerve.On("SaveAndPost", mock.Anything, mock.Anything).Return(fmt.Errorf("callbacks not accepted: %w", worker.ErrQueueFull)).Once()
+
+		w := httptest.NewRecorder()
+		c.GetApi(w, httptest.NewRequest(http.MethodGet, "/api/verve/accept?id=1", nil))
+
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Equal(t, "failed", w.Body.String())
+		assert.Equal(t, e.CodeQueueFull, w.Header().Get(e.ErrorCodeHeader))
+	})
+}
+
+func TestGetWebhookNotFound(t *testing.T) {
+	mockWebhooks := new(MockWebhookService)
+	c := newTestController(new(MockVerveService), new(MockCallbackService), mockWebhooks, nil)
+
+	mockWebhooks.On("Get", mock.Anything, "w1").Return(nil, repository.ErrWebhookNotFound).Once()
+
+	router := chi.NewRouter()
+	router.Get("/api/verve/webhooks/{id}", c.GetWebhook)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/verve/webhooks/w1", nil))
+
+	var problem e.Problem
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&problem))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, e.CodeNotFound, problem.Code)
+}
+
+func TestListCallbacks(t *testing.T) {
+	t.Run("finds the deliveries of a url for the window", func(t *testing.T) {
+		mockCallbacks := new(MockCallbackService)
+		c := newTestController(new(MockVerveService), mockCallbacks, new(MockWebhookService), nil)
+
+		window := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+		mockCallbacks.On("FindDeliveries", mock.Anything, "http://a.com/hook", window).
+			Return([]entity.CallbackDelivery{{Id: "d1", Url: "http://a.com/hook", WindowStart: window}}, nil).Once()
+
+		w := httptest.NewRecorder()
+		c.ListCallbacks(w, httptest.NewRequest(http.MethodGet, "/api/verve/callbacks?url=http://a.com/hook&window=2024-01-01T10:00:42Z", nil))
+
+		var deliveries []entity.CallbackDelivery
+		assert.NoError(t, json.NewDecoder(w.Body).Decode(&deliveries))
+		assert.Equal(t, http.StatusOK, w.Code)
+		if assert.Len(t, deliveries, 1) {
+			assert.Equal(t, "d1", deliveries[0].Id)
+		}
+		mockCallbacks.AssertExpectations(t)
+	})
+
+	t.Run("rejects a window that is not a time", func(t *testing.T) {
+		c := newTestController(new(MockVerveService), new(MockCallbackService), new(MockWebhookService), nil)
+
+		w := httptest.NewRecorder()
+		c.ListCallbacks(w, httptest.NewRequest(http.MethodGet, "/api/verve/callbacks?url=http://a.com/hook&window=10:00", nil))
+
+		var problem e.Problem
+		assert.NoError(t, json.NewDecoder(w.Body).Decode(&problem))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		if assert.Len(t, problem.Details, 1) {
+			assert.Equal(t, "window.invalid_format", problem.Details[0].Code)
+		}
+	})
+}
+
+func TestCreateWebhookReturnsSecret(t *testing.T) {
+	mockWebhooks := new(MockWebhookService)
+	c := newTestController(new(MockVerveService), new(MockCallbackService), mockWebhooks, nil)
+
+	created := &entity.WebhookSubscription{Id: "w1", Namespace: "shop", Secret: "generated-secret-value"}
+	mockWebhooks.On("Create", mock.Anything, mock.MatchedBy(func(w request.WebhookRequest) bool {
+		return w.Namespace == "shop" && w.Url == "http://93.184.216.34/hook"
+	})).Return(created, nil).Once()
+
+	body := `{"url":"http://93.184.216.34/hook","namespace":"shop"}`
+	w := httptest.NewRecorder()
+	c.CreateWebhook(w, httptest.NewRequest(http.MethodPost, "/api/verve/webhooks", strings.NewReader(body)))
+
+	var subscription entity.WebhookSubscription
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&subscription))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "generated-secret-value", subscription.Secret)
+	mockWebhooks.AssertExpectations(t)
+}
+
+func TestAcceptRateLimitPerId(t *testing.T) {
+	newController := func() (*controller.VerveController, *MockVerveService) {
+		mockVerve := new(MockVerveService)
+		policy := &ratelimit.Policy{Name: "id", Limit: ratelimit.Limit{Rate: 0.1, Burst: 1}, Limiter: ratelimit.NewLocalLimiter(), Logger: slog.Default()}
+		return newTestController(mockVerve, new(MockCallbackService), new(MockWebhookService), policy), mockVerve
+	}
+
+	t.Run("limits an id on the legacy route", func(t *testing.T) {
+		c, mockVerve := newController()
+		mockVerve.On("SaveAndPost", mock.Anything, mock.Anything).Return(nil).Once()
+
+		w := httptest.NewRecorder()
+		c.GetApi(w, httptest.NewRequest(http.MethodGet, "/api/verve/accept?id=1", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		w = httptest.NewRecorder()
+		c.GetApi(w, httptest.NewRequest(http.MethodGet, "/api/verve/accept?id=1", nil))
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Equal(t, "failed", w.Body.String())
+		assert.Equal(t, e.CodeRateLimited, w.Header().Get(e.ErrorCodeHeader))
+		assert.Equal(t, "10", w.Header().Get(ratelimit.RetryHeader))
+		mockVerve.AssertExpectations(t)
+	})
+
+	t.Run("reports limited items of a batch", func(t *testing.T) {
+		c, mockVerve := newController()
+		mockVerve.On("SaveAllAndPost", mock.Anything, []request.VerveRequest{{Id: "1"}, {Id: "2"}}).Return(nil).Once()
+
+		body := `[{"id":"1"},{"id":"2"},{"id":"1"}]`
+		w := httptest.NewRecorder()
+		c.PostApi(w, httptest.NewRequest(http.MethodPost, "/api/verve/accept", strings.NewReader(body)))
+
+		var accepted response.AcceptResponse
+		assert.NoError(t, json.NewDecoder(w.Body).Decode(&accepted))
+		assert.Equal(t, http.StatusMultiStatus, w.Code)
+		assert.Equal(t, e.CodeRateLimited, accepted.Results[2].Code)
+		mockVerve.AssertExpectations(t)
+	})
+
+	t.Run("decides a batch with one limiter call", func(t *testing.T) {
+		mockVerve := new(MockVerveService)
+		limiter := &countingLimiter{Limiter: ratelimit.NewLocalLimiter()}
+		policy := &ratelimit.Policy{Name: "id", Limit: ratelimit.Limit{Rate: 0.1, Burst: 1}, Limiter: limiter, Logger: slog.Default()}
+		c := newTestController(mockVerve, new(MockCallbackService), new(MockWebhookService), policy)
+		mockVerve.On("SaveAllAndPost", mock.Anything, mock.Anything).Return(nil).Once()
+
+		body := `[{"id":"1"},{"id":"x"},{"id":"2"},{"id":"3"}]`
+		w := httptest.NewRecorder()
+		c.PostApi(w, httptest.NewRequest(http.MethodPost, "/api/verve/accept", strings.NewReader(body)))
+
+		assert.Equal(t, http.StatusMultiStatus, w.Code)
+		assert.Equal(t, 1, limiter.calls)
+		assert.Equal(t, []string{"id::1", "id::2", "id::3"}, limiter.keys)
+		mockVerve.AssertExpectations(t)
+	})
+}
+
+// countingLimiter records the batch calls made to the limiter it wraps.
+type countingLimiter struct {
+	ratelimit.Limiter
+	calls int
+	keys  []string
+}
+
+func (l *countingLimiter) AllowN(ctx context.Context, keys []string, limit ratelimit.Limit) ([]ratelimit.Result, error) {
+	l.calls++
+	l.keys = append(l.keys, keys...)
+	return l.Limiter.AllowN(ctx, keys, limit)
+}
+
+func TestAcceptKeyNamespace(t *testing.T) {
+	withKey := func(r *http.Request) *http.Request {
+		return r.WithContext(auth.WithPrincipal(r.Context(), &entity.APIKey{Id: "k1", Namespace: "shop", Scopes: []string{request.ScopeAccept}}))
+	}
+
+	t.Run("defaults to the namespace of the key", func(t *testing.T) {
+		mockVerve := new(MockVerveService)
+		c := newTestController(mockVerve, new(MockCallbackService), new(MockWebhookService), nil)
+		mockVerve.On("SaveAndPost", mock.Anything, request.VerveRequest{Id: "1", Namespace: "shop"}).Return(nil).Once()
+
+		w := httptest.NewRecorder()
+		c.GetApi(w, withKey(httptest.NewRequest(http.MethodGet, "/api/verve/accept?id=1", nil)))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		mockVerve.AssertExpectations(t)
+	})
+
+	t.Run("rejects a webhook of another namespace", func(t *testing.T) {
+		c := newTestController(new(MockVerveService), new(MockCallbackService), new(MockWebhookService), nil)
+
+		body := `{"url":"http://93.184.216.34/hook","namespace":"blog"}`
+		w := httptest.NewRecorder()
+		c.CreateWebhook(w, withKey(httptest.NewRequest(http.MethodPost, "/api/verve/webhooks", strings.NewReader(body))))
+
+		var problem e.Problem
+		assert.NoError(t, json.NewDecoder(w.Body).Decode(&problem))
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Equal(t, e.CodeForbidden, problem.Code)
+	})
+
+	t.Run("reports forbidden items of a batch", func(t *testing.T) {
+		mockVerve := new(MockVerveService)
+		c := newTestController(mockVerve, new(MockCallbackService), new(MockWebhookService), nil)
+		mockVerve.On("SaveAllAndPost", mock.Anything, []request.VerveRequest{{Id: "1", Namespace: "shop"}}).Return(nil).Once()
+
+		body := `[{"id":"1"},{"id":"2","namespace":"blog"}]`
+		w := httptest.NewRecorder()
+		c.PostApi(w, withKey(httptest.NewRequest(http.MethodPost, "/api/verve/accept", strings.NewReader(body))))
+
+		var accepted response.AcceptResponse
+		assert.NoError(t, json.NewDecoder(w.Body).Decode(&accepted))
+		assert.Equal(t, http.StatusMultiStatus, w.Code)
+		assert.Equal(t, e.CodeForbidden, accepted.Results[1].Code)
+		mockVerve.AssertExpectations(t)
+	})
+}
+
+func TestNamespacedKeysOnlySeeTheirNamespace(t *testing.T) {
+	withKey := func(r *http.Request, namespace string) *http.Request {
+		apiKey := &entity.APIKey{Id: "k-" + namespace, Namespace: namespace, Scopes: []string{request.ScopeWebhooks, request.ScopeCallbacks}}
+		return r.WithContext(auth.WithPrincipal(r.Context(), apiKey))
+	}
+	newRouter := func(mockCallbacks *MockCallbackService, mockWebhooks *MockWebhookService) http.Handler {
+		c := newTestController(new(MockVerveService), mockCallbacks, mockWebhooks, nil)
+		router := chi.NewRouter()
+		router.Get("/api/verve/webhooks", c.ListWebhooks)
+		router.Get("/api/verve/webhooks/{id}", c.GetWebhook)
+		router.Delete("/api/verve/webhooks/{id}", c.DeleteWebhook)
+		router.Get("/api/verve/callbacks", c.ListCallbacks)
+		router.Get("/api/verve/callbacks/{id}", c.GetCallback)
+		return router
+	}
+	shopWebhook := &entity.WebhookSubscription{Id: "w1", Namespace: "shop"}
+	shopDelivery := &entity.CallbackDelivery{Id: "d1", Namespace: "shop"}
+
+	t.Run("lists the webhooks of the key namespace", func(t *testing.T) {
+		mockWebhooks := new(MockWebhookService)
+		mockWebhooks.On("List", mock.Anything, "blog").Return([]entity.WebhookSubscription{}, nil).Once()
+
+		w := httptest.NewRecorder()
+		newRouter(new(MockCallbackService), mockWebhooks).ServeHTTP(w, withKey(httptest.NewRequest(http.MethodGet, "/api/verve/webhooks", nil), "blog"))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		mockWebhooks.AssertExpectations(t)
+	})
+
+	t.Run("refuses to list the webhooks of another namespace", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		newRouter(new(MockCallbackService), new(MockWebhookService)).ServeHTTP(w, withKey(httptest.NewRequest(http.MethodGet, "/api/verve/webhooks?namespace=shop", nil), "blog"))
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("reads its own webhook", func(t *testing.T) {
+		mockWebhooks := new(MockWebhookService)
+		mockWebhooks.On("Get", mock.Anything, "w1").Return(shopWebhook, nil).Once()
+
+		w := httptest.NewRecorder()
+		newRouter(new(MockCallbackService), mockWebhooks).ServeHTTP(w, withKey(httptest.NewRequest(http.MethodGet, "/api/verve/webhooks/w1", nil), "shop"))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("does not find the webhook of another namespace", func(t *testing.T) {
+		mockWebhooks := new(MockWebhookService)
+		mockWebhooks.On("Get", mock.Anything, "w1").Return(shopWebhook, nil).Once()
+
+		w := httptest.NewRecorder()
+		newRouter(new(MockCallbackService), mockWebhooks).ServeHTTP(w, withKey(httptest.NewRequest(http.MethodGet, "/api/verve/webhooks/w1", nil), "blog"))
+
+		var problem e.Problem
+		assert.NoError(t, json.NewDecoder(w.Body).Decode(&problem))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, e.CodeNotFound, problem.Code)
+	})
+
+	t.Run("does not delete the webhook of another namespace", func(t *testing.T) {
+		mockWebhooks := new(MockWebhookService)
+		mockWebhooks.On("Get", mock.Anything, "w1").Return(shopWebhook, nil).Once()
+
+		w := httptest.NewRecorder()
+		newRouter(new(MockCallbackService), mockWebhooks).ServeHTTP(w, withKey(httptest.NewRequest(http.MethodDelete, "/api/verve/webhooks/w1", nil), "blog"))
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		mockWebhooks.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything)
+	})
+
+	t.Run("deletes its own webhook", func(t *testing.T) {
+		mockWebhooks := new(MockWebhookService)
+		mockWebhooks.On("Get", mock.Anything, "w1").Return(shopWebhook, nil).Once()
+		mockWebhooks.On("Delete", mock.Anything, "w1").Return(nil).Once()
+
+		w := httptest.NewRecorder()
+		newRouter(new(MockCallbackService), mockWebhooks).ServeHTTP(w, withKey(httptest.NewRequest(http.MethodDelete, "/api/verve/webhooks/w1", nil), "shop"))
+
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		mockWebhooks.AssertExpectations(t)
+	})
+
+	t.Run("does not find the callback of another namespace", func(t *testing.T) {
+		mockCallbacks := new(MockCallbackService)
+		mockCallbacks.On("GetDelivery", mock.Anything, "d1").Return(shopDelivery, nil).Twice()
+		router := newRouter(mockCallbacks, new(MockWebhookService))
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, withKey(httptest.NewRequest(http.MethodGet, "/api/verve/callbacks/d1", nil), "blog"))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, withKey(httptest.NewRequest(http.MethodGet, "/api/verve/callbacks/d1", nil), "shop"))
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("lists the callbacks of its namespace only", func(t *testing.T) {
+		mockCallbacks := new(MockCallbackService)
+		mockCallbacks.On("FindDeliveries", mock.Anything, "http://a.com", mock.AnythingOfType("time.Time")).
+			Return([]entity.CallbackDelivery{*shopDelivery, {Id: "d2", Namespace: "blog"}}, nil).Once()
+
+		w := httptest.NewRecorder()
+		target := "/api/verve/callbacks?url=http://a.com&window=2024-01-01T10:00:00Z"
+		newRouter(mockCallbacks, new(MockWebhookService)).ServeHTTP(w, withKey(httptest.NewRequest(http.MethodGet, target, nil), "blog"))
+
+		var deliveries []entity.CallbackDelivery
+		assert.NoError(t, json.NewDecoder(w.Body).Decode(&deliveries))
+		if assert.Len(t, deliveries, 1) {
+			assert.Equal(t, "d2", deliveries[0].Id)
+		}
+	})
+}
+
+func TestCallbackTemplatesBelongToTheKeyNamespace(t *testing.T) {
+	withKey := func(r *http.Request, namespace string) *http.Request {
+		apiKey := &entity.APIKey{Id: "k-" + namespace, Namespace: namespace, Scopes: []string{request.ScopeCallbacks}}
+		return r.WithContext(auth.WithPrincipal(r.Context(), apiKey))
+	}
+	const target = "http://93.184.216.34/hook"
+
+	t.Run("saves the template in the namespace of the key", func(t *testing.T) {
+		mockCallbacks := new(MockCallbackService)
+		c := newTestController(new(MockVerveService), mockCallbacks, new(MockWebhookService), nil)
+		mockCallbacks.On("SaveTemplate", mock.Anything, mock.MatchedBy(func(template entity.CallbackTemplate) bool {
+			return template.Url == target && template.Namespace == "blog"
+		})).Return(nil).Once()
+
+		w := httptest.NewRecorder()
+		c.PutCallbackTemplate(w, withKey(httptest.NewRequest(http.MethodPut, "/api/verve/callbacks/templates", strings.NewReader(`{"url":"`+target+`"}`)), "blog"))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		mockCallbacks.AssertExpectations(t)
+	})
+
+	t.Run("refuses the template of another namespace", func(t *testing.T) {
+		c := newTestController(new(MockVerveService), new(MockCallbackService), new(MockWebhookService), nil)
+
+		w := httptest.NewRecorder()
+		c.PutCallbackTemplate(w, withKey(httptest.NewRequest(http.MethodPut, "/api/verve/callbacks/templates?namespace=shop", strings.NewReader(`{"url":"`+target+`"}`)), "blog"))
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("reads and deletes the template of its own namespace", func(t *testing.T) {
+		mockCallbacks := new(MockCallbackService)
+		c := newTestController(new(MockVerveService), mockCallbacks, new(MockWebhookService), nil)
+		mockCallbacks.On("GetTemplate", mock.Anything, "blog", target).Return(nil, repository.ErrTemplateNotFound).Once()
+		mockCallbacks.On("DeleteTemplate", mock.Anything, "blog", target).Return(nil).Once()
+
+		w := httptest.NewRecorder()
+		c.GetCallbackTemplate(w, withKey(httptest.NewRequest(http.MethodGet, "/api/verve/callbacks/templates?url="+target, nil), "blog"))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		w = httptest.NewRecorder()
+		c.DeleteCallbackTemplate(w, withKey(httptest.NewRequest(http.MethodDelete, "/api/verve/callbacks/templates?url="+target, nil), "blog"))
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		mockCallbacks.AssertExpectations(t)
+	})
+}
@@ -1,10 +1,14 @@
 package test
 
 import (
+	restclient "Verve/internal/configs/restClient"
 	"Verve/internal/model/entity"
 	"Verve/internal/model/request"
+	"Verve/internal/requestid"
 	"Verve/internal/service"
+	"Verve/internal/worker"
 	"context"
+	"errors"
 	"log/slog"
 	"net/http"
 	"testing"
@@ -14,21 +18,85 @@ import (
 	"github.com/stretchr/testify/mock"
 )
 
+// currentWindow matches the window the test runs in, or the one before when a
+// minute boundary passed since.
+var currentWindow = mock.MatchedBy(func(window time.Time) bool {
+	return window.Equal(service.WindowStart(time.Now())) || window.Equal(service.WindowStart(time.Now()).Add(-time.Minute))
+})
+
 // Mock Repository
 type MockVerveRepository struct {
 	mock.Mock
 }
 
-func (m *MockVerveRepository) Save(ctx context.Context, entity entity.VerveEntity) error {
-	args := m.Called(ctx, entity)
+func (m *MockVerveRepository) Save(ctx context.Context, window time.Time, entity entity.VerveEntity) error {
+	args := m.Called(ctx, window, entity)
 	return args.Error(0)
 }
 
-func (m *MockVerveRepository) GetUniqueCount(ctx context.Context) (int64, error) {
-	args := m.Called(ctx)
+func (m *MockVerveRepository) SaveAll(ctx context.Context, window time.Time, entities []entity.VerveEntity) error {
+	args := m.Called(ctx, window, entities)
+	return args.Error(0)
+}
+
+func (m *MockVerveRepository) GetUniqueCount(ctx context.Context, window time.Time) (int64, error) {
+	args := m.Called(ctx, window)
 	return int64(args.Int(0)), args.Error(1)
 }
 
+func (m *MockVerveRepository) RegisterCallbacks(ctx context.Context, window time.Time, urls ...string) error {
+	args := m.Called(ctx, window, urls)
+	return args.Error(0)
+}
+
+func (m *MockVerveRepository) PopCallbacks(ctx context.Context, window time.Time, count int64) ([]string, error) {
+	args := m.Called(ctx, window, count)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockVerveRepository) GetUniqueCounts(ctx context.Context, window time.Time) (map[string]int64, error) {
+	args := m.Called(ctx, window)
+	counts, _ := args.Get(0).(map[string]int64)
+	return counts, args.Error(1)
+}
+
+func (m *MockVerveRepository) FinalizeCounts(ctx context.Context, window time.Time, counts map[string]int64) (map[string]int64, bool, error) {
+	args := m.Called(ctx, window, counts)
+	finalCounts, _ := args.Get(0).(map[string]int64)
+	return finalCounts, args.Bool(1), args.Error(2)
+}
+
+func (m *MockVerveRepository) MarkApproximate(ctx context.Context, window time.Time) error {
+	args := m.Called(ctx, window)
+	return args.Error(0)
+}
+
+func (m *MockVerveRepository) IsApproximate(ctx context.Context, window time.Time) (bool, error) {
+	args := m.Called(ctx, window)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockVerveRepository) CountCallbacks(ctx context.Context, window time.Time) (int64, error) {
+	args := m.Called(ctx, window)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockVerveRepository) SaveCallbackOrigins(ctx context.Context, window time.Time, origins map[string]entity.CallbackOrigin) error {
+	args := m.Called(ctx, window, origins)
+	return args.Error(0)
+}
+
+func (m *MockVerveRepository) CallbackOrigins(ctx context.Context, window time.Time, urls []string) (map[string]entity.CallbackOrigin, error) {
+	args := m.Called(ctx, window, urls)
+	origins, _ := args.Get(0).(map[string]entity.CallbackOrigin)
+	return origins, args.Error(1)
+}
+
+func (m *MockVerveRepository) DeleteNamespace(ctx context.Context, window time.Time, namespace string) error {
+	args := m.Called(ctx, window, namespace)
+	return args.Error(0)
+}
+
 // Mock RestClient
 type MockRestClient struct {
 	mock.Mock
@@ -39,6 +107,17 @@ func (m *MockRestClient) Post(path string, body interface{}) (*http.Response, er
 	return &http.Response{StatusCode: http.StatusOK}, args.Error(1)
 }
 
+func (m *MockRestClient) Do(ctx context.Context, method, path string, body interface{}, opts ...restclient.RequestOption) (*restclient.Response, error) {
+	args := m.Called(ctx, method, path, body)
+	resp, _ := args.Get(0).(*restclient.Response)
+	return resp, args.Error(1)
+}
+
+func (m *MockRestClient) PostWithRetry(path string, body interface{}, policy restclient.RetryPolicy) (*http.Response, error) {
+	args := m.Called(path, body, policy)
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, args.Error(1)
+}
+
 func (m *MockRestClient) Get(path string) (*http.Response, error) {
 	args := m.Called(path)
 	return &http.Response{StatusCode: http.StatusOK}, args.Error(1)
@@ -54,6 +133,63 @@ func (m *MockRestClient) Delete(path string) (*http.Response, error) {
 	return &http.Response{StatusCode: http.StatusOK}, args.Error(1)
 }
 
+// Mock CallbackService
+type MockCallbackService struct {
+	mock.Mock
+}
+
+func (m *MockCallbackService) Enqueue(ctx context.Context, url string, payload entity.CallbackPayload) (string, error) {
+	args := m.Called(ctx, url, payload)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockCallbackService) EnqueueWebhook(ctx context.Context, subscription entity.WebhookSubscription, event string, payload entity.CallbackPayload) (string, error) {
+	args := m.Called(ctx, subscription, event, payload)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockCallbackService) Admit() error {
+	args := m.Called()
+	return args.Error(0)
+}
+
+func (m *MockCallbackService) GetDelivery(ctx context.Context, id string) (*entity.CallbackDelivery, error) {
+	args := m.Called(ctx, id)
+	delivery, _ := args.Get(0).(*entity.CallbackDelivery)
+	return delivery, args.Error(1)
+}
+
+func (m *MockCallbackService) FindDeliveries(ctx context.Context, url string, window time.Time) ([]entity.CallbackDelivery, error) {
+	args := m.Called(ctx, url, window)
+	deliveries, _ := args.Get(0).([]entity.CallbackDelivery)
+	return deliveries, args.Error(1)
+}
+
+func (m *MockCallbackService) SaveTemplate(ctx context.Context, template entity.CallbackTemplate) error {
+	args := m.Called(ctx, template)
+	return args.Error(0)
+}
+
+func (m *MockCallbackService) GetTemplate(ctx context.Context, namespace, url string) (*entity.CallbackTemplate, error) {
+	args := m.Called(ctx, namespace, url)
+	template, _ := args.Get(0).(*entity.CallbackTemplate)
+	return template, args.Error(1)
+}
+
+func (m *MockCallbackService) DeleteTemplate(ctx context.Context, namespace, url string) error {
+	args := m.Called(ctx, namespace, url)
+	return args.Error(0)
+}
+
+func (m *MockCallbackService) ProcessDue(ctx context.Context) error {
+	args := m.Called(ctx)
+	return args.Error(0)
+}
+
+func (m *MockCallbackService) RunDeliveryLoop(ctx context.Context) {
+	m.Called(ctx)
+}
+
 // Mock Event
 type MockEvent struct {
 	mock.Mock
@@ -69,50 +205,221 @@ func (m *MockEvent) Subscribe(ctx context.Context, topic string, handler func([]
 	return args.Error(0)
 }
 
+func (m *MockEvent) Ping(ctx context.Context) error {
+	args := m.Called(ctx)
+	return args.Error(0)
+}
+
 func (m *MockEvent) Close() error {
 	args := m.Called()
 	return args.Error(0)
 }
 
+func newTestPool(t *testing.T, logger *slog.Logger) worker.Pool {
+	pool, err := worker.NewPool(worker.Config{Concurrency: 2, QueueSize: 10, Overflow: worker.OverflowReject}, logger)
+	if err != nil {
+		t.Fatalf("failed to create worker pool: %v", err)
+	}
+	t.Cleanup(func() {
+		pool.Shutdown(context.Background())
+	})
+	return pool
+}
+
 func TestSaveAndPost(t *testing.T) {
 	// Setup
 	mockRepo := new(MockVerveRepository)
-	mockRestClient := new(MockRestClient)
+	mockCallbacks := new(MockCallbackService)
+	mockWebhooks := new(MockWebhookService)
 	mockEvent := new(MockEvent)
 	logger := slog.Default()
 
-	service := service.NewImplVerveService(mockRepo, mockRestClient, logger, mockEvent)
+	service := service.NewImplVerveService(mockRepo, mockCallbacks, mockWebhooks, logger, mockEvent, nil)
 
-	// Test case 1: Successful save and post
-	t.Run("successful save and post", func(t *testing.T) {
+	// Test case 1: Successful save and callback registration
+	t.Run("successful save and register callback", func(t *testing.T) {
 		ctx := context.Background()
 		req := request.VerveRequest{
 			Id:  "123",
 			Url: "http://test.com",
 		}
 
-		mockRepo.On("Save", ctx, mock.AnythingOfType("entity.VerveEntity")).Return(nil)
-		mockRepo.On("GetUniqueCount", mock.Anything).Return(1, nil)
-		mockRestClient.On("Post", req.Url, mock.Anything).Return(req.Url, nil)
+		mockCallbacks.On("Admit").Return(nil).Once()
+		mockRepo.On("Save", ctx, currentWindow, mock.AnythingOfType("entity.VerveEntity")).Return(nil)
+		mockRepo.On("RegisterCallbacks", ctx, mock.AnythingOfType("time.Time"), []string{req.Url}).Return(nil)
 
 		err := service.SaveAndPost(ctx, req)
 		assert.NoError(t, err)
 
-		// Wait for goroutine to complete
-		time.Sleep(100 * time.Millisecond)
 		mockRepo.AssertExpectations(t)
-		mockRestClient.AssertExpectations(t)
+		mockCallbacks.AssertNotCalled(t, "Enqueue", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestSaveAndPostWhileCallbackQueueIsFull(t *testing.T) {
+	mockWebhooks := new(MockWebhookService)
+	mockEvent := new(MockEvent)
+	logger := slog.Default()
+
+	t.Run("refuses a url before saving the id while the callback queue is full", func(t *testing.T) {
+		mockRepo := new(MockVerveRepository)
+		mockCallbacks := new(MockCallbackService)
+		verveService := service.NewImplVerveService(mockRepo, mockCallbacks, mockWebhooks, logger, mockEvent, nil)
+		ctx := context.Background()
+
+		mockCallbacks.On("Admit").Return(worker.ErrQueueFull).Once()
+
+		err := verveService.SaveAndPost(ctx, request.VerveRequest{Id: "123", Url: "http://test.com"})
+		assert.ErrorIs(t, err, worker.ErrQueueFull)
+		mockRepo.AssertNotCalled(t, "Save", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("saves an id without url while the callback queue is full", func(t *testing.T) {
+		mockRepo := new(MockVerveRepository)
+		mockCallbacks := new(MockCallbackService)
+		verveService := service.NewImplVerveService(mockRepo, mockCallbacks, mockWebhooks, logger, mockEvent, nil)
+		ctx := context.Background()
+
+		mockRepo.On("Save", ctx, currentWindow, entity.VerveEntity{Id: "123"}).Return(nil).Once()
+
+		assert.NoError(t, verveService.SaveAndPost(ctx, request.VerveRequest{Id: "123"}))
+		mockCallbacks.AssertNotCalled(t, "Admit")
+	})
+}
+
+func TestSaveAllAndPost(t *testing.T) {
+	// Setup
+	mockRepo := new(MockVerveRepository)
+	mockCallbacks := new(MockCallbackService)
+	mockWebhooks := new(MockWebhookService)
+	mockEvent := new(MockEvent)
+	logger := slog.Default()
+
+	service := service.NewImplVerveService(mockRepo, mockCallbacks, mockWebhooks, logger, mockEvent, nil)
+
+	t.Run("saves batch once and registers each url once", func(t *testing.T) {
+		ctx := context.Background()
+		reqs := []request.VerveRequest{
+			{Id: "1", Url: "http://test.com"},
+			{Id: "2", Url: "http://test.com", Namespace: "tenant"},
+			{Id: "3"},
+		}
+
+		mockCallbacks.On("Admit").Return(nil).Once()
+		mockRepo.On("SaveAll", ctx, currentWindow, []entity.VerveEntity{
+			{Id: "1"},
+			{Id: "2", Namespace: "tenant"},
+			{Id: "3"},
+		}).Return(nil).Once()
+		mockRepo.On("RegisterCallbacks", ctx, mock.AnythingOfType("time.Time"), []string{"http://test.com"}).Return(nil).Once()
+
+		err := service.SaveAllAndPost(ctx, reqs)
+		assert.NoError(t, err)
+
+		mockRepo.AssertExpectations(t)
+	})
+}
+
+func TestFlushWindow(t *testing.T) {
+	window := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	t.Run("owner publishes the total across namespaces, fans out per subscribed namespace and enqueues the total once per url", func(t *testing.T) {
+		mockRepo := new(MockVerveRepository)
+		mockCallbacks := new(MockCallbackService)
+		mockWebhooks := new(MockWebhookService)
+		mockEvent := new(MockEvent)
+		logger := slog.Default()
+		service := service.NewImplVerveService(mockRepo, mockCallbacks, mockWebhooks, logger, mockEvent, nil)
+		ctx := context.Background()
+
+		counts := map[string]int64{"": 7, "shop": 3}
+		mockRepo.On("GetUniqueCounts", ctx, window).Return(counts, nil)
+		mockRepo.On("FinalizeCounts", ctx, window, counts).Return(counts, true, nil)
+		mockRepo.On("IsApproximate", ctx, window).Return(false, nil)
+		mockEvent.On("Publish", ctx, "unique_count", "10").Return(nil).Once()
+		namespacePayload := func(namespace string, count int64) interface{} {
+			return mock.MatchedBy(func(p entity.CallbackPayload) bool {
+				return p.Namespace == namespace && p.Count == count && p.WindowStart.Equal(window)
+			})
+		}
+		mockWebhooks.On("Fanout", ctx, request.EventUniqueCountRollup, "", namespacePayload("", 7)).Return(nil).Once()
+		mockWebhooks.On("Namespaces", ctx).Return([]string{"", "shop", "idle"}, nil).Once()
+		mockWebhooks.On("Fanout", ctx, request.EventUniqueCountRollup, "shop", namespacePayload("shop", 3)).Return(nil).Once()
+		// A subscribed namespace without ids in the window gets a roll-up of 0.
+		mockWebhooks.On("Fanout", ctx, request.EventUniqueCountRollup, "idle", namespacePayload("idle", 0)).Return(nil).Once()
+		mockRepo.On("PopCallbacks", ctx, window, int64(100)).Return([]string{"http://a.com", "http://b.com"}, nil).Once()
+		mockRepo.On("CallbackOrigins", ctx, window, []string{"http://a.com", "http://b.com"}).Return(map[string]entity.CallbackOrigin{}, nil)
+		mockRepo.On("PopCallbacks", ctx, window, int64(100)).Return([]string{}, nil).Once()
+		windowPayload := mock.MatchedBy(func(p entity.CallbackPayload) bool {
+			return p.Count == 10 && p.Namespace == "" && p.WindowStart.Equal(window) && p.WindowEnd.Equal(window.Add(time.Minute))
+		})
+		mockCallbacks.On("Enqueue", ctx, "http://a.com", windowPayload).Return("d1", nil).Once()
+		mockCallbacks.On("Enqueue", ctx, "http://b.com", windowPayload).Return("d2", nil).Once()
+
+		err := service.FlushWindow(ctx, window)
+		assert.NoError(t, err)
+
+		mockRepo.AssertExpectations(t)
+		mockEvent.AssertExpectations(t)
+		mockCallbacks.AssertExpectations(t)
+		mockWebhooks.AssertExpectations(t)
+	})
+
+	t.Run("fans out the counted namespaces when the subscribed ones cannot be listed", func(t *testing.T) {
+		mockRepo := new(MockVerveRepository)
+		mockCallbacks := new(MockCallbackService)
+		mockWebhooks := new(MockWebhookService)
+		mockEvent := new(MockEvent)
+		service := service.NewImplVerveService(mockRepo, mockCallbacks, mockWebhooks, slog.Default(), mockEvent, nil)
+		ctx := context.Background()
+
+		counts := map[string]int64{"shop": 3}
+		mockRepo.On("GetUniqueCounts", ctx, window).Return(counts, nil)
+		mockRepo.On("FinalizeCounts", ctx, window, counts).Return(counts, true, nil)
+		mockRepo.On("IsApproximate", ctx, window).Return(false, nil)
+		mockEvent.On("Publish", ctx, "unique_count", "3").Return(nil).Once()
+		mockWebhooks.On("Namespaces", ctx).Return(nil, errors.New("redis down")).Once()
+		mockWebhooks.On("Fanout", ctx, request.EventUniqueCountRollup, "shop", mock.MatchedBy(func(p entity.CallbackPayload) bool {
+			return p.Count == 3
+		})).Return(nil).Once()
+		mockRepo.On("PopCallbacks", ctx, window, int64(100)).Return([]string{}, nil).Once()
+
+		assert.NoError(t, service.FlushWindow(ctx, window))
+		mockWebhooks.AssertExpectations(t)
+	})
+
+	t.Run("other replicas use the stored count and do not publish", func(t *testing.T) {
+		mockRepo := new(MockVerveRepository)
+		mockCallbacks := new(MockCallbackService)
+		mockWebhooks := new(MockWebhookService)
+		mockEvent := new(MockEvent)
+		logger := slog.Default()
+		service := service.NewImplVerveService(mockRepo, mockCallbacks, mockWebhooks, logger, mockEvent, nil)
+		ctx := context.Background()
+
+		mockRepo.On("GetUniqueCounts", ctx, window).Return(map[string]int64{}, nil)
+		mockRepo.On("FinalizeCounts", ctx, window, map[string]int64{}).Return(map[string]int64{"": 7}, false, nil)
+		mockRepo.On("IsApproximate", ctx, window).Return(false, nil)
+		mockRepo.On("PopCallbacks", ctx, window, int64(100)).Return([]string{}, nil).Once()
+
+		err := service.FlushWindow(ctx, window)
+		assert.NoError(t, err)
+
+		mockRepo.AssertExpectations(t)
+		mockEvent.AssertNotCalled(t, "Publish", mock.Anything, mock.Anything, mock.Anything)
+		mockWebhooks.AssertNotCalled(t, "Fanout", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
 	})
 }
 
 func TestLogUniqueCountEveryMinute(t *testing.T) {
 	// Setup
 	mockRepo := new(MockVerveRepository)
-	mockRestClient := new(MockRestClient)
+	mockCallbacks := new(MockCallbackService)
+	mockWebhooks := new(MockWebhookService)
 	mockEvent := new(MockEvent)
 	logger := slog.Default()
 
-	service := service.NewImplVerveService(mockRepo, mockRestClient, logger, mockEvent)
+	service := service.NewImplVerveService(mockRepo, mockCallbacks, mockWebhooks, logger, mockEvent, nil)
 
 	t.Run("logs count successfully", func(t *testing.T) {
 		// Create context with shorter timeout for testing
@@ -120,7 +427,7 @@ func TestLogUniqueCountEveryMinute(t *testing.T) {
 		defer cancel()
 
 		// Setup mock expectations
-		mockRepo.On("GetUniqueCount", mock.Anything).Return(5, nil).Maybe()
+		mockRepo.On("GetUniqueCount", mock.Anything, mock.Anything).Return(5, nil).Maybe()
 
 		// Create done channel to signal test completion
 		done := make(chan bool)
@@ -147,11 +454,12 @@ func TestLogUniqueCountEveryMinute(t *testing.T) {
 func TestSendUniqueCountEveryMinute(t *testing.T) {
 	// Setup
 	mockRepo := new(MockVerveRepository)
-	mockRestClient := new(MockRestClient)
+	mockCallbacks := new(MockCallbackService)
+	mockWebhooks := new(MockWebhookService)
 	mockEvent := new(MockEvent)
 	logger := slog.Default()
 
-	service := service.NewImplVerveService(mockRepo, mockRestClient, logger, mockEvent)
+	service := service.NewImplVerveService(mockRepo, mockCallbacks, mockWebhooks, logger, mockEvent, nil)
 
 	t.Run("sends count successfully", func(t *testing.T) {
 		// Create shorter context for testing
@@ -159,7 +467,7 @@ func TestSendUniqueCountEveryMinute(t *testing.T) {
 		defer cancel()
 
 		// Setup mock expectations
-		mockRepo.On("GetUniqueCount", mock.Anything).Return(5, nil).Maybe()
+		mockRepo.On("GetUniqueCount", mock.Anything, mock.Anything).Return(5, nil).Maybe()
 		mockEvent.On("Publish", mock.Anything, "unique_count", mock.Anything).Return(nil).Maybe()
 
 		// Channel to track test completion
@@ -184,3 +492,98 @@ func TestSendUniqueCountEveryMinute(t *testing.T) {
 		mockEvent.AssertExpectations(t)
 	})
 }
+
+func TestCallbacksCarryTheRequestId(t *testing.T) {
+	window := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	t.Run("records the request registering a url", func(t *testing.T) {
+		mockRepo := new(MockVerveRepository)
+		mockCallbacks := new(MockCallbackService)
+		service := service.NewImplVerveService(mockRepo, mockCallbacks, new(MockWebhookService), slog.Default(), new(MockEvent), nil)
+		ctx := requestid.WithID(context.Background(), "req-1")
+
+		mockCallbacks.On("Admit").Return(nil).Once()
+		mockRepo.On("Save", ctx, currentWindow, mock.Anything).Return(nil).Once()
+		mockRepo.On("RegisterCallbacks", ctx, mock.AnythingOfType("time.Time"), []string{"http://a.com"}).Return(nil).Once()
+		mockRepo.On("SaveCallbackOrigins", ctx, mock.AnythingOfType("time.Time"), map[string]entity.CallbackOrigin{
+			"http://a.com": {RequestId: "req-1", Namespace: "shop"},
+		}).Return(nil).Once()
+
+		assert.NoError(t, service.SaveAndPost(ctx, request.VerveRequest{Id: "1", Url: "http://a.com", Namespace: "shop"}))
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("enqueues the callback with the recorded request id", func(t *testing.T) {
+		mockRepo := new(MockVerveRepository)
+		mockCallbacks := new(MockCallbackService)
+		service := service.NewImplVerveService(mockRepo, mockCallbacks, new(MockWebhookService), slog.Default(), new(MockEvent), nil)
+		ctx := context.Background()
+
+		mockRepo.On("GetUniqueCounts", ctx, window).Return(map[string]int64{}, nil)
+		mockRepo.On("FinalizeCounts", ctx, window, map[string]int64{}).Return(map[string]int64{"": 7}, false, nil)
+		mockRepo.On("IsApproximate", ctx, window).Return(false, nil)
+		mockRepo.On("PopCallbacks", ctx, window, int64(100)).Return([]string{"http://a.com", "http://b.com"}, nil).Once()
+		mockRepo.On("PopCallbacks", ctx, window, int64(100)).Return([]string{}, nil).Once()
+		mockRepo.On("CallbackOrigins", ctx, window, []string{"http://a.com", "http://b.com"}).
+			Return(map[string]entity.CallbackOrigin{"http://a.com": {RequestId: "req-1"}}, nil)
+		withRequestId := func(id string) interface{} {
+			return mock.MatchedBy(func(ctx context.Context) bool { return requestid.FromContext(ctx) == id })
+		}
+		mockCallbacks.On("Enqueue", withRequestId("req-1"), "http://a.com", mock.Anything).Return("d1", nil).Once()
+		mockCallbacks.On("Enqueue", withRequestId(""), "http://b.com", mock.Anything).Return("d2", nil).Once()
+
+		assert.NoError(t, service.FlushWindow(ctx, window))
+		mockCallbacks.AssertExpectations(t)
+	})
+
+	t.Run("does not send the request id of the flushing request", func(t *testing.T) {
+		mockRepo := new(MockVerveRepository)
+		mockCallbacks := new(MockCallbackService)
+		mockWebhooks := new(MockWebhookService)
+		mockEvent := new(MockEvent)
+		service := service.NewImplVerveService(mockRepo, mockCallbacks, mockWebhooks, slog.Default(), mockEvent, nil)
+		ctx := requestid.WithID(context.Background(), "admin-req")
+		withRequestId := func(id string) interface{} {
+			return mock.MatchedBy(func(ctx context.Context) bool { return requestid.FromContext(ctx) == id })
+		}
+
+		mockRepo.On("GetUniqueCounts", ctx, window).Return(map[string]int64{"": 7}, nil)
+		mockRepo.On("FinalizeCounts", ctx, window, map[string]int64{"": 7}).Return(map[string]int64{"": 7}, true, nil)
+		mockRepo.On("IsApproximate", ctx, window).Return(false, nil)
+		mockEvent.On("Publish", withRequestId(""), "unique_count", "7").Return(nil).Once()
+		mockWebhooks.On("Namespaces", withRequestId("")).Return([]string{""}, nil).Once()
+		mockWebhooks.On("Fanout", withRequestId(""), request.EventUniqueCountRollup, "", mock.Anything).Return(nil).Once()
+		mockRepo.On("PopCallbacks", mock.Anything, window, int64(100)).Return([]string{"http://a.com", "http://b.com"}, nil).Once()
+		mockRepo.On("PopCallbacks", mock.Anything, window, int64(100)).Return([]string{}, nil).Once()
+		mockRepo.On("CallbackOrigins", mock.Anything, window, []string{"http://a.com", "http://b.com"}).
+			Return(map[string]entity.CallbackOrigin{"http://a.com": {RequestId: "req-1"}}, nil)
+		mockCallbacks.On("Enqueue", withRequestId("req-1"), "http://a.com", mock.Anything).Return("d1", nil).Once()
+		mockCallbacks.On("Enqueue", withRequestId(""), "http://b.com", mock.Anything).Return("d2", nil).Once()
+
+		assert.NoError(t, service.FlushWindow(ctx, window))
+		mockEvent.AssertExpectations(t)
+		mockWebhooks.AssertExpectations(t)
+		mockCallbacks.AssertExpectations(t)
+	})
+
+	t.Run("sends the count of the namespace that registered the url", func(t *testing.T) {
+		mockRepo := new(MockVerveRepository)
+		mockCallbacks := new(MockCallbackService)
+		service := service.NewImplVerveService(mockRepo, mockCallbacks, new(MockWebhookService), slog.Default(), new(MockEvent), nil)
+		ctx := context.Background()
+
+		mockRepo.On("GetUniqueCounts", ctx, window).Return(map[string]int64{}, nil)
+		mockRepo.On("FinalizeCounts", ctx, window, map[string]int64{}).Return(map[string]int64{"": 7, "shop": 3}, false, nil)
+		mockRepo.On("IsApproximate", ctx, window).Return(false, nil)
+		mockRepo.On("PopCallbacks", ctx, window, int64(100)).Return([]string{"http://a.com"}, nil).Once()
+		mockRepo.On("PopCallbacks", ctx, window, int64(100)).Return([]string{}, nil).Once()
+		mockRepo.On("CallbackOrigins", ctx, window, []string{"http://a.com"}).
+			Return(map[string]entity.CallbackOrigin{"http://a.com": {Namespace: "shop"}}, nil)
+		mockCallbacks.On("Enqueue", ctx, "http://a.com", mock.MatchedBy(func(p entity.CallbackPayload) bool {
+			return p.Namespace == "shop" && p.Count == 3
+		})).Return("d1", nil).Once()
+
+		assert.NoError(t, service.FlushWindow(ctx, window))
+		mockCallbacks.AssertExpectations(t)
+	})
+}
@@ -0,0 +1,175 @@
+package test
+
+import (
+	"Verve/internal/model/entity"
+	"Verve/internal/model/request"
+	"Verve/internal/service"
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// Mock WebhookRepository
+type MockWebhookRepository struct {
+	mock.Mock
+}
+
+func (m *MockWebhookRepository) Save(ctx context.Context, subscription entity.WebhookSubscription) error {
+	args := m.Called(ctx, subscription)
+	return args.Error(0)
+}
+
+func (m *MockWebhookRepository) Get(ctx context.Context, id string) (*entity.WebhookSubscription, error) {
+	args := m.Called(ctx, id)
+	subscription, _ := args.Get(0).(*entity.WebhookSubscription)
+	return subscription, args.Error(1)
+}
+
+func (m *MockWebhookRepository) ListByNamespace(ctx context.Context, namespace string) ([]entity.WebhookSubscription, error) {
+	args := m.Called(ctx, namespace)
+	subscriptions, _ := args.Get(0).([]entity.WebhookSubscription)
+	return subscriptions, args.Error(1)
+}
+
+func (m *MockWebhookRepository) ListNamespaces(ctx context.Context) ([]string, error) {
+	args := m.Called(ctx)
+	namespaces, _ := args.Get(0).([]string)
+	return namespaces, args.Error(1)
+}
+
+func (m *MockWebhookRepository) Delete(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+// Mock WebhookService
+type MockWebhookService struct {
+	mock.Mock
+}
+
+func (m *MockWebhookService) Create(ctx context.Context, webhook request.WebhookRequest) (*entity.WebhookSubscription, error) {
+	args := m.Called(ctx, webhook)
+	subscription, _ := args.Get(0).(*entity.WebhookSubscription)
+	return subscription, args.Error(1)
+}
+
+func (m *MockWebhookService) Get(ctx context.Context, id string) (*entity.WebhookSubscription, error) {
+	args := m.Called(ctx, id)
+	subscription, _ := args.Get(0).(*entity.WebhookSubscription)
+	return subscription, args.Error(1)
+}
+
+func (m *MockWebhookService) List(ctx context.Context, namespace string) ([]entity.WebhookSubscription, error) {
+	args := m.Called(ctx, namespace)
+	subscriptions, _ := args.Get(0).([]entity.WebhookSubscription)
+	return subscriptions, args.Error(1)
+}
+
+func (m *MockWebhookService) Delete(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockWebhookService) Fanout(ctx context.Context, event string, namespace string, payload entity.CallbackPayload) error {
+	args := m.Called(ctx, event, namespace, payload)
+	return args.Error(0)
+}
+
+func (m *MockWebhookService) Namespaces(ctx context.Context) ([]string, error) {
+	args := m.Called(ctx)
+	namespaces, _ := args.Get(0).([]string)
+	return namespaces, args.Error(1)
+}
+
+func TestCreateWebhook(t *testing.T) {
+	webhook := request.WebhookRequest{
+		CallbackTemplateRequest: request.CallbackTemplateRequest{Url: "http://a.com"},
+		Namespace:               "shop",
+		Events:                  []string{request.EventUniqueCountRollup},
+	}
+
+	t.Run("generates a secret when none is given", func(t *testing.T) {
+		mockRepo := new(MockWebhookRepository)
+		webhooks := service.NewImplWebhookService(mockRepo, new(MockCallbackService), slog.Default())
+		ctx := context.Background()
+
+		mockRepo.On("Save", ctx, mock.MatchedBy(func(s entity.WebhookSubscription) bool {
+			return s.Namespace == "shop" && len(s.Id) == 32 && len(s.Secret) == 64
+		})).Return(nil).Once()
+
+		subscription, err := webhooks.Create(ctx, webhook)
+		assert.NoError(t, err)
+		assert.Len(t, subscription.Secret, 64)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("keeps the given secret", func(t *testing.T) {
+		mockRepo := new(MockWebhookRepository)
+		webhooks := service.NewImplWebhookService(mockRepo, new(MockCallbackService), slog.Default())
+		ctx := context.Background()
+		withSecret := webhook
+		withSecret.Secret = "0123456789abcdef"
+
+		mockRepo.On("Save", ctx, mock.MatchedBy(func(s entity.WebhookSubscription) bool {
+			return s.Secret == "0123456789abcdef"
+		})).Return(nil).Once()
+
+		subscription, err := webhooks.Create(ctx, withSecret)
+		assert.NoError(t, err)
+		assert.Equal(t, "0123456789abcdef", subscription.Secret)
+	})
+}
+
+func TestListWebhooksRedactsSecrets(t *testing.T) {
+	mockRepo := new(MockWebhookRepository)
+	webhooks := service.NewImplWebhookService(mockRepo, new(MockCallbackService), slog.Default())
+	ctx := context.Background()
+
+	mockRepo.On("ListByNamespace", ctx, "shop").Return([]entity.WebhookSubscription{
+		{Id: "w1", Namespace: "shop", Secret: "0123456789abcdef"},
+	}, nil).Once()
+
+	subscriptions, err := webhooks.List(ctx, "shop")
+	assert.NoError(t, err)
+	assert.Len(t, subscriptions, 1)
+	assert.Empty(t, subscriptions[0].Secret)
+}
+
+func TestFanout(t *testing.T) {
+	window := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	payload := entity.CallbackPayload{Count: 3, WindowStart: window, WindowEnd: window.Add(time.Minute), Namespace: "shop"}
+
+	t.Run("enqueues the event for every matching subscription", func(t *testing.T) {
+		mockRepo := new(MockWebhookRepository)
+		mockCallbacks := new(MockCallbackService)
+		webhooks := service.NewImplWebhookService(mockRepo, mockCallbacks, slog.Default())
+		ctx := context.Background()
+
+		all := entity.WebhookSubscription{Id: "w1", Namespace: "shop"}
+		rollup := entity.WebhookSubscription{Id: "w2", Namespace: "shop", Events: []string{request.EventUniqueCountRollup}}
+		other := entity.WebhookSubscription{Id: "w3", Namespace: "shop", Events: []string{"other"}}
+		mockRepo.On("ListByNamespace", ctx, "shop").Return([]entity.WebhookSubscription{all, rollup, other}, nil).Once()
+		mockCallbacks.On("EnqueueWebhook", ctx, all, request.EventUniqueCountRollup, payload).Return("d1", nil).Once()
+		mockCallbacks.On("EnqueueWebhook", ctx, rollup, request.EventUniqueCountRollup, payload).Return("", errors.New("redis down")).Once()
+
+		err := webhooks.Fanout(ctx, request.EventUniqueCountRollup, "shop", payload)
+		assert.NoError(t, err)
+		mockCallbacks.AssertExpectations(t)
+		mockCallbacks.AssertNotCalled(t, "EnqueueWebhook", ctx, other, mock.Anything, mock.Anything)
+	})
+
+	t.Run("list errors are returned", func(t *testing.T) {
+		mockRepo := new(MockWebhookRepository)
+		webhooks := service.NewImplWebhookService(mockRepo, new(MockCallbackService), slog.Default())
+		ctx := context.Background()
+
+		mockRepo.On("ListByNamespace", ctx, "shop").Return(nil, errors.New("redis down")).Once()
+
+		assert.Error(t, webhooks.Fanout(ctx, request.EventUniqueCountRollup, "shop", payload))
+	})
+}
@@ -0,0 +1,173 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+)
+
+// OverflowPolicy decides what happens to a task submitted while the queue is full.
+type OverflowPolicy string
+
+const (
+	// OverflowDrop discards the task and reports success to the caller.
+	OverflowDrop OverflowPolicy = "drop"
+	// OverflowReject discards the task and returns ErrQueueFull to the caller.
+	// Admit reports it before work that ends up in the queue is accepted.
+	OverflowReject OverflowPolicy = "reject"
+)
+
+var (
+	ErrQueueFull  = errors.New("worker queue is full")
+	ErrPoolClosed = errors.New("worker pool is closed")
+)
+
+// Task is a unit of work. The context is cancelled when a shutdown runs out of time.
+type Task func(ctx context.Context)
+
+type Pool interface {
+	Submit(task Task) error
+	Admit() error
+	Shutdown(ctx context.Context) error
+	QueueDepth() int
+	Dropped() int64
+}
+
+type Config struct {
+	Concurrency int
+	QueueSize   int
+	Overflow    OverflowPolicy
+}
+
+func (c Config) Validate() error {
+	if c.Concurrency <= 0 {
+		return fmt.Errorf("worker concurrency must be positive, got %d", c.Concurrency)
+	}
+	if c.QueueSize < 0 {
+		return fmt.Errorf("worker queue size must not be negative, got %d", c.QueueSize)
+	}
+	switch c.Overflow {
+	case OverflowDrop, OverflowReject:
+	default:
+		return fmt.Errorf("unknown worker overflow policy %q", c.Overflow)
+	}
+	return nil
+}
+
+type implPool struct {
+	config  Config
+	logger  *slog.Logger
+	queue   chan Task
+	wg      sync.WaitGroup
+	mu      sync.RWMutex
+	closed  bool
+	dropped atomic.Int64
+	ctx     context.Context
+	cancel  context.CancelFunc
+}
+
+// NewPool starts config.Concurrency workers consuming a queue of config.QueueSize tasks.
+func NewPool(config Config, logger *slog.Logger) (*implPool, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	pool := &implPool{
+		config: config,
+		logger: logger,
+		queue:  make(chan Task, config.QueueSize),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	for i := 0; i < config.Concurrency; i++ {
+		pool.wg.Add(1)
+		go pool.work()
+	}
+	return pool, nil
+}
+
+func (p *implPool) work() {
+	defer p.wg.Done()
+	for task := range p.queue {
+		p.run(task)
+	}
+}
+
+func (p *implPool) run(task Task) {
+	defer func() {
+		if r := recover(); r != nil {
+			p.logger.Error("Recovered from panic in worker task", "error", r)
+		}
+	}()
+	task(p.ctx)
+}
+
+// Submit queues the task without blocking. When the queue is full the task is
+// discarded according to the overflow policy.
+func (p *implPool) Submit(task Task) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return ErrPoolClosed
+	}
+
+	select {
+	case p.queue <- task:
+		return nil
+	default:
+	}
+
+	p.dropped.Add(1)
+	if p.config.Overflow == OverflowReject {
+		return ErrQueueFull
+	}
+	p.logger.Warn("Worker queue is full, dropping task", "queue_size", p.config.QueueSize)
+	return nil
+}
+
+// Admit returns ErrQueueFull while the queue is full under the reject policy, so
+// that callers can refuse work that would later be queued. The drop policy and
+// an unbuffered queue admit everything.
+func (p *implPool) Admit() error {
+	if p.config.Overflow == OverflowReject && cap(p.queue) > 0 && len(p.queue) >= cap(p.queue) {
+		return ErrQueueFull
+	}
+	return nil
+}
+
+// Shutdown stops accepting tasks and waits for queued and running tasks to finish.
+// If ctx expires first, running tasks are cancelled and ctx.Err() is returned.
+func (p *implPool) Shutdown(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.queue)
+	}
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		p.cancel()
+		return nil
+	case <-ctx.Done():
+		p.cancel()
+		return ctx.Err()
+	}
+}
+
+func (p *implPool) QueueDepth() int {
+	return len(p.queue)
+}
+
+func (p *implPool) Dropped() int64 {
+	return p.dropped.Load()
+}
@@ -0,0 +1,95 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPoolRejectsWhenQueueIsFull(t *testing.T) {
+	pool, err := NewPool(Config{Concurrency: 1, QueueSize: 1, Overflow: OverflowReject}, slog.Default())
+	if err != nil {
+		t.Fatalf("failed to create pool: %v", err)
+	}
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	if err := pool.Submit(func(ctx context.Context) {
+		close(started)
+		<-release
+	}); err != nil {
+		t.Fatalf("unexpected error submitting first task: %v", err)
+	}
+	<-started
+
+	if err := pool.Submit(func(ctx context.Context) {}); err != nil {
+		t.Fatalf("unexpected error submitting queued task: %v", err)
+	}
+	if err := pool.Admit(); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("expected Admit to report ErrQueueFull, got %v", err)
+	}
+	if err := pool.Submit(func(ctx context.Context) {}); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("expected ErrQueueFull, got %v", err)
+	}
+	if pool.Dropped() != 1 {
+		t.Fatalf("expected 1 dropped task, got %d", pool.Dropped())
+	}
+
+	close(release)
+	if err := pool.Shutdown(context.Background()); err != nil {
+		t.Fatalf("unexpected shutdown error: %v", err)
+	}
+	if err := pool.Submit(func(ctx context.Context) {}); !errors.Is(err, ErrPoolClosed) {
+		t.Fatalf("expected ErrPoolClosed, got %v", err)
+	}
+}
+
+func TestPoolShutdownDrainsQueue(t *testing.T) {
+	pool, err := NewPool(Config{Concurrency: 2, QueueSize: 100, Overflow: OverflowDrop}, slog.Default())
+	if err != nil {
+		t.Fatalf("failed to create pool: %v", err)
+	}
+
+	var ran atomic.Int64
+	for i := 0; i < 50; i++ {
+		pool.Submit(func(ctx context.Context) {
+			time.Sleep(time.Millisecond)
+			ran.Add(1)
+		})
+	}
+
+	if err := pool.Shutdown(context.Background()); err != nil {
+		t.Fatalf("unexpected shutdown error: %v", err)
+	}
+	if ran.Load() != 50 {
+		t.Fatalf("expected 50 tasks to run, got %d", ran.Load())
+	}
+}
+
+func TestPoolShutdownTimeoutCancelsTasks(t *testing.T) {
+	pool, err := NewPool(Config{Concurrency: 1, QueueSize: 1, Overflow: OverflowDrop}, slog.Default())
+	if err != nil {
+		t.Fatalf("failed to create pool: %v", err)
+	}
+
+	cancelled := make(chan struct{})
+	pool.Submit(func(ctx context.Context) {
+		<-ctx.Done()
+		close(cancelled)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := pool.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("running task was not cancelled")
+	}
+}
@@ -0,0 +1,155 @@
+// Package signature signs and verifies Verve callback payloads.
+//
+// Every callback carries the unix timestamp of the call in X-Verve-Timestamp and
+// one HMAC-SHA256 signature per active key in X-Verve-Signature, formatted as
+// comma separated "keyId=hexDigest" pairs. The digest covers "timestamp.body".
+// Receivers call Verify (or VerifyRequest) with the keys they share with Verve;
+// a callback is valid when any of its signatures matches one of those keys,
+// which lets keys be rotated without downtime.
+package signature
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SignatureHeader = "X-Verve-Signature"
+	TimestampHeader = "X-Verve-Timestamp"
+
+	// DefaultTolerance is the maximum accepted age of a callback.
+	DefaultTolerance = 5 * time.Minute
+)
+
+var (
+	ErrNoKeys             = errors.New("no signing keys configured")
+	ErrMissingSignature   = errors.New("missing signature headers")
+	ErrInvalidTimestamp   = errors.New("invalid signature timestamp")
+	ErrTimestampTolerance = errors.New("signature timestamp outside of tolerance")
+	ErrInvalidSignature   = errors.New("no signature matches")
+)
+
+// Key is a shared secret identified by an id that is sent along with the signature.
+type Key struct {
+	Id     string
+	Secret string
+}
+
+// ParseKeys parses "id:secret" pairs separated by commas.
+func ParseKeys(value string) ([]Key, error) {
+	var keys []Key
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		id, secret, ok := strings.Cut(pair, ":")
+		if !ok || id == "" || secret == "" {
+			return nil, fmt.Errorf("invalid signing key %q, expected id:secret", id)
+		}
+		if strings.ContainsAny(id, ",= ") {
+			return nil, fmt.Errorf("invalid signing key id %q", id)
+		}
+		keys = append(keys, Key{Id: id, Secret: secret})
+	}
+	return keys, nil
+}
+
+// Signer signs payloads with every active key.
+type Signer struct {
+	keys []Key
+}
+
+func NewSigner(keys ...Key) (*Signer, error) {
+	if len(keys) == 0 {
+		return nil, ErrNoKeys
+	}
+	return &Signer{keys: keys}, nil
+}
+
+// Sign returns the headers to send along with body.
+func (s *Signer) Sign(body []byte, now time.Time) map[string]string {
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	signatures := make([]string, 0, len(s.keys))
+	for _, key := range s.keys {
+		signatures = append(signatures, key.Id+"="+hex.EncodeToString(compute(key.Secret, timestamp, body)))
+	}
+	return map[string]string{
+		TimestampHeader: timestamp,
+		SignatureHeader: strings.Join(signatures, ","),
+	}
+}
+
+// Verify checks the signature headers of a callback against the receiver's keys.
+// A tolerance of zero uses DefaultTolerance.
+func Verify(keys []Key, header http.Header, body []byte, tolerance time.Duration, now time.Time) error {
+	if len(keys) == 0 {
+		return ErrNoKeys
+	}
+	timestamp := header.Get(TimestampHeader)
+	signatures := header.Get(SignatureHeader)
+	if timestamp == "" || signatures == "" {
+		return ErrMissingSignature
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidTimestamp
+	}
+	if tolerance <= 0 {
+		tolerance = DefaultTolerance
+	}
+	age := now.Sub(time.Unix(seconds, 0))
+	if age > tolerance || age < -tolerance {
+		return ErrTimestampTolerance
+	}
+
+	for _, pair := range strings.Split(signatures, ",") {
+		id, digest, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			continue
+		}
+		signature, err := hex.DecodeString(digest)
+		if err != nil {
+			continue
+		}
+		for _, key := range keys {
+			if key.Id != id {
+				continue
+			}
+			if hmac.Equal(signature, compute(key.Secret, timestamp, body)) {
+				return nil
+			}
+		}
+	}
+	return ErrInvalidSignature
+}
+
+// VerifyRequest reads and verifies the body of an incoming callback, the body is
+// restored on the request so that handlers can still decode it.
+func VerifyRequest(r *http.Request, keys []Key, tolerance time.Duration) error {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read request body: %w", err)
+	}
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return Verify(keys, r.Header, body, tolerance, time.Now())
+}
+
+func compute(secret, timestamp string, body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
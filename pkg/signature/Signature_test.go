@@ -0,0 +1,72 @@
+package signature
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func signedHeader(t *testing.T, keys []Key, body []byte, now time.Time) http.Header {
+	signer, err := NewSigner(keys...)
+	if err != nil {
+		t.Fatalf("failed to create signer: %v", err)
+	}
+	header := http.Header{}
+	for key, value := range signer.Sign(body, now) {
+		header.Set(key, value)
+	}
+	return header
+}
+
+func TestSignAndVerify(t *testing.T) {
+	now := time.Now()
+	body := []byte(`{"count":7}`)
+	current := Key{Id: "k2", Secret: "new-secret"}
+	previous := Key{Id: "k1", Secret: "old-secret"}
+	header := signedHeader(t, []Key{previous, current}, body, now)
+
+	tests := []struct {
+		name    string
+		keys    []Key
+		body    []byte
+		now     time.Time
+		wantErr error
+	}{
+		{"current key", []Key{current}, body, now, nil},
+		{"previous key during rotation", []Key{previous}, body, now, nil},
+		{"unknown key", []Key{{Id: "k3", Secret: "other"}}, body, now, ErrInvalidSignature},
+		{"wrong secret", []Key{{Id: "k2", Secret: "guess"}}, body, now, ErrInvalidSignature},
+		{"tampered body", []Key{current}, []byte(`{"count":8}`), now, ErrInvalidSignature},
+		{"stale timestamp", []Key{current}, body, now.Add(10 * time.Minute), ErrTimestampTolerance},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(tt.keys, header, tt.body, 0, tt.now)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestVerifyMissingHeaders(t *testing.T) {
+	err := Verify([]Key{{Id: "k1", Secret: "s"}}, http.Header{}, nil, 0, time.Now())
+	if !errors.Is(err, ErrMissingSignature) {
+		t.Fatalf("expected ErrMissingSignature, got %v", err)
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	keys, err := ParseKeys("k1:secret-one, k2:secret:two")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(keys) != 2 || keys[1].Id != "k2" || keys[1].Secret != "secret:two" {
+		t.Fatalf("unexpected keys %+v", keys)
+	}
+	if _, err := ParseKeys("missing-secret"); err == nil {
+		t.Fatal("expected error for key without secret")
+	}
+}